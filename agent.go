@@ -0,0 +1,257 @@
+package goprof
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+)
+
+// AgentConfig configures a continuous profiling agent.
+// Zero values fall back to the defaults noted on each field.
+type AgentConfig struct {
+	// Name prefixes every capture; "goprof-agent" by default.
+	Name string
+	// Interval is the time between the start of two captures; 2 minutes by default.
+	Interval time.Duration
+	// Schedule is a cron expression, minute hour day-of-month month
+	// day-of-week in local time, that captures start on instead of every
+	// Interval, e.g. "*/30 * * * *" or "*/5 9-17 * * 1-5" for every five
+	// minutes during business hours. A capture still running at a
+	// scheduled time delays the next one to the time after.
+	Schedule string
+	// Duration is how long the CPU profile of each capture runs; 10 seconds by default.
+	Duration time.Duration
+	// Sink receives the captures; DirSink{"."} by default.
+	Sink Sink
+	// Recipients are age X25519 public keys to encrypt the profiles of
+	// every capture to, as WithEncryption does for sessions.
+	Recipients []string
+
+	// KeepLast keeps only the newest KeepLast captures when > 0.
+	KeepLast int
+	// MaxAge deletes captures older than MaxAge when > 0.
+	MaxAge time.Duration
+
+	// HistoryDir keeps the history of the captures, see History, in
+	// <HistoryDir>/<Name>.history.jsonl; no history when empty.
+	HistoryDir string
+
+	// Notifiers are told about every capture once the sink has it.
+	Notifiers []Notifier
+
+	// OnError is called for every failed capture; errors are logged to
+	// stderr by default. A capture skipped because a session has the CPU
+	// profiler is not an error.
+	OnError func(error)
+}
+
+var ErrNoDeleter = errors.New("retention requires a sink that implements Deleter")
+
+// Agent periodically captures short CPU and heap profiles.
+//
+// Captures happen in memory and are independent of Start and Stop, but the
+// CPU profiler can only be used by one party at a time: a capture that
+// overlaps a session is skipped, and Start fails while a capture is running.
+//
+// Retention only applies to captures made by this agent; captures left over
+// from a previous process are not pruned.
+type Agent struct {
+	cfg    AgentConfig
+	sched  *schedule // nil to capture every Interval
+	recips []age.Recipient
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+
+	captures []*Manifest // oldest first
+}
+
+// StartAgent starts capturing in the background until Stop is called.
+func StartAgent(cfg AgentConfig) (*Agent, error) {
+	if buildDisabled {
+		done := make(chan struct{})
+		close(done)
+		return &Agent{cfg: cfg, cancel: func() {}, done: done}, nil
+	}
+	if cfg.Name == "" {
+		cfg.Name = "goprof-agent"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Minute
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = 10 * time.Second
+	}
+	var sched *schedule
+	if cfg.Schedule != "" {
+		var err error
+		if sched, err = parseSchedule(cfg.Schedule); err != nil {
+			return nil, err
+		}
+		if sched.next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("%w %q: never matches", ErrBadSchedule, cfg.Schedule)
+		}
+	} else if cfg.Duration > cfg.Interval {
+		return nil, fmt.Errorf("agent duration %s exceeds interval %s", cfg.Duration, cfg.Interval)
+	}
+	if cfg.Sink == nil {
+		cfg.Sink = DirSink{Dir: "."}
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(err error) {
+			defaultLogger.Error("goprof: agent capture failed", "agent", cfg.Name, "err", err)
+		}
+	}
+	if _, ok := cfg.Sink.(Deleter); !ok && (cfg.KeepLast > 0 || cfg.MaxAge > 0) {
+		return nil, ErrNoDeleter
+	}
+	recips, err := parseRecipients(cfg.Recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Agent{cfg: cfg, sched: sched, recips: recips, cancel: cancel, done: make(chan struct{})}
+	go a.loop(ctx)
+	return a, nil
+}
+
+// Stop ends the agent, abandoning a capture in progress.
+func (a *Agent) Stop() {
+	a.once.Do(func() {
+		a.cancel()
+		<-a.done
+	})
+}
+
+func (a *Agent) loop(ctx context.Context) {
+	defer close(a.done)
+	if a.sched != nil {
+		a.scheduled(ctx)
+		return
+	}
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		a.captureOrReport(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scheduled captures at every time a.sched matches.
+func (a *Agent) scheduled(ctx context.Context) {
+	for {
+		next := a.sched.next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		a.captureOrReport(ctx)
+	}
+}
+
+func (a *Agent) captureOrReport(ctx context.Context) {
+	if err := a.capture(ctx); err != nil && ctx.Err() == nil {
+		recordError(err)
+		a.cfg.OnError(err)
+	}
+}
+
+func (a *Agent) capture(ctx context.Context) error {
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s", a.cfg.Name, start.UTC().Format("20060102T150405Z"))
+
+	var cpu, heap bytes.Buffer
+	cpuStart, _ := processCPU()
+	if ok, err := takeProfilers(&cpu, nil); !ok {
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		// a session has the profiler; try again next time
+		return nil
+	}
+	timer := time.NewTimer(a.cfg.Duration)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+		releaseProfilers(false)
+		return ctx.Err()
+	}
+	releaseProfilers(false)
+	end := time.Now()
+	cpuEnd, _ := processCPU()
+	if err := writeHeapProfile(&heap); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	m := newManifest(name, start, end, nil)
+	files := []memFile{
+		newMemFile(name, "cpu", cpu.Bytes()),
+		newMemFile(name, "heap", heap.Bytes()),
+	}
+	if err := putBundle(ctx, a.cfg.Sink, m, files, a.recips); err != nil {
+		return err
+	}
+	stats.agentCaptures.Add(1)
+	a.captures = append(a.captures, m)
+	var history error
+	if a.cfg.HistoryDir != "" {
+		history = a.appendHistory(m, cpuEnd-cpuStart)
+	}
+	return errors.Join(
+		history,
+		notify(ctx, a.cfg.Notifiers, newNotification("agent", m, false)),
+		a.prune(ctx),
+	)
+}
+
+func (a *Agent) expired(m *Manifest, i int) bool {
+	if a.cfg.KeepLast > 0 && len(a.captures)-i > a.cfg.KeepLast {
+		return true
+	}
+	return a.cfg.MaxAge > 0 && time.Since(m.End) > a.cfg.MaxAge
+}
+
+func (a *Agent) prune(ctx context.Context) error {
+	d, ok := a.cfg.Sink.(Deleter)
+	if !ok {
+		return nil
+	}
+	var kept []*Manifest
+	var errs []error
+	for i, m := range a.captures {
+		if !a.expired(m, i) {
+			kept = append(kept, m)
+			continue
+		}
+		failed := false
+		for _, art := range append(m.Artifacts, Artifact{Type: "manifest", Path: manifestName(m.Name)}) {
+			if err := d.Delete(ctx, m, art); err != nil {
+				errs = append(errs, err)
+				failed = true
+			}
+		}
+		if failed {
+			// keep it to try again on the next prune
+			kept = append(kept, m)
+		}
+	}
+	a.captures = kept
+	return errors.Join(errs...)
+}
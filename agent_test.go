@@ -0,0 +1,88 @@
+package goprof
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingSink keeps what it is given and fails deletes while failDelete is set.
+type failingSink struct {
+	mu         sync.Mutex
+	puts       int
+	failDelete bool
+}
+
+func (s *failingSink) Put(ctx context.Context, m *Manifest, a Artifact, r io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.puts++
+	return nil
+}
+
+func (s *failingSink) Delete(ctx context.Context, m *Manifest, a Artifact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failDelete {
+		return errors.New("delete failed")
+	}
+	return nil
+}
+
+func TestAgentSkipsWhileSessionRuns(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := Start("A", WithProfiles("cpu"), WithQuiet()); err != nil {
+		t.Fatal(err)
+	}
+	sink := &failingSink{}
+	var errs []error
+	var mu sync.Mutex
+	a, err := StartAgent(AgentConfig{
+		Interval: 20 * time.Millisecond,
+		Duration: 10 * time.Millisecond,
+		Sink:     sink,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	a.Stop()
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) > 0 {
+		t.Errorf("OnError called while the session had the profiler: %v", errs)
+	}
+	if sink.puts > 0 {
+		t.Errorf("%d artifacts captured while the session had the profiler", sink.puts)
+	}
+}
+
+func TestAgentPruneKeepsFailedDeletes(t *testing.T) {
+	sink := &failingSink{failDelete: true}
+	a := &Agent{cfg: AgentConfig{Sink: sink, KeepLast: 1}}
+	for _, name := range []string{"a", "b"} {
+		a.captures = append(a.captures, newManifest(name, time.Now(), time.Now(), nil))
+	}
+	if err := a.prune(context.Background()); err == nil {
+		t.Error("prune: no error for the failed delete")
+	}
+	if len(a.captures) != 2 {
+		t.Fatalf("%d captures kept after a failed delete, want 2", len(a.captures))
+	}
+	sink.failDelete = false
+	if err := a.prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.captures) != 1 || a.captures[0].Name != "b" {
+		t.Errorf("captures after the retry: %v", a.captures)
+	}
+}
@@ -0,0 +1,78 @@
+package goprof
+
+import (
+	"runtime"
+	"sync"
+)
+
+// AllocStats accumulates the allocations of a named operation.
+type AllocStats struct {
+	Ops     uint64
+	Bytes   uint64
+	Objects uint64
+}
+
+func (a AllocStats) BytesPerOp() float64 {
+	if a.Ops == 0 {
+		return 0
+	}
+	return float64(a.Bytes) / float64(a.Ops)
+}
+
+func (a AllocStats) AllocsPerOp() float64 {
+	if a.Ops == 0 {
+		return 0
+	}
+	return float64(a.Objects) / float64(a.Ops)
+}
+
+var (
+	allocMu sync.Mutex
+	allocs  = map[string]AllocStats{}
+)
+
+func recordAllocs(name string, before, after *runtime.MemStats) {
+	allocMu.Lock()
+	defer allocMu.Unlock()
+	a := allocs[name]
+	a.Ops++
+	a.Bytes += after.TotalAlloc - before.TotalAlloc
+	a.Objects += after.Mallocs - before.Mallocs
+	allocs[name] = a
+}
+
+// Measure runs f and adds its allocations to the stats kept for name.
+// It does not need an active session.
+//
+// The counts are exact but come from runtime.ReadMemStats, which briefly
+// stops the world; measure operations, not tight loops.
+// Allocations made by other goroutines while f runs are included.
+func Measure(name string, f func()) {
+	if buildDisabled {
+		f()
+		return
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	recordAllocs(name, &before, &after)
+}
+
+// Allocs returns the stats recorded for name so far.
+func Allocs(name string) AllocStats {
+	allocMu.Lock()
+	defer allocMu.Unlock()
+	return allocs[name]
+}
+
+// AllAllocs returns a copy of the stats of every named operation.
+func AllAllocs() map[string]AllocStats {
+	allocMu.Lock()
+	defer allocMu.Unlock()
+	m := make(map[string]AllocStats, len(allocs))
+	for k, v := range allocs {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,127 @@
+package goprof
+
+import (
+	"io"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// These live in the analysis package so that tooling can read bundles
+// without importing the collection side of goprof.
+type (
+	Artifact  = analysis.Artifact
+	Manifest  = analysis.Manifest
+	RunReport = analysis.RunReport
+	Format    = analysis.Format
+	Locale    = analysis.Locale
+	Budget    = analysis.Budget
+	MemDelta  = analysis.MemDelta
+
+	GoroutineDiff = analysis.GoroutineDiff
+	JointReport   = analysis.JointReport
+	FuncStat      = analysis.FuncStat
+	DiffReport    = analysis.DiffReport
+	Symbolizer    = analysis.Symbolizer
+	RuntimeMode   = analysis.RuntimeMode
+	HTMLReport    = analysis.HTMLReport
+	ReportData    = analysis.ReportData
+	GrowthReport  = analysis.GrowthReport
+	NestedRun     = analysis.NestedRun
+	Gap           = analysis.Gap
+
+	Thresholds       = analysis.Thresholds
+	RegressionReport = analysis.RegressionReport
+	RegressionCheck  = analysis.RegressionCheck
+	LineReport       = analysis.LineReport
+	LabelStat        = analysis.LabelStat
+	HistoryEntry     = analysis.HistoryEntry
+	HistoryReport    = analysis.HistoryReport
+)
+
+var (
+	LocaleEN = analysis.LocaleEN
+	LocaleDE = analysis.LocaleDE
+	LocaleFR = analysis.LocaleFR
+	LocaleCH = analysis.LocaleCH
+)
+
+const (
+	RuntimeKeep     = analysis.RuntimeKeep
+	RuntimeCollapse = analysis.RuntimeCollapse
+	RuntimeDrop     = analysis.RuntimeDrop
+)
+
+var ErrRunNotFound = analysis.ErrRunNotFound
+
+// ReadManifest reads a manifest written by Stop.
+func ReadManifest(path string) (*Manifest, error) {
+	return analysis.ReadManifest(path)
+}
+
+// LoadRun collects all manifests in dir that belong to runID.
+func LoadRun(dir, runID string) (*RunReport, error) {
+	return analysis.LoadRun(dir, runID)
+}
+
+// Import wraps externally collected profiles into a bundle in dir,
+// see analysis.Import.
+func Import(dir string, files ...string) (*Manifest, error) {
+	return analysis.Import(dir, files...)
+}
+
+// DiffGoroutines compares the goroutine dumps of two bundles,
+// see analysis.DiffGoroutines.
+func DiffGoroutines(basePath, curPath string) (*GoroutineDiff, error) {
+	return analysis.DiffGoroutines(basePath, curPath)
+}
+
+// Diff compares two CPU or heap profiles per function, see analysis.Diff.
+func Diff(baselinePath, currentPath string) (DiffReport, error) {
+	return analysis.Diff(baselinePath, currentPath)
+}
+
+// WriteHTML renders a bundle as one self-contained page,
+// see analysis.WriteHTML.
+func WriteHTML(w io.Writer, m *Manifest) error {
+	return analysis.WriteHTML(w, m)
+}
+
+// SetSymbolizer symbolizes profiles read for reports, see
+// analysis.SetSymbolizer.
+func SetSymbolizer(s Symbolizer) {
+	analysis.SetSymbolizer(s)
+}
+
+// Combine aligns the bundles of processes that ran side by side,
+// see analysis.Combine.
+func Combine(step time.Duration, paths ...string) (*JointReport, error) {
+	return analysis.Combine(step, paths...)
+}
+
+// HeapGrowth follows the in-use heap per function across the snapshots
+// of a bundle written with WithHeapSnapshots, see analysis.HeapGrowth.
+func HeapGrowth(path string) (*GrowthReport, error) {
+	m, err := analysis.OpenBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	return analysis.HeapGrowth(m)
+}
+
+// CheckRegression compares a bundle against a baseline, for gating CI on
+// performance, see analysis.CheckRegression.
+func CheckRegression(baselineDir, currentDir string, t Thresholds) (*RegressionReport, error) {
+	return analysis.CheckRegression(baselineDir, currentDir, t)
+}
+
+// Merge adds up several pprof profiles into one, see analysis.Merge.
+func Merge(out string, inputs ...string) error {
+	return analysis.Merge(out, inputs...)
+}
+
+// Annotate lists the hottest lines of the hottest functions of a profile,
+// see analysis.Annotate.
+func Annotate(path string, funcs, lines int) (*LineReport, error) {
+	return analysis.Annotate(path, funcs, lines)
+}
@@ -0,0 +1,58 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Budget holds soft limits past which artifacts tend to be impractical to
+// analyze. Exceeding one produces a warning, never an error.
+type Budget struct {
+	// Duration is the longest a session should run; 0 means no limit.
+	Duration time.Duration
+	// Sizes maps an artifact type to its largest reasonable size in bytes.
+	Sizes map[string]int64
+}
+
+// DefaultBudget applies to sessions that do not set their own.
+var DefaultBudget = Budget{
+	Duration: 10 * time.Minute,
+	Sizes:    map[string]int64{"trace": 200 << 20},
+}
+
+// Check returns a warning for every limit m exceeds.
+func (b Budget) Check(m *Manifest) []string {
+	var warnings []string
+	if b.Duration > 0 && m.Duration > b.Duration {
+		warnings = append(warnings, fmt.Sprintf("session ran %s, over the %s budget; profiles this long are hard to read", m.Duration.Truncate(time.Millisecond), b.Duration))
+	}
+	types := make([]string, 0, len(b.Sizes))
+	for typ := range b.Sizes {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	for _, typ := range types {
+		limit := b.Sizes[typ]
+		for _, a := range m.Artifacts {
+			if a.Type == typ && limit > 0 && a.Size > limit {
+				warnings = append(warnings, fmt.Sprintf("%s is %s, over the %s budget for %s artifacts", a.Path, FormatBytes(a.Size), FormatBytes(limit), typ))
+			}
+		}
+	}
+	return warnings
+}
+
+// FormatBytes renders n with a binary unit, e.g. 1.5 MiB.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,42 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// CPULimits records the CPUs a session could use and, on Linux, the cgroup
+// quota with how often the quota throttled the process during the session.
+type CPULimits struct {
+	GOMAXPROCS int `json:"gomaxprocs"`
+	NumCPU     int `json:"num_cpu"`
+	// Quota is the number of CPUs the cgroup allows; 0 means no quota.
+	Quota float64 `json:"quota,omitempty"`
+	// Periods and Throttled count enforcement periods during the session
+	// and the ones in which the process ran out of quota.
+	Periods       uint64        `json:"periods,omitempty"`
+	Throttled     uint64        `json:"throttled,omitempty"`
+	ThrottledTime time.Duration `json:"throttled_time,omitempty"`
+}
+
+// CheckCPU returns a finding when GOMAXPROCS is far above the cgroup quota.
+// The runtime then schedules more threads than the quota can run, which
+// shows up as throttling: whole stalls at the end of each period.
+func CheckCPU(m *Manifest) []string {
+	c := m.CPU
+	if c == nil || c.Quota <= 0 || float64(c.GOMAXPROCS) < 2*c.Quota {
+		return nil
+	}
+	suggest := max(1, int(math.Floor(c.Quota)))
+	impact := "no throttling was observed during the session"
+	if c.Throttled > 0 {
+		impact = fmt.Sprintf("the process was throttled in %d of %d periods (%s stalled in total) during the session",
+			c.Throttled, c.Periods, c.ThrottledTime.Truncate(time.Millisecond))
+		if m.Duration > 0 {
+			impact += fmt.Sprintf(", %.1f%% of its wall time", 100*float64(c.ThrottledTime)/float64(m.Duration))
+		}
+	}
+	return []string{fmt.Sprintf("GOMAXPROCS is %d but the cgroup quota allows %.1f CPUs; %s. Set GOMAXPROCS=%d to match the quota",
+		c.GOMAXPROCS, c.Quota, impact, suggest)}
+}
@@ -0,0 +1,153 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// FuncDiff is the change of one function between two profiles.
+type FuncDiff struct {
+	Name     string `json:"name"`
+	BaseFlat int64  `json:"base_flat"`
+	CurFlat  int64  `json:"cur_flat"`
+	BaseCum  int64  `json:"base_cum"`
+	CurCum   int64  `json:"cur_cum"`
+}
+
+func (d FuncDiff) Delta() int64    { return d.CurFlat - d.BaseFlat }
+func (d FuncDiff) CumDelta() int64 { return d.CurCum - d.BaseCum }
+
+// DiffReport compares the functions of two profiles of the same kind.
+type DiffReport struct {
+	SampleType string     `json:"sample_type"`
+	Unit       string     `json:"unit"`
+	BaseTotal  int64      `json:"base_total"`
+	CurTotal   int64      `json:"cur_total"`
+	Funcs      []FuncDiff `json:"funcs"` // biggest regression first
+}
+
+// Diff compares two CPU or heap profiles by flat weight per function.
+// Heap profiles are compared by allocated space.
+func Diff(baselinePath, currentPath string) (DiffReport, error) {
+	base, err := ReadProfile(baselinePath)
+	if err != nil {
+		return DiffReport{}, err
+	}
+	cur, err := ReadProfile(currentPath)
+	if err != nil {
+		return DiffReport{}, err
+	}
+	if len(base.SampleType) == 0 {
+		return DiffReport{}, fmt.Errorf("%s: profile has no sample types", baselinePath)
+	}
+	st := base.SampleType[valueIndex(base, "alloc_space")]
+	found := false
+	for _, t := range cur.SampleType {
+		found = found || t.Type == st.Type
+	}
+	if !found {
+		return DiffReport{}, fmt.Errorf("%s: no %s samples to compare with %s", currentPath, st.Type, baselinePath)
+	}
+
+	r := DiffReport{SampleType: st.Type, Unit: st.Unit}
+	funcs := map[string]*FuncDiff{}
+	fn := func(name string) *FuncDiff {
+		if funcs[name] == nil {
+			funcs[name] = &FuncDiff{Name: name}
+		}
+		return funcs[name]
+	}
+	for _, s := range Top(base, st.Type, 0) {
+		d := fn(s.Name)
+		d.BaseFlat, d.BaseCum = s.Flat, s.Cum
+		r.BaseTotal += s.Flat
+	}
+	for _, s := range Top(cur, st.Type, 0) {
+		d := fn(s.Name)
+		d.CurFlat, d.CurCum = s.Flat, s.Cum
+		r.CurTotal += s.Flat
+	}
+	for _, d := range funcs {
+		r.Funcs = append(r.Funcs, *d)
+	}
+	sort.Slice(r.Funcs, func(i, j int) bool {
+		a, b := r.Funcs[i], r.Funcs[j]
+		if a.Delta() != b.Delta() {
+			return a.Delta() > b.Delta()
+		}
+		if a.CumDelta() != b.CumDelta() {
+			return a.CumDelta() > b.CumDelta()
+		}
+		return a.Name < b.Name
+	})
+	return r, nil
+}
+
+// Regressions returns up to n functions that got heavier, worst first.
+func (r DiffReport) Regressions(n int) []FuncDiff {
+	var out []FuncDiff
+	for _, d := range r.Funcs {
+		if d.Delta() <= 0 || len(out) == n {
+			break
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// Improvements returns up to n functions that got lighter, best first.
+func (r DiffReport) Improvements(n int) []FuncDiff {
+	var out []FuncDiff
+	for i := len(r.Funcs) - 1; i >= 0; i-- {
+		d := r.Funcs[i]
+		if d.Delta() >= 0 || len(out) == n {
+			break
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// FormatValue renders a sample value in its unit.
+func FormatValue(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).String()
+	case "bytes":
+		if v < 0 {
+			return "-" + FormatBytes(-v)
+		}
+		return FormatBytes(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// WriteText lists the ten biggest regressions and improvements.
+func (r DiffReport) WriteText(w io.Writer) error {
+	v := func(n int64) string { return FormatValue(n, r.Unit) }
+	fmt.Fprintf(w, "%s: %s -> %s\n", r.SampleType, v(r.BaseTotal), v(r.CurTotal))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	section := func(title string, ds []FuncDiff) {
+		if len(ds) == 0 {
+			return
+		}
+		fmt.Fprintln(tw, title)
+		fmt.Fprintln(tw, "base\tcurrent\tdelta\tcum delta\t\t")
+		for _, d := range ds {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\t%s\n", v(d.BaseFlat), v(d.CurFlat), sign(d.Delta())+v(d.Delta()), sign(d.CumDelta())+v(d.CumDelta()), d.Name)
+		}
+	}
+	section("regressions", r.Regressions(10))
+	section("improvements", r.Improvements(10))
+	return tw.Flush()
+}
+
+func sign(n int64) string {
+	if n > 0 {
+		return "+"
+	}
+	return ""
+}
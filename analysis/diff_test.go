@@ -0,0 +1,125 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// testProfile builds a profile of the sample types types, "type/unit",
+// with one sample per stack, "leaf;caller;...", of the given values.
+func testProfile(types []string, stacks map[string][]int64) *profile.Profile {
+	p := &profile.Profile{TimeNanos: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(), DurationNanos: int64(time.Second)}
+	for _, t := range types {
+		typ, unit, _ := strings.Cut(t, "/")
+		p.SampleType = append(p.SampleType, &profile.ValueType{Type: typ, Unit: unit})
+	}
+	locs := map[string]*profile.Location{}
+	for stack, values := range stacks {
+		s := &profile.Sample{Value: values}
+		for _, name := range strings.Split(stack, ";") {
+			if locs[name] == nil {
+				fn := &profile.Function{ID: uint64(len(p.Function) + 1), Name: name, SystemName: name}
+				p.Function = append(p.Function, fn)
+				locs[name] = &profile.Location{ID: uint64(len(p.Location) + 1), Line: []profile.Line{{Function: fn}}}
+				p.Location = append(p.Location, locs[name])
+			}
+			s.Location = append(s.Location, locs[name])
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	return p
+}
+
+// writeProfile writes p to the file name in a temporary directory and
+// returns its path.
+func writeProfile(t *testing.T, p *profile.Profile, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := p.WriteUncompressed(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var cpuTypes = []string{"samples/count", "cpu/nanoseconds"}
+
+func TestDiff(t *testing.T) {
+	base := writeProfile(t, testProfile(cpuTypes, map[string][]int64{
+		"parse;main":  {1, 100},
+		"encode;main": {1, 300},
+		"gc":          {1, 50},
+	}), "base.pprof")
+	cur := writeProfile(t, testProfile(cpuTypes, map[string][]int64{
+		"parse;main":  {1, 400},
+		"encode;main": {1, 100},
+		"log;main":    {1, 20},
+	}), "cur.pprof")
+
+	r, err := Diff(base, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SampleType != "cpu" || r.Unit != "nanoseconds" || r.BaseTotal != 450 || r.CurTotal != 520 {
+		t.Errorf("Diff: %s in %s, %d -> %d", r.SampleType, r.Unit, r.BaseTotal, r.CurTotal)
+	}
+	// main has no flat weight either way; its cumulative growth breaks the tie
+	want := []FuncDiff{
+		{Name: "parse", BaseFlat: 100, CurFlat: 400, BaseCum: 100, CurCum: 400},
+		{Name: "log", CurFlat: 20, CurCum: 20},
+		{Name: "main", BaseCum: 400, CurCum: 520},
+		{Name: "gc", BaseFlat: 50, BaseCum: 50},
+		{Name: "encode", BaseFlat: 300, CurFlat: 100, BaseCum: 300, CurCum: 100},
+	}
+	if len(r.Funcs) != len(want) {
+		t.Fatalf("Funcs: %+v, want %+v", r.Funcs, want)
+	}
+	for i, d := range r.Funcs {
+		if d != want[i] {
+			t.Errorf("Funcs[%d] = %+v, want %+v", i, d, want[i])
+		}
+	}
+	if got := r.Regressions(1); len(got) != 1 || got[0].Name != "parse" {
+		t.Errorf("Regressions(1): %+v", got)
+	}
+	if got := r.Improvements(10); len(got) != 2 || got[0].Name != "encode" || got[1].Name != "gc" {
+		t.Errorf("Improvements(10): %+v", got)
+	}
+}
+
+func TestDiffHeapBySpace(t *testing.T) {
+	heap := []string{"alloc_objects/count", "alloc_space/bytes", "inuse_objects/count", "inuse_space/bytes"}
+	base := writeProfile(t, testProfile(heap, map[string][]int64{"grow": {1, 1024, 1, 1024}}), "base.pprof")
+	cur := writeProfile(t, testProfile(heap, map[string][]int64{"grow": {2, 4096, 0, 0}}), "cur.pprof")
+	r, err := Diff(base, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SampleType != "alloc_space" || r.Unit != "bytes" || len(r.Funcs) != 1 || r.Funcs[0].Delta() != 3072 {
+		t.Errorf("Diff: %s in %s, %+v", r.SampleType, r.Unit, r.Funcs)
+	}
+}
+
+func TestDiffMismatchedTypes(t *testing.T) {
+	cpu := writeProfile(t, testProfile(cpuTypes, map[string][]int64{"f": {1, 10}}), "cpu.pprof")
+	heap := writeProfile(t, testProfile([]string{"alloc_objects/count", "alloc_space/bytes"}, map[string][]int64{"f": {1, 10}}), "heap.pprof")
+	empty := writeProfile(t, &profile.Profile{}, "empty.pprof")
+	for _, tt := range []struct{ base, cur, want string }{
+		{cpu, heap, "no cpu samples"},
+		{heap, cpu, "no alloc_space samples"},
+		{empty, cpu, "no sample types"},
+	} {
+		if _, err := Diff(tt.base, tt.cur); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Diff(%s, %s): %v, want %q", filepath.Base(tt.base), filepath.Base(tt.cur), err, tt.want)
+		}
+	}
+}
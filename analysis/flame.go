@@ -0,0 +1,162 @@
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// FlameNode is one frame of a flame graph; Value includes the children.
+type FlameNode struct {
+	Name     string
+	Value    int64
+	Children []*FlameNode // heaviest first
+}
+
+// FlameGraph merges the stacks of prof into a tree rooted at "all".
+// sampleType selects the value as for Top.
+func FlameGraph(prof *profile.Profile, sampleType string) *FlameNode {
+	root := &FlameNode{Name: "all"}
+	if len(prof.SampleType) == 0 {
+		return root
+	}
+	idx := valueIndex(prof, sampleType)
+	index := map[*FlameNode]map[string]*FlameNode{}
+	child := func(n *FlameNode, name string) *FlameNode {
+		if index[n] == nil {
+			index[n] = map[string]*FlameNode{}
+		}
+		c := index[n][name]
+		if c == nil {
+			c = &FlameNode{Name: name}
+			index[n][name] = c
+			n.Children = append(n.Children, c)
+		}
+		return c
+	}
+	for _, s := range prof.Sample {
+		v := s.Value[idx]
+		if v == 0 {
+			continue
+		}
+		n := root
+		n.Value += v
+		// locations are leaf first, and so are the inlined lines of each
+		for i := len(s.Location) - 1; i >= 0; i-- {
+			lines := s.Location[i].Line
+			for j := len(lines) - 1; j >= 0; j-- {
+				n = child(n, functionName(lines[j]))
+				n.Value += v
+			}
+		}
+	}
+	root.sort()
+	return root
+}
+
+func (n *FlameNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		return a.Name < b.Name
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+func (n *FlameNode) depth() int {
+	d := 0
+	for _, c := range n.Children {
+		d = max(d, c.depth())
+	}
+	return d + 1
+}
+
+const (
+	flameWidth  = 1200.0
+	flameRow    = 16.0
+	flameMinPx  = 0.3 // narrower frames are left out
+	flameCharPx = 7.0
+)
+
+// WriteFlameSVG draws root as a standalone SVG flame graph, callers at the
+// bottom; unit is the profile's sample unit, e.g. "nanoseconds".
+func WriteFlameSVG(w io.Writer, root *FlameNode, unit string) error {
+	height := float64(root.depth()) * flameRow
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="monospace" font-size="12">`+"\n", flameWidth, height, flameWidth, height)
+	if root.Value > 0 {
+		scale := flameWidth / float64(root.Value)
+		var draw func(n *FlameNode, x float64, depth int)
+		draw = func(n *FlameNode, x float64, depth int) {
+			width := float64(n.Value) * scale
+			if width < flameMinPx {
+				return
+			}
+			y := height - float64(depth+1)*flameRow
+			name := html.EscapeString(n.Name)
+			fmt.Fprintf(&b, `<g><title>%s (%s, %.2f%%)</title><rect x="%.2f" y="%.0f" width="%.2f" height="%.0f" fill="%s" stroke="white" stroke-width="0.5"/>`,
+				name, FormatValue(n.Value, unit), 100*float64(n.Value)/float64(root.Value), x, y, width, flameRow, flameColor(n.Name))
+			if chars := int((width - 6) / flameCharPx); chars >= 3 {
+				// characters, not bytes, so no rune is cut in two
+				label := []rune(n.Name)
+				if len(label) > chars {
+					label = append(label[:chars-2], '.', '.')
+				}
+				fmt.Fprintf(&b, `<text x="%.2f" y="%.0f">%s</text>`, x+3, y+12, html.EscapeString(string(label)))
+			}
+			b.WriteString("</g>\n")
+			for _, c := range n.Children {
+				draw(c, x, depth+1)
+				x += float64(c.Value) * scale
+			}
+		}
+		draw(root, 0, 0)
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteFolded writes root in Brendan Gregg's folded stack format, one
+// "caller;...;leaf value" line per stack, as read by flamegraph.pl and
+// speedscope.
+func WriteFolded(w io.Writer, root *FlameNode) error {
+	bw := bufio.NewWriter(w)
+	var walk func(n *FlameNode, stack string)
+	walk = func(n *FlameNode, stack string) {
+		self := n.Value
+		for _, c := range n.Children {
+			self -= c.Value
+		}
+		if self > 0 && stack != "" {
+			fmt.Fprintf(bw, "%s %d\n", stack, self)
+		}
+		for _, c := range n.Children {
+			name := strings.ReplaceAll(c.Name, ";", ":")
+			if stack != "" {
+				name = stack + ";" + name
+			}
+			walk(c, name)
+		}
+	}
+	walk(root, "")
+	return bw.Flush()
+}
+
+// flameColor picks a stable warm color per function.
+func flameColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, 80+(v>>8)%130, 40+(v>>16)%50)
+}
@@ -0,0 +1,108 @@
+package analysis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale describes how numbers are written.
+type Locale struct {
+	Decimal   string
+	Thousands string
+}
+
+var (
+	LocaleEN = Locale{Decimal: ".", Thousands: ","}
+	LocaleDE = Locale{Decimal: ",", Thousands: "."}
+	LocaleFR = Locale{Decimal: ",", Thousands: " "}
+	LocaleCH = Locale{Decimal: ".", Thousands: "'"}
+)
+
+// Format controls how reports render durations, timestamps and numbers.
+// The zero value prints durations as time.Duration does, timestamps as
+// RFC 3339 in the zone they were recorded in, and numbers without grouping.
+type Format struct {
+	// Unit fixes the unit durations are printed in, e.g. time.Millisecond.
+	Unit time.Duration
+	// Location converts timestamps to a time zone, e.g. time.UTC.
+	Location *time.Location
+	// TimeLayout replaces time.RFC3339.
+	TimeLayout string
+	// Locale selects the decimal and thousands separators.
+	Locale Locale
+}
+
+var unitNames = map[time.Duration]string{
+	time.Nanosecond:  "ns",
+	time.Microsecond: "µs",
+	time.Millisecond: "ms",
+	time.Second:      "s",
+	time.Minute:      "m",
+	time.Hour:        "h",
+}
+
+func (f Format) Duration(d time.Duration) string {
+	name, ok := unitNames[f.Unit]
+	if !ok {
+		if f.Locale == (Locale{}) {
+			return d.String()
+		}
+		return f.localize(d.String())
+	}
+	prec := 3
+	if f.Unit == time.Nanosecond {
+		prec = 0
+	}
+	return f.Float(float64(d)/float64(f.Unit), prec) + " " + name
+}
+
+func (f Format) Time(t time.Time) string {
+	if f.Location != nil {
+		t = t.In(f.Location)
+	}
+	layout := f.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return t.Format(layout)
+}
+
+func (f Format) Int(n int64) string {
+	return f.Float(float64(n), 0)
+}
+
+func (f Format) Float(x float64, prec int) string {
+	s := strconv.FormatFloat(math.Abs(x), 'f', prec, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	if f.Locale.Thousands != "" {
+		var b strings.Builder
+		for i, c := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				b.WriteString(f.Locale.Thousands)
+			}
+			b.WriteRune(c)
+		}
+		intPart = b.String()
+	}
+	if math.Signbit(x) && x != 0 {
+		intPart = "-" + intPart
+	}
+	if frac == "" {
+		return intPart
+	}
+	dec := f.Locale.Decimal
+	if dec == "" {
+		dec = "."
+	}
+	return intPart + dec + frac
+}
+
+// localize swaps the decimal point of an already formatted value.
+func (f Format) localize(s string) string {
+	if f.Locale.Decimal == "" || f.Locale.Decimal == "." {
+		return s
+	}
+	return strings.ReplaceAll(s, ".", f.Locale.Decimal)
+}
@@ -0,0 +1,59 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// GCSummary is the garbage collection during a session, to tell whether GC
+// caused a latency spike.
+type GCSummary struct {
+	Cycles uint32 `json:"cycles"`
+	// Forced are the cycles started by runtime.GC or debug.FreeOSMemory.
+	Forced uint32 `json:"forced,omitempty"`
+	// Total is the time the world was stopped for GC.
+	Total time.Duration `json:"total"`
+	// Max is the longest stop of a cycle, PauseP50 and PauseP99 estimate
+	// the median and 99th percentile of the single stops, a cycle stopping
+	// the world twice.
+	Max      time.Duration `json:"max"`
+	PauseP50 time.Duration `json:"pause_p50"`
+	PauseP99 time.Duration `json:"pause_p99"`
+	// Pauses counts the single stops by length.
+	Pauses []PauseBucket `json:"pauses,omitempty"`
+}
+
+// PauseBucket counts the GC pauses shorter than Below and at least as long
+// as the Below of the bucket before; the last bucket has no bound.
+type PauseBucket struct {
+	Below time.Duration `json:"below,omitempty"`
+	Count uint64        `json:"count"`
+}
+
+// WriteText writes the summary in two lines.
+func (g GCSummary) WriteText(w io.Writer) error {
+	forced := ""
+	if g.Forced > 0 {
+		forced = fmt.Sprintf(" (%d forced)", g.Forced)
+	}
+	fmt.Fprintf(w, "GC %d cycles%s, paused %s, max %s, pause p50 %s, p99 %s\n", g.Cycles, forced, g.Total, g.Max, g.PauseP50, g.PauseP99)
+	if len(g.Pauses) == 0 {
+		return nil
+	}
+	var parts []string
+	for i, b := range g.Pauses {
+		if b.Count == 0 {
+			continue
+		}
+		switch {
+		case b.Below > 0:
+			parts = append(parts, fmt.Sprintf("<%s: %d", b.Below, b.Count))
+		case i > 0:
+			parts = append(parts, fmt.Sprintf(">=%s: %d", g.Pauses[i-1].Below, b.Count))
+		}
+	}
+	_, err := fmt.Fprintf(w, "GC pauses %s\n", strings.Join(parts, ", "))
+	return err
+}
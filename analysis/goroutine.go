@@ -0,0 +1,256 @@
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Frame is one line of a goroutine stack.
+type Frame struct {
+	Func string `json:"func"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+func (f Frame) String() string {
+	if f.Func == "" {
+		return "(none)"
+	}
+	return fmt.Sprintf("%s %s:%d", f.Func, f.File, f.Line)
+}
+
+// Goroutine is one entry of a goroutine dump (debug=2).
+type Goroutine struct {
+	ID    int    `json:"id"`
+	State string `json:"state"`
+	// Wait is how long the goroutine has been blocked; the runtime only
+	// reports it after a minute.
+	Wait      time.Duration `json:"wait,omitempty"`
+	Stack     []Frame       `json:"stack"` // innermost first
+	CreatedBy Frame         `json:"created_by"`
+}
+
+// Entry is the function the goroutine was started with.
+func (g Goroutine) Entry() string {
+	if len(g.Stack) == 0 {
+		return ""
+	}
+	return g.Stack[len(g.Stack)-1].Func
+}
+
+// ParseGoroutines parses the output of
+// pprof.Lookup("goroutine").WriteTo(w, 2), as written by Stop.
+func ParseGoroutines(r io.Reader) ([]Goroutine, error) {
+	var gs []Goroutine
+	var cur *Goroutine
+	var pending *Frame // function line waiting for its file:line
+	created := false
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "goroutine "):
+			g, err := parseGoroutineHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			gs = append(gs, g)
+			cur, pending, created = &gs[len(gs)-1], nil, false
+		case cur == nil || line == "":
+		case strings.HasPrefix(line, "\t"):
+			if pending == nil {
+				continue
+			}
+			pending.File, pending.Line = parseFileLine(strings.TrimSpace(line))
+			if created {
+				cur.CreatedBy = *pending
+			} else {
+				cur.Stack = append(cur.Stack, *pending)
+			}
+			pending = nil
+		case strings.HasPrefix(line, "created by "):
+			fn := strings.TrimPrefix(line, "created by ")
+			if i := strings.Index(fn, " in goroutine "); i >= 0 {
+				fn = fn[:i]
+			}
+			created = true
+			pending = &Frame{Func: fn}
+		default:
+			fn := line
+			if i := strings.LastIndex(fn, "("); i > 0 {
+				fn = fn[:i]
+			}
+			pending = &Frame{Func: fn}
+		}
+	}
+	return gs, sc.Err()
+}
+
+// "goroutine 18 [chan receive, 3 minutes]:"
+func parseGoroutineHeader(line string) (Goroutine, error) {
+	var g Goroutine
+	rest := strings.TrimPrefix(line, "goroutine ")
+	id, rest, ok := strings.Cut(rest, " ")
+	if !ok {
+		return g, fmt.Errorf("malformed goroutine header %q", line)
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return g, fmt.Errorf("malformed goroutine header %q", line)
+	}
+	g.ID = n
+	rest = strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]:")
+	parts := strings.Split(rest, ", ")
+	g.State = parts[0]
+	for _, part := range parts[1:] {
+		if m, ok := strings.CutSuffix(part, " minutes"); ok {
+			if n, err := strconv.Atoi(m); err == nil {
+				g.Wait = time.Duration(n) * time.Minute
+			}
+		}
+	}
+	return g, nil
+}
+
+// "/src/main.go:15 +0x7d"
+func parseFileLine(s string) (string, int) {
+	if i := strings.LastIndex(s, " +0x"); i >= 0 {
+		s = s[:i]
+	}
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return s, 0
+	}
+	n, _ := strconv.Atoi(s[i+1:])
+	return s[:i], n
+}
+
+// GoroutineGroup counts the goroutines started from the same place.
+type GoroutineGroup struct {
+	CreatedBy Frame
+	Entry     string
+	Before    int
+	After     int
+	// MaxWait is the longest any goroutine of the group had been blocked
+	// in the later dump.
+	MaxWait time.Duration
+}
+
+func (g GoroutineGroup) Delta() int { return g.After - g.Before }
+
+// New reports a population that did not exist in the earlier dump.
+func (g GoroutineGroup) New() bool { return g.Before == 0 && g.After > 0 }
+
+// GoroutineDiff compares two goroutine dumps grouped by creation site.
+type GoroutineDiff struct {
+	Before int
+	After  int
+	Groups []GoroutineGroup // largest growth first
+}
+
+func readGoroutines(m *Manifest) ([]Goroutine, error) {
+	a, ok := m.Artifact("goroutines")
+	if !ok {
+		return nil, fmt.Errorf("%s: bundle has no goroutine dump", m.Name)
+	}
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseGoroutines(f)
+}
+
+// DiffGoroutines compares the goroutine dumps of two bundles, given as
+// manifest paths or bundle directories. Groups that grew, and especially
+// new groups whose goroutines sit blocked, are the usual sign of a leak.
+func DiffGoroutines(basePath, curPath string) (*GoroutineDiff, error) {
+	base, err := OpenBundle(basePath)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := OpenBundle(curPath)
+	if err != nil {
+		return nil, err
+	}
+	before, err := readGoroutines(base)
+	if err != nil {
+		return nil, err
+	}
+	after, err := readGoroutines(cur)
+	if err != nil {
+		return nil, err
+	}
+	return CompareGoroutines(before, after), nil
+}
+
+// CompareGoroutines groups two goroutine dumps by creation site.
+func CompareGoroutines(before, after []Goroutine) *GoroutineDiff {
+	type key struct {
+		site  Frame
+		entry string
+	}
+	groups := map[key]*GoroutineGroup{}
+	group := func(g Goroutine) *GoroutineGroup {
+		k := key{g.CreatedBy, g.Entry()}
+		if groups[k] == nil {
+			groups[k] = &GoroutineGroup{CreatedBy: g.CreatedBy, Entry: g.Entry()}
+		}
+		return groups[k]
+	}
+	for _, g := range before {
+		group(g).Before++
+	}
+	for _, g := range after {
+		gg := group(g)
+		gg.After++
+		gg.MaxWait = max(gg.MaxWait, g.Wait)
+	}
+
+	d := &GoroutineDiff{Before: len(before), After: len(after)}
+	for _, g := range groups {
+		d.Groups = append(d.Groups, *g)
+	}
+	sort.Slice(d.Groups, func(i, j int) bool {
+		a, b := d.Groups[i], d.Groups[j]
+		if a.Delta() != b.Delta() {
+			return a.Delta() > b.Delta()
+		}
+		return a.CreatedBy.String() < b.CreatedBy.String()
+	})
+	return d
+}
+
+// WriteText lists the groups whose size changed.
+func (d *GoroutineDiff) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "goroutines: %d -> %d (%+d)\n", d.Before, d.After, d.After-d.Before)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "before\tafter\tdelta\tmax wait\t\tentry\tcreated by")
+	for _, g := range d.Groups {
+		if g.Delta() == 0 {
+			continue
+		}
+		var flags []string
+		if g.New() {
+			flags = append(flags, "NEW")
+		}
+		if g.MaxWait >= time.Minute {
+			flags = append(flags, "LONG-LIVED")
+		}
+		wait := "-"
+		if g.MaxWait > 0 {
+			wait = g.MaxWait.String()
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%+d\t%s\t%s\t%s\t%s\n", g.Before, g.After, g.Delta(), wait, strings.Join(flags, ","), g.Entry, g.CreatedBy)
+	}
+	return tw.Flush()
+}
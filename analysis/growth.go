@@ -0,0 +1,127 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// FuncGrowth follows the in-use heap allocated by one function across a
+// series of heap profiles.
+type FuncGrowth struct {
+	Name  string  `json:"name"`
+	InUse []int64 `json:"inuse"` // bytes, flat, one per snapshot
+}
+
+// Growth is the change from the first snapshot to the last.
+func (g FuncGrowth) Growth() int64 {
+	return g.InUse[len(g.InUse)-1] - g.InUse[0]
+}
+
+// Steady reports whether the function grew overall and never shrank
+// between two consecutive snapshots, the usual shape of a slow leak. Heap
+// profiles are sampled, so a leak can stand still for an interval.
+func (g FuncGrowth) Steady() bool {
+	if g.Growth() <= 0 {
+		return false
+	}
+	for i := 1; i < len(g.InUse); i++ {
+		if g.InUse[i] < g.InUse[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// GrowthReport compares a series of heap profiles of one process.
+type GrowthReport struct {
+	Times []time.Time  `json:"times"` // of the snapshots
+	Funcs []FuncGrowth `json:"funcs"` // biggest growth first
+}
+
+// HeapGrowth follows the in-use heap per function across the snapshots of
+// a bundle written with goprof.WithHeapSnapshots, ending with the heap
+// profile taken on Stop.
+func HeapGrowth(m *Manifest) (*GrowthReport, error) {
+	var paths []string
+	for _, a := range m.Artifacts {
+		if strings.HasPrefix(a.Type, "heap-") {
+			paths = append(paths, a.Path)
+		}
+	}
+	if a, ok := m.Artifact("heap"); ok {
+		paths = append(paths, a.Path)
+	}
+	if len(paths) < 2 {
+		return nil, fmt.Errorf("%s: bundle has %d heap profiles, need at least 2", m.Name, len(paths))
+	}
+	return CompareHeaps(paths...)
+}
+
+// CompareHeaps follows the in-use heap per function across heap profiles
+// given oldest first. The figures of each profile are as of the last GC
+// before it was taken.
+func CompareHeaps(paths ...string) (*GrowthReport, error) {
+	r := &GrowthReport{}
+	funcs := map[string]*FuncGrowth{}
+	for i, path := range paths {
+		prof, err := ReadProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(prof.SampleType) == 0 || prof.SampleType[valueIndex(prof, "inuse_space")].Type != "inuse_space" {
+			return nil, fmt.Errorf("%s: not a heap profile", path)
+		}
+		r.Times = append(r.Times, time.Unix(0, prof.TimeNanos))
+		for _, s := range Top(prof, "inuse_space", 0) {
+			if funcs[s.Name] == nil {
+				funcs[s.Name] = &FuncGrowth{Name: s.Name, InUse: make([]int64, len(paths))}
+			}
+			funcs[s.Name].InUse[i] = s.Flat
+		}
+	}
+	for _, g := range funcs {
+		r.Funcs = append(r.Funcs, *g)
+	}
+	sort.Slice(r.Funcs, func(i, j int) bool {
+		a, b := r.Funcs[i], r.Funcs[j]
+		if a.Growth() != b.Growth() {
+			return a.Growth() > b.Growth()
+		}
+		return a.Name < b.Name
+	})
+	return r, nil
+}
+
+// Growers returns up to n functions whose in-use heap grew, biggest first.
+func (r *GrowthReport) Growers(n int) []FuncGrowth {
+	var out []FuncGrowth
+	for _, g := range r.Funcs {
+		if g.Growth() <= 0 || len(out) == n {
+			break
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// WriteText lists the ten biggest growers; STEADY marks the ones that
+// never shrank.
+func (r *GrowthReport) WriteText(w io.Writer) error {
+	if len(r.Times) > 0 {
+		fmt.Fprintf(w, "%d heap snapshots over %s\n", len(r.Times), r.Times[len(r.Times)-1].Sub(r.Times[0]).Round(time.Millisecond))
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "first\tlast\tgrowth\t\t\t")
+	for _, g := range r.Growers(10) {
+		flag := ""
+		if g.Steady() {
+			flag = "STEADY"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t+%s\t%s\t\t%s\n", FormatBytes(g.InUse[0]), FormatBytes(g.InUse[len(g.InUse)-1]), FormatBytes(g.Growth()), flag, g.Name)
+	}
+	return tw.Flush()
+}
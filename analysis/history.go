@@ -0,0 +1,118 @@
+package analysis
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// HistoryEntry is one capture in a history file: a line of JSON.
+type HistoryEntry struct {
+	RunID    string        `json:"run_id,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// CPU is the CPU time of the process during the capture, when known.
+	CPU time.Duration `json:"cpu,omitempty"`
+	// Alloc is the bytes allocated during the capture, when known.
+	Alloc uint64 `json:"alloc,omitempty"`
+}
+
+// Percentiles summarize a series of durations.
+type Percentiles struct {
+	Min time.Duration `json:"min"`
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// HistoryReport is the series of captures of one name, for spotting drift
+// over days.
+type HistoryReport struct {
+	Entries  []HistoryEntry `json:"entries"` // oldest first
+	Duration Percentiles    `json:"duration"`
+	// CPU only counts the entries that know their CPU time.
+	CPU Percentiles `json:"cpu"`
+}
+
+// HistoryName is the file the history of a session name is kept in.
+func HistoryName(name string) string {
+	return name + ".history.jsonl"
+}
+
+// ReadHistory reads a history file goprof keeps.
+func ReadHistory(path string) (*HistoryReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := ParseHistory(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewHistoryReport(entries), nil
+}
+
+// ParseHistory reads the entries of a history file.
+func ParseHistory(r io.Reader) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e HistoryEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// NewHistoryReport computes the percentiles of entries.
+func NewHistoryReport(entries []HistoryEntry) *HistoryReport {
+	var durations, cpu []time.Duration
+	for _, e := range entries {
+		durations = append(durations, e.Duration)
+		if e.CPU > 0 {
+			cpu = append(cpu, e.CPU)
+		}
+	}
+	return &HistoryReport{
+		Entries:  entries,
+		Duration: percentiles(durations),
+		CPU:      percentiles(cpu),
+	}
+}
+
+func percentiles(d []time.Duration) Percentiles {
+	if len(d) == 0 {
+		return Percentiles{}
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	at := func(p float64) time.Duration {
+		return d[int(p*float64(len(d)-1)+0.5)]
+	}
+	return Percentiles{Min: d[0], P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: d[len(d)-1]}
+}
+
+// WriteText lists the percentiles and the entries.
+func (r *HistoryReport) WriteText(w io.Writer) error {
+	d := r.Duration
+	fmt.Fprintf(w, "%d captures, duration p50 %s, p90 %s, p99 %s (min %s, max %s)\n", len(r.Entries), d.P50, d.P90, d.P99, d.Min, d.Max)
+	if c := r.CPU; c.Max > 0 {
+		fmt.Fprintf(w, "cpu p50 %s, p90 %s, p99 %s (min %s, max %s)\n", c.P50, c.P90, c.P99, c.Min, c.Max)
+	}
+	for _, e := range r.Entries {
+		if _, err := fmt.Fprintf(w, "%s  %s  cpu %s  alloc %s  %s\n", e.Start.Local().Format(time.DateTime), e.Duration, e.CPU, FormatBytes(int64(e.Alloc)), e.RunID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"html/template"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// reportTemplate is the page WriteHTML renders. Every {{block}} in it can
+// be redefined through HTMLReport.Templates.
+var reportTemplate = template.Must(template.New("page").Funcs(Format{}.funcs()).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{block "title" .}}goprof: {{.Manifest.Name}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+</style>
+</head>
+<body>
+{{template "report" .}}
+</body>
+</html>
+{{define "report"}}<div class="goprof-report">
+<style>
+{{- block "style" .}}
+.goprof-report table { border-collapse: collapse; margin-bottom: 1.5em; }
+.goprof-report th, .goprof-report td { text-align: left; padding: 2px 12px 2px 0; }
+.goprof-report td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.goprof-report .warning { color: #a40; }
+.goprof-report svg text { pointer-events: none; }
+{{- end}}
+</style>
+{{block "header" .}}<h1>{{.Manifest.Name}}</h1>{{end}}
+{{block "metadata" .}}<table>
+<tr><th>run</th><td>{{.Manifest.RunID}}</td></tr>
+{{- if .Manifest.Host}}<tr><th>host</th><td>{{.Manifest.Host}} (pid {{.Manifest.PID}})</td></tr>{{end}}
+{{- if .Manifest.GoVersion}}<tr><th>go</th><td>{{.Manifest.GoVersion}}</td></tr>{{end}}
+<tr><th>start</th><td>{{time .Manifest.Start}}</td></tr>
+<tr><th>duration</th><td>{{duration (ms .Manifest.Duration)}}</td></tr>
+{{- with .Manifest.Memory}}
+<tr><th>memory</th><td>{{.}}</td></tr>
+{{- end}}
+{{- with .Manifest.Leaks}}
+<tr><th>leaks</th><td>{{len .}} goroutines still running</td></tr>
+{{- end}}
+</table>{{end}}
+{{block "warnings" .}}{{range .Manifest.Warnings}}<p class="warning">WARNING: {{.}}</p>
+{{end}}{{end}}
+{{block "artifacts" .}}<h2>Artifacts</h2>
+<table>
+{{- range .Manifest.Artifacts}}
+<tr><td>{{.Type}}</td><td>{{base .Path}}</td><td class="num">{{bytes .Size}}</td></tr>
+{{- end}}
+</table>{{end}}
+{{block "top" .}}{{if .Top}}<h2>Hottest functions</h2>
+<table>
+<tr><th>flat</th><th>flat%</th><th>cum</th><th>cum%</th><th></th></tr>
+{{- range .Top}}
+<tr><td class="num">{{value .Flat $.Unit}}</td><td class="num">{{pct .FlatPct}}</td><td class="num">{{value .Cum $.Unit}}</td><td class="num">{{pct .CumPct}}</td><td>{{.Name}}</td></tr>
+{{- end}}
+</table>{{end}}{{end}}
+{{block "flame" .}}{{if .Flame}}<h2>CPU flame graph</h2>
+{{.Flame}}{{end}}{{end}}
+{{block "footer" .}}{{end}}
+</div>
+{{end}}`))
+
+// WriteHTML renders a bundle as a single self-contained page: metadata,
+// summary, the hottest functions and a flame graph of the CPU profile.
+func WriteHTML(w io.Writer, m *Manifest) error {
+	return HTMLReport{}.Write(w, m)
+}
+
+// HTMLReport configures the page WriteHTML renders.
+type HTMLReport struct {
+	// Runtime is what the top table and flame graph do with
+	// runtime-internal stacks.
+	Runtime RuntimeMode
+	// Templates redefines parts of the report with html/template
+	// {{define}} actions, e.g. to brand it:
+	//
+	//	{{define "header"}}<h1>Checkout: {{.Manifest.Name}}</h1>{{end}}
+	//	{{define "footer"}}<a href="/runs">all runs</a>{{end}}
+	//
+	// The parts are "title", "style", "header", "metadata", "warnings",
+	// "artifacts", "top", "flame" and "footer", all executed with the
+	// ReportData. "report" is the embeddable part of the page and "page"
+	// the whole document.
+	Templates string
+	// FS is where the artifacts are read from, the OS file system if nil.
+	FS fs.FS
+	// Format renders the timestamps, durations, sizes and values of the
+	// report; templates get it as the functions "time", "duration",
+	// "bytes", "value", "pct" and "int".
+	Format Format
+}
+
+// value renders a sample value in its unit like FormatValue.
+func (f Format) value(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return f.Duration(time.Duration(v))
+	case "bytes":
+		return f.localize(FormatValue(v, unit))
+	}
+	return f.Int(v)
+}
+
+// funcs are the template functions of a report rendered with f.
+func (f Format) funcs() template.FuncMap {
+	return template.FuncMap{
+		"base":     filepath.Base,
+		"ms":       func(d time.Duration) time.Duration { return d.Round(time.Millisecond) },
+		"time":     f.Time,
+		"duration": f.Duration,
+		"int":      f.Int,
+		"bytes":    func(n int64) string { return f.localize(FormatBytes(n)) },
+		"value":    f.value,
+		"pct":      func(p float64) string { return f.Float(p, 1) + "%" },
+	}
+}
+
+// ReportData is what the report templates are executed with.
+type ReportData struct {
+	Manifest *Manifest
+	// Top are the hottest functions of the CPU profile, in Unit.
+	Top  []FuncStat
+	Unit string
+	// Flame is the CPU flame graph as inline SVG.
+	Flame template.HTML
+}
+
+// Data reads what the report shows about m.
+func (r HTMLReport) Data(m *Manifest) (ReportData, error) {
+	data := ReportData{Manifest: m}
+	a, ok := m.Artifact("cpu")
+	if !ok {
+		return data, nil
+	}
+	var prof *profile.Profile
+	var err error
+	if r.FS != nil {
+		prof, err = ReadProfileFS(r.FS, a.Path)
+	} else {
+		prof, err = ReadProfile(a.Path)
+	}
+	if err != nil {
+		return data, err
+	}
+	if len(prof.SampleType) == 0 {
+		return data, nil
+	}
+	prof = FilterRuntime(prof, r.Runtime)
+	data.Top = Top(prof, "", 10)
+	data.Unit = Unit(prof, "")
+	var svg strings.Builder
+	if err := WriteFlameSVG(&svg, FlameGraph(prof, ""), data.Unit); err != nil {
+		return data, err
+	}
+	// built from escaped names only
+	data.Flame = template.HTML(svg.String())
+	return data, nil
+}
+
+// Write renders m like WriteHTML.
+func (r HTMLReport) Write(w io.Writer, m *Manifest) error {
+	data, err := r.Data(m)
+	if err != nil {
+		return err
+	}
+	return r.execute(w, "page", data)
+}
+
+// RenderInto writes the report as a fragment for embedding in another
+// page: a <div class="goprof-report"> with styles scoped to it, without
+// <html>, <head> or <body>.
+func (r HTMLReport) RenderInto(w io.Writer, data ReportData) error {
+	return r.execute(w, "report", data)
+}
+
+func (r HTMLReport) execute(w io.Writer, name string, data ReportData) error {
+	// html/template cannot clone a template that has executed, so the
+	// shared one never is
+	t, err := reportTemplate.Clone()
+	if err != nil {
+		return err
+	}
+	t.Funcs(r.Format.funcs())
+	if r.Templates != "" {
+		if _, err := t.Parse(r.Templates); err != nil {
+			return err
+		}
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
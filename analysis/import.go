@@ -0,0 +1,159 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// traces start with a header like "go 1.23 trace\x00\x00\x00"
+func isTrace(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("go 1.")) && bytes.Contains(head, []byte(" trace\x00"))
+}
+
+// profileType guesses the kind of profile from its sample types.
+// Block and mutex profiles look the same, so the file name decides.
+func profileType(prof *profile.Profile, path string) string {
+	for _, st := range prof.SampleType {
+		switch st.Type {
+		case "cpu":
+			return "cpu"
+		case "inuse_space", "alloc_space":
+			return "heap"
+		case "goroutine":
+			return "goroutine"
+		case "threadcreate":
+			return "threadcreate"
+		case "wall":
+			return "wall"
+		case "delay":
+			if strings.Contains(filepath.Base(path), "mutex") {
+				return "mutex"
+			}
+			return "block"
+		}
+	}
+	return "pprof"
+}
+
+// Import turns profiles collected elsewhere (go test -cpuprofile,
+// net/http/pprof downloads, trace files) into a bundle: the files are copied
+// into dir under goprof's naming scheme and a manifest is written for them,
+// so they can be used with the rest of goprof's tooling.
+//
+// The bundle is named after dir. Its start and end come from the profiles
+// themselves when they record them.
+func Import(dir string, files ...string) (*Manifest, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("import: no files given")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(abs)
+
+	var start, end time.Time
+	var artifacts []Artifact
+	seen := map[string]bool{}
+	for _, path := range files {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		typ := "trace"
+		if !isTrace(b[:min(len(b), 64)]) {
+			prof, err := profile.Parse(bytes.NewReader(b))
+			if err != nil {
+				return nil, fmt.Errorf("import %s: not a pprof profile or execution trace: %w", path, err)
+			}
+			typ = profileType(prof, path)
+			if prof.TimeNanos > 0 {
+				t := time.Unix(0, prof.TimeNanos)
+				if start.IsZero() || t.Before(start) {
+					start = t
+				}
+				if t := t.Add(time.Duration(prof.DurationNanos)); t.After(end) {
+					end = t
+				}
+			}
+		}
+
+		dst := FileName(name, typ)
+		if seen[dst] {
+			dst = fmt.Sprintf("%s.%s", name, filepath.Base(path))
+		}
+		seen[dst] = true
+		if err := copyFile(filepath.Join(dir, dst), path); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, Artifact{Type: typ, Path: dst, Size: int64(len(b))})
+	}
+	if start.IsZero() {
+		if info, err := os.Stat(files[0]); err == nil {
+			start = info.ModTime()
+		}
+	}
+	if end.Before(start) {
+		end = start
+	}
+
+	m := &Manifest{
+		Name:      name,
+		Start:     start,
+		End:       end,
+		Duration:  end.Sub(start),
+		Artifacts: artifacts,
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestName(name)), b, 0o644); err != nil {
+		return nil, err
+	}
+	m.resolve(dir)
+	return m, nil
+}
+
+func copyFile(dst, src string) error {
+	if same(dst, src) {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func same(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
@@ -0,0 +1,209 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// JointReport lines up the bundles of processes that took part in the same
+// test, e.g. a load generator and the server it drives, on one time axis.
+// Alignment uses the wall clock of each process, so bundles from different
+// hosts are only as aligned as their clocks.
+type JointReport struct {
+	Bundles []Manifest // ordered by start time
+	Procs   []JointProcess
+	Step    time.Duration
+	Rows    []JointRow
+	Format  Format
+}
+
+// JointProcess is what one bundle contributes to a JointReport.
+type JointProcess struct {
+	Offset time.Duration // start relative to the earliest bundle
+	// CPU is the total time of the CPU profile, if the bundle has one.
+	CPU time.Duration
+}
+
+// Cores is the average number of cores the process kept busy.
+func (p JointProcess) Cores(d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(p.CPU) / float64(d)
+}
+
+// JointRow is one step of the shared timeline.
+type JointRow struct {
+	Offset time.Duration // from the earliest bundle start
+	// Cells has one entry per bundle, nil where the bundle recorded no
+	// metrics during the step.
+	Cells []*JointCell
+}
+
+// JointCell summarizes the metrics one process sampled during a step.
+type JointCell struct {
+	HeapBytes  uint64 // at the end of the step
+	Goroutines uint64 // at the end of the step
+	GCs        uint64 // cycles completed during the step
+	// SchedLatency99 is the worst p99 scheduler latency seen in the step.
+	SchedLatency99 time.Duration
+}
+
+// Combine reads bundles, given as manifest paths or bundle directories, and
+// aligns their metrics timelines (see goprof.WithMetrics) in steps of step.
+// A zero step splits the combined time span into 20 rows.
+func Combine(step time.Duration, paths ...string) (*JointReport, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("combine: no bundles given")
+	}
+	r := &JointReport{}
+	for _, path := range paths {
+		m, err := OpenBundle(path)
+		if err != nil {
+			return nil, err
+		}
+		r.Bundles = append(r.Bundles, *m)
+	}
+	sort.SliceStable(r.Bundles, func(i, j int) bool {
+		return r.Bundles[i].Start.Before(r.Bundles[j].Start)
+	})
+
+	start, end := r.Bundles[0].Start, r.Bundles[0].End
+	for _, m := range r.Bundles {
+		if m.End.After(end) {
+			end = m.End
+		}
+	}
+	if step <= 0 {
+		step = max(end.Sub(start)/20, time.Millisecond).Round(time.Millisecond)
+	}
+	r.Step = step
+
+	n := int(end.Sub(start)/step) + 1
+	r.Rows = make([]JointRow, n)
+	for i := range r.Rows {
+		r.Rows[i] = JointRow{Offset: time.Duration(i) * step, Cells: make([]*JointCell, len(r.Bundles))}
+	}
+	for b, m := range r.Bundles {
+		proc := JointProcess{Offset: m.Start.Sub(start)}
+		if a, ok := m.Artifact("cpu"); ok {
+			prof, err := ReadProfile(a.Path)
+			if err != nil {
+				return nil, err
+			}
+			if len(prof.SampleType) > 0 {
+				idx := valueIndex(prof, "")
+				var total int64
+				for _, s := range prof.Sample {
+					total += s.Value[idx]
+				}
+				proc.CPU = time.Duration(total)
+			}
+		}
+		r.Procs = append(r.Procs, proc)
+
+		a, ok := m.Artifact("metrics")
+		if !ok {
+			continue
+		}
+		samples, err := ReadMetrics(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		var cycles uint64
+		if len(samples) > 0 {
+			cycles = samples[0].GCCycles
+		}
+		for _, s := range samples {
+			i := int(s.Time.Sub(start) / step)
+			if i < 0 || i >= n {
+				continue
+			}
+			c := r.Rows[i].Cells[b]
+			if c == nil {
+				c = &JointCell{}
+				r.Rows[i].Cells[b] = c
+			}
+			c.HeapBytes, c.Goroutines = s.HeapBytes, s.Goroutines
+			c.GCs += s.GCCycles - cycles
+			cycles = s.GCCycles
+			c.SchedLatency99 = max(c.SchedLatency99, s.SchedLatency99)
+		}
+	}
+	return r, nil
+}
+
+func (c *JointCell) fields(f Format) []string {
+	if c == nil {
+		return []string{"-", "-", "-", "-"}
+	}
+	return []string{FormatBytes(int64(c.HeapBytes)), f.Int(int64(c.Goroutines)), f.Int(int64(c.GCs)), f.Duration(c.SchedLatency99)}
+}
+
+func (r *JointReport) WriteText(w io.Writer) error {
+	f := r.Format
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "joint report: %d processes\n", len(r.Bundles))
+	fmt.Fprintln(tw, "process\tpid\thost\toffset\tduration\tcpu\tcores\tgcs")
+	for i, m := range r.Bundles {
+		p := r.Procs[i]
+		var gcs uint32
+		if m.Memory != nil {
+			gcs = m.Memory.NumGC
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%d\n", m.Name, m.PID, m.Host, f.Duration(p.Offset), f.Duration(m.Duration), f.Duration(p.CPU), f.Float(p.Cores(m.Duration), 2), gcs)
+	}
+	fmt.Fprintln(tw)
+
+	header := []string{"offset"}
+	for _, m := range r.Bundles {
+		header = append(header, m.Name+" heap", "goroutines", "gcs", "p99 sched")
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range r.Rows {
+		fields := []string{f.Duration(row.Offset)}
+		for _, c := range row.Cells {
+			fields = append(fields, c.fields(f)...)
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (r *JointReport) WriteMarkdown(w io.Writer) error {
+	f := r.Format
+	fmt.Fprintf(w, "## Joint report\n\n")
+	fmt.Fprintln(w, "| process | pid | host | offset | duration | cpu | cores | gcs |")
+	fmt.Fprintln(w, "|---|---:|---|---:|---:|---:|---:|---:|")
+	for i, m := range r.Bundles {
+		p := r.Procs[i]
+		var gcs uint32
+		if m.Memory != nil {
+			gcs = m.Memory.NumGC
+		}
+		fmt.Fprintf(w, "| %s | %d | %s | %s | %s | %s | %s | %d |\n", m.Name, m.PID, m.Host, f.Duration(p.Offset), f.Duration(m.Duration), f.Duration(p.CPU), f.Float(p.Cores(m.Duration), 2), gcs)
+	}
+
+	header := []string{"offset"}
+	align := []string{"---:"}
+	for _, m := range r.Bundles {
+		header = append(header, m.Name+" heap", "goroutines", "gcs", "p99 sched")
+		align = append(align, "---:", "---:", "---:", "---:")
+	}
+	fmt.Fprintf(w, "\n| %s |\n|%s|\n", strings.Join(header, " | "), strings.Join(align, "|"))
+	for _, row := range r.Rows {
+		fields := []string{f.Duration(row.Offset)}
+		for _, c := range row.Cells {
+			fields = append(fields, c.fields(f)...)
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(fields, " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
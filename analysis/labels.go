@@ -0,0 +1,69 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// LabelStat is the weight of the samples that carry one value of a pprof
+// label.
+type LabelStat struct {
+	Key string `json:"key"`
+	// Value is "" for the samples without the label.
+	Value string  `json:"value"`
+	Total int64   `json:"total"`
+	Pct   float64 `json:"pct"` // of the profile total
+}
+
+// ByLabel breaks the weight of prof down by the value of each label key,
+// as go tool pprof -tags does: the keys in order, and within a key the
+// values largest first, followed by the samples without it.
+func ByLabel(prof *profile.Profile, sampleType string) []LabelStat {
+	if len(prof.SampleType) == 0 {
+		return nil
+	}
+	idx := valueIndex(prof, sampleType)
+	type key struct{ k, v string }
+	totals := map[key]int64{}
+	keys := map[string]int64{} // the weight of the samples with the key
+	var total int64
+	for _, s := range prof.Sample {
+		v := s.Value[idx]
+		total += v
+		for k, values := range s.Label {
+			// pprof.Do sets one value per key
+			if len(values) > 0 {
+				totals[key{k, values[0]}] += v
+				keys[k] += v
+			}
+		}
+	}
+	var out []LabelStat
+	for k, v := range totals {
+		out = append(out, LabelStat{Key: k.k, Value: k.v, Total: v})
+	}
+	for k, v := range keys {
+		if rest := total - v; rest > 0 {
+			out = append(out, LabelStat{Key: k, Total: rest})
+		}
+	}
+	for i := range out {
+		if total > 0 {
+			out[i].Pct = 100 * float64(out[i].Total) / float64(total)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.Key != b.Key:
+			return a.Key < b.Key
+		case (a.Value == "") != (b.Value == ""):
+			return b.Value == ""
+		case a.Total != b.Total:
+			return a.Total > b.Total
+		}
+		return a.Value < b.Value
+	})
+	return out
+}
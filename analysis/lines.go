@@ -0,0 +1,188 @@
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// LineStat is the weight of one source line, like a line of pprof -list.
+type LineStat struct {
+	Line int64 `json:"line"`
+	Flat int64 `json:"flat"`
+	Cum  int64 `json:"cum"`
+	// Source is the text of the line, if the file was found.
+	Source string `json:"source,omitempty"`
+}
+
+// FuncLines are the hottest lines of one function.
+type FuncLines struct {
+	FuncStat
+	File  string     `json:"file"`
+	Lines []LineStat `json:"lines"` // in source order
+}
+
+// LineReport annotates the hottest functions of a profile with their
+// hottest lines.
+type LineReport struct {
+	SampleType string      `json:"sample_type"`
+	Unit       string      `json:"unit"`
+	Funcs      []FuncLines `json:"funcs"` // hottest first
+}
+
+// Annotate reads the profile at path and returns HotLines for it.
+func Annotate(path string, funcs, lines int) (*LineReport, error) {
+	prof, err := ReadProfile(path)
+	if err != nil {
+		return nil, err
+	}
+	return HotLines(prof, "", funcs, lines), nil
+}
+
+// HotLines takes the funcs functions of prof with the most flat weight, as
+// Top ranks them and leaving out those without any, and lists the lines of each that weigh most, up to
+// lines of them, all if lines <= 0. The source text is read from the
+// files the profile names, where they exist on this machine.
+func HotLines(prof *profile.Profile, sampleType string, funcs, lines int) *LineReport {
+	r := &LineReport{}
+	if len(prof.SampleType) == 0 {
+		return r
+	}
+	idx := valueIndex(prof, sampleType)
+	r.SampleType, r.Unit = prof.SampleType[idx].Type, prof.SampleType[idx].Unit
+
+	type key struct {
+		fn   string
+		line int64
+	}
+	stats := map[key]*LineStat{}
+	files := map[string]string{}
+	for _, s := range prof.Sample {
+		v := s.Value[idx]
+		seen := map[key]bool{}
+		for i, loc := range s.Location {
+			for j, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				k := key{line.Function.Name, line.Line}
+				files[k.fn] = line.Function.Filename
+				st := stats[k]
+				if st == nil {
+					st = &LineStat{Line: k.line}
+					stats[k] = st
+				}
+				if i == 0 && j == 0 {
+					st.Flat += v
+				}
+				if !seen[k] {
+					seen[k] = true
+					st.Cum += v
+				}
+			}
+		}
+	}
+
+	sources := map[string][]string{}
+	for _, f := range Top(prof, sampleType, funcs) {
+		// the rest only call the hot code
+		if f.Flat <= 0 {
+			break
+		}
+		fl := FuncLines{FuncStat: f, File: files[f.Name]}
+		for k, st := range stats {
+			if k.fn == f.Name {
+				fl.Lines = append(fl.Lines, *st)
+			}
+		}
+		sort.Slice(fl.Lines, func(i, j int) bool {
+			a, b := fl.Lines[i], fl.Lines[j]
+			if a.Flat != b.Flat {
+				return a.Flat > b.Flat
+			}
+			return a.Cum > b.Cum
+		})
+		if lines > 0 && len(fl.Lines) > lines {
+			fl.Lines = fl.Lines[:lines]
+		}
+		sort.Slice(fl.Lines, func(i, j int) bool { return fl.Lines[i].Line < fl.Lines[j].Line })
+
+		src, ok := sources[fl.File]
+		if !ok {
+			src = readSource(fl.File)
+			sources[fl.File] = src
+		}
+		for i, l := range fl.Lines {
+			if l.Line > 0 && int(l.Line) <= len(src) {
+				fl.Lines[i].Source = strings.ReplaceAll(strings.TrimSpace(src[l.Line-1]), "\t", " ")
+			}
+		}
+		r.Funcs = append(r.Funcs, fl)
+	}
+	return r
+}
+
+// readSource returns the lines of file, nil if it cannot be read.
+func readSource(file string) []string {
+	if file == "" {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines
+}
+
+// WriteText writes the report in the style of pprof -list.
+func (r *LineReport) WriteText(w io.Writer) error {
+	v := func(n int64) string { return FormatValue(n, r.Unit) }
+	for i, f := range r.Funcs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "ROUTINE %s in %s\n", f.Name, f.File)
+		fmt.Fprintf(w, "%s flat (%.1f%%), %s cum (%.1f%%)\n", v(f.Flat), f.FlatPct, v(f.Cum), f.CumPct)
+		r.writeLines(w, f.Lines)
+	}
+	return nil
+}
+
+// WriteMarkdown writes the report for pasting into a review or an issue.
+func (r *LineReport) WriteMarkdown(w io.Writer) error {
+	v := func(n int64) string { return FormatValue(n, r.Unit) }
+	fmt.Fprintf(w, "# Hot lines (%s)\n", r.SampleType)
+	for _, f := range r.Funcs {
+		fmt.Fprintf(w, "\n## `%s`\n\n", f.Name)
+		fmt.Fprintf(w, "%s flat (%.1f%%), %s cum (%.1f%%) in `%s`\n\n```\n", v(f.Flat), f.FlatPct, v(f.Cum), f.CumPct, f.File)
+		r.writeLines(w, f.Lines)
+		fmt.Fprintln(w, "```")
+	}
+	return nil
+}
+
+func (r *LineReport) writeLines(w io.Writer, lines []LineStat) {
+	v := func(n int64) string {
+		if n == 0 {
+			return "."
+		}
+		return FormatValue(n, r.Unit)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, l := range lines {
+		fmt.Fprintf(tw, "%s\t%s\t%d:\t %s\n", v(l.Flat), v(l.Cum), l.Line, l.Source)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,221 @@
+// Package analysis reads and reports on the bundles goprof writes.
+//
+// It has no collection machinery (signal handlers, profilers, servers), so
+// tooling that only looks at existing profiles can import it without
+// pulling any of that into its binary. It does reach out for the profiles
+// it reads: HTTPFile and Debuginfod are net/http clients, and
+// TraceProfiles runs go tool trace.
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileName is the file an artifact of the given type gets for a session.
+func FileName(name, typ string) string {
+	if prof, ok := strings.CutPrefix(typ, "folded-"); ok {
+		return fmt.Sprintf("%s.%s.folded", name, prof)
+	}
+	if prof, ok := strings.CutPrefix(typ, "flame-"); ok {
+		return fmt.Sprintf("%s.%s.flame.svg", name, prof)
+	}
+	if prof, ok := strings.CutPrefix(typ, "speedscope-"); ok {
+		return fmt.Sprintf("%s.%s.speedscope.json", name, prof)
+	}
+	return fmt.Sprintf("%s.%s.%s", name, typ, FileExt(typ))
+}
+
+// FileExt is the extension, without the dot, of the file an artifact of the
+// given type gets.
+func FileExt(typ string) string {
+	switch typ {
+	case "cpu":
+		return "pprof"
+	case "trace":
+		return "out"
+	case "goroutines", "gctrace":
+		return "txt"
+	case "metrics":
+		return "csv"
+	case "report":
+		return "html"
+	case "heapdump":
+		return "bin"
+	case "flight":
+		return "trace.out"
+	case "lines":
+		return "md"
+	}
+	switch {
+	case strings.HasPrefix(typ, "folded-"):
+		return "folded"
+	case strings.HasPrefix(typ, "flame-"):
+		return "svg"
+	case strings.HasPrefix(typ, "speedscope-"):
+		return "json"
+	case strings.HasSuffix(typ, "-text"):
+		return "txt"
+	}
+	return "prof"
+}
+
+// ManifestName is the file the manifest of a session is written to.
+func ManifestName(name string) string {
+	return fmt.Sprintf("%s.manifest.json", name)
+}
+
+// Artifact is a single file produced by a session.
+// In a manifest on disk Path is relative to the manifest's directory;
+// ReadManifest resolves it.
+type Artifact struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Compression is CompressionZstdSeekable for artifacts written as
+	// independent zstd frames, one per chunk; see OpenArtifact and ReadChunk.
+	Compression string  `json:"compression,omitempty"`
+	Chunks      []Chunk `json:"chunks,omitempty"`
+	// Encryption is EncryptionAge for artifacts encrypted with age, whose
+	// Path ends in EncryptedExt and Size is that of the encrypted file;
+	// goprof decrypt restores them.
+	Encryption string `json:"encryption,omitempty"`
+}
+
+// EncryptionAge marks artifacts encrypted with age, https://age-encryption.org.
+const EncryptionAge = "age"
+
+// EncryptedExt is the suffix encryption adds to the file of an artifact.
+const EncryptedExt = ".age"
+
+// Manifest describes one profiling session and the files it produced.
+// goprof writes it next to the profiles as <name>.manifest.json.
+type Manifest struct {
+	Name      string          `json:"name"`
+	RunID     string          `json:"run_id,omitempty"`
+	PID       int             `json:"pid,omitempty"`
+	Host      string          `json:"host,omitempty"`
+	GoVersion string          `json:"go_version,omitempty"`
+	Start     time.Time       `json:"start"`
+	End       time.Time       `json:"end"`
+	Duration  time.Duration   `json:"duration"`
+	Artifacts []Artifact      `json:"artifacts"`
+	Memory    *MemDelta       `json:"memory,omitempty"`
+	GC        *GCSummary      `json:"gc,omitempty"`
+	CPU       *CPULimits      `json:"cpu,omitempty"`
+	Rusage    *Rusage         `json:"rusage,omitempty"`
+	Runtime   *RuntimeSummary `json:"runtime,omitempty"`
+	Overhead  *Overhead       `json:"overhead,omitempty"`
+	// Leaks are goroutines started during the session that were still
+	// running at its end, when the session checked for them.
+	Leaks []Goroutine `json:"leaks,omitempty"`
+	// Nested are the Runs made during the session under names below its
+	// own, which ran as trace regions of the session.
+	Nested []NestedRun `json:"nested,omitempty"`
+	// Paused are the stretches of the session between goprof.Pause and
+	// goprof.Resume, which its CPU profile leaves out.
+	Paused []Gap `json:"paused,omitempty"`
+	// Phases are the stretches the session was split into with
+	// goprof.Phase, in order.
+	Phases []Phase `json:"phases,omitempty"`
+	// Children are the manifests of the sessions child processes wrote
+	// during the session, see goprof.ProfileCmd. On disk they are relative
+	// to the manifest's directory, like artifact paths.
+	Children []string `json:"children,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Gap is a stretch of time left out of a session.
+type Gap struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Phase is one stretch of a session started with goprof.Phase.
+type Phase struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+}
+
+// NestedRun is the time spent in the nested Runs of one name.
+type NestedRun struct {
+	Name  string        `json:"name"`
+	Count int           `json:"count"`
+	Total time.Duration `json:"total"`
+}
+
+// ReadManifest reads a manifest written by goprof.
+func ReadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(b, path)
+}
+
+// ReadManifestFS is ReadManifest for a manifest in fsys.
+func ReadManifestFS(fsys fs.FS, path string) (*Manifest, error) {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(b, path)
+}
+
+func parseManifest(b []byte, path string) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.resolve(filepath.Dir(path))
+	return &m, nil
+}
+
+// OpenBundle reads the manifest of a bundle given either the manifest file
+// itself or a directory holding exactly one manifest.
+func OpenBundle(path string) (*Manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return ReadManifest(path)
+	}
+	paths, err := filepath.Glob(filepath.Join(path, "*.manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) != 1 {
+		return nil, fmt.Errorf("%s: expected one manifest, found %d", path, len(paths))
+	}
+	return ReadManifest(paths[0])
+}
+
+func (m *Manifest) resolve(dir string) {
+	for i, a := range m.Artifacts {
+		if !filepath.IsAbs(a.Path) {
+			m.Artifacts[i].Path = filepath.Join(dir, a.Path)
+		}
+	}
+	for i, c := range m.Children {
+		if !filepath.IsAbs(c) {
+			m.Children[i] = filepath.Join(dir, c)
+		}
+	}
+}
+
+// Artifact returns the first artifact of the given type.
+func (m *Manifest) Artifact(typ string) (Artifact, bool) {
+	for _, a := range m.Artifacts {
+		if a.Type == typ {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
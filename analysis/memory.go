@@ -0,0 +1,24 @@
+package analysis
+
+import (
+	"fmt"
+	"time"
+)
+
+// MemDelta is the change in runtime.MemStats over a session.
+type MemDelta struct {
+	HeapAllocStart uint64        `json:"heap_alloc_start"`
+	HeapAllocEnd   uint64        `json:"heap_alloc_end"`
+	TotalAlloc     uint64        `json:"total_alloc"`
+	Mallocs        uint64        `json:"mallocs"`
+	Frees          uint64        `json:"frees"`
+	NumGC          uint32        `json:"num_gc"`
+	GCPause        time.Duration `json:"gc_pause"`
+}
+
+func (d MemDelta) String() string {
+	return fmt.Sprintf("allocated %s in %d objects, heap %s -> %s, %d GCs (%s paused)",
+		FormatBytes(int64(d.TotalAlloc)), d.Mallocs,
+		FormatBytes(int64(d.HeapAllocStart)), FormatBytes(int64(d.HeapAllocEnd)),
+		d.NumGC, d.GCPause)
+}
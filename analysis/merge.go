@@ -0,0 +1,49 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/pprof/profile"
+)
+
+// Merge adds up the pprof profiles at inputs, e.g. periodic agent captures
+// or the iterations of a benchmark, and writes the result to out. The
+// profiles must be of the same kind; the merged one spans from the
+// earliest start to the latest end.
+func Merge(out string, inputs ...string) error {
+	if len(inputs) == 0 {
+		return errors.New("no profiles to merge")
+	}
+	profs := make([]*profile.Profile, 0, len(inputs))
+	for _, path := range inputs {
+		prof, err := ReadProfile(path)
+		if err != nil {
+			return err
+		}
+		profs = append(profs, prof)
+	}
+	merged, err := profile.Merge(profs)
+	if err != nil {
+		return fmt.Errorf("merging %s: %w", inputs[0], err)
+	}
+	// profile.Merge adds up the durations, which leaves out the gaps
+	// between periodic captures and counts overlapping ones twice
+	var end int64
+	for _, p := range profs {
+		end = max(end, p.TimeNanos+p.DurationNanos)
+	}
+	if merged.TimeNanos != 0 {
+		merged.DurationNanos = end - merged.TimeNanos
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := merged.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
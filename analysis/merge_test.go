@@ -0,0 +1,51 @@
+package analysis
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	a := testProfile(cpuTypes, map[string][]int64{"parse;main": {1, 100}, "gc": {2, 50}})
+	b := testProfile(cpuTypes, map[string][]int64{"parse;main": {3, 300}, "log;main": {1, 10}})
+	b.TimeNanos += int64(time.Minute)
+	out := filepath.Join(t.TempDir(), "merged.pprof")
+	if err := Merge(out, writeProfile(t, a, "a.pprof"), writeProfile(t, b, "b.pprof")); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := ReadProfile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat := map[string]int64{}
+	for _, f := range Top(merged, "cpu", 0) {
+		flat[f.Name] = f.Flat
+	}
+	if flat["parse"] != 400 || flat["gc"] != 50 || flat["log"] != 10 || len(flat) != 4 {
+		t.Errorf("merged flat weights: %v", flat)
+	}
+	// from the start of a to the end of b
+	if merged.TimeNanos != a.TimeNanos || merged.DurationNanos != int64(time.Minute+time.Second) {
+		t.Errorf("merged spans %v from %v", time.Duration(merged.DurationNanos), time.Unix(0, merged.TimeNanos).UTC())
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	dir := t.TempDir()
+	cpu := writeProfile(t, testProfile(cpuTypes, map[string][]int64{"f": {1, 10}}), "cpu.pprof")
+	heap := writeProfile(t, testProfile([]string{"alloc_objects/count", "alloc_space/bytes"}, map[string][]int64{"f": {1, 10}}), "heap.pprof")
+	for name, inputs := range map[string][]string{
+		"none":       nil,
+		"mismatched": {cpu, heap},
+		"missing":    {cpu, filepath.Join(dir, "missing.pprof")},
+	} {
+		out := filepath.Join(dir, name+".pprof")
+		if err := Merge(out, inputs...); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+		if _, err := ReadProfile(out); err == nil {
+			t.Errorf("%s: wrote %s", name, out)
+		}
+	}
+}
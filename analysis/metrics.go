@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// MetricsHeader is the header row of a <name>.metrics.csv timeline.
+var MetricsHeader = []string{
+	"time", "elapsed_ms", "heap_bytes", "goroutines", "gc_cycles",
+	"gc_cpu_fraction", "sched_latency_p50_us", "sched_latency_p99_us",
+}
+
+// MetricsSample is one row of a metrics timeline.
+type MetricsSample struct {
+	Time           time.Time     `json:"time"`
+	Elapsed        time.Duration `json:"elapsed"`
+	HeapBytes      uint64        `json:"heap_bytes"`
+	Goroutines     uint64        `json:"goroutines"`
+	GCCycles       uint64        `json:"gc_cycles"`
+	GCCPUFraction  float64       `json:"gc_cpu_fraction"`
+	SchedLatency50 time.Duration `json:"sched_latency_p50"`
+	SchedLatency99 time.Duration `json:"sched_latency_p99"`
+}
+
+// ReadMetrics parses a metrics timeline written with goprof.WithMetrics.
+func ReadMetrics(path string) ([]MetricsSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(rows) == 0 || len(rows[0]) != len(MetricsHeader) {
+		return nil, fmt.Errorf("%s: not a metrics timeline", path)
+	}
+	samples := make([]MetricsSample, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		var s MetricsSample
+		var errs [8]error
+		var ms, p50, p99 float64
+		s.Time, errs[0] = time.Parse(time.RFC3339Nano, row[0])
+		ms, errs[1] = strconv.ParseFloat(row[1], 64)
+		s.HeapBytes, errs[2] = strconv.ParseUint(row[2], 10, 64)
+		s.Goroutines, errs[3] = strconv.ParseUint(row[3], 10, 64)
+		s.GCCycles, errs[4] = strconv.ParseUint(row[4], 10, 64)
+		s.GCCPUFraction, errs[5] = strconv.ParseFloat(row[5], 64)
+		p50, errs[6] = strconv.ParseFloat(row[6], 64)
+		p99, errs[7] = strconv.ParseFloat(row[7], 64)
+		for _, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("%s: row %d: %w", path, i+2, err)
+			}
+		}
+		s.Elapsed = time.Duration(ms * float64(time.Millisecond))
+		s.SchedLatency50 = time.Duration(p50 * float64(time.Microsecond))
+		s.SchedLatency99 = time.Duration(p99 * float64(time.Microsecond))
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Overhead is what goprof itself cost a session, to judge whether its
+// numbers are distorted by the profiling.
+type Overhead struct {
+	// Start is the time Start took to set the session up, Stop the time
+	// Stop took to write its profiles, up to the manifest.
+	Start time.Duration `json:"start"`
+	Stop  time.Duration `json:"stop"`
+	// TraceBytes is the size of the execution trace before compression,
+	// and TraceWrite the time spent writing it out.
+	TraceBytes int64         `json:"trace_bytes,omitempty"`
+	TraceWrite time.Duration `json:"trace_write,omitempty"`
+	// Collectors estimate the CPU time of the collectors that run along
+	// the program, costliest first.
+	Collectors []CollectorCost `json:"collectors,omitempty"`
+	// CPUPct is their total as a share of the CPU time of the process
+	// during the session, when it is known.
+	CPUPct float64 `json:"cpu_pct,omitempty"`
+}
+
+// CollectorCost is the estimated CPU time one collector took for the
+// events it recorded; for the trace, Events are bytes.
+type CollectorCost struct {
+	Name   string        `json:"name"`
+	Events int64         `json:"events"`
+	CPU    time.Duration `json:"cpu"`
+}
+
+// CPU is the estimated CPU time of all collectors.
+func (o Overhead) CPU() time.Duration {
+	var total time.Duration
+	for _, c := range o.Collectors {
+		total += c.CPU
+	}
+	return total
+}
+
+// WriteText writes the overhead in one line.
+func (o Overhead) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "goprof overhead: start %s, stop %s", o.Start.Round(time.Microsecond), o.Stop.Round(time.Microsecond))
+	if o.TraceBytes > 0 {
+		fmt.Fprintf(&b, ", trace %s", FormatBytes(o.TraceBytes))
+		if o.TraceWrite > 0 {
+			fmt.Fprintf(&b, " written at %s/s", FormatBytes(int64(float64(o.TraceBytes)/o.TraceWrite.Seconds())))
+		}
+	}
+	if len(o.Collectors) > 0 {
+		fmt.Fprintf(&b, ", about %s CPU", o.CPU().Round(time.Microsecond))
+		if o.CPUPct > 0 {
+			fmt.Fprintf(&b, " (%.1f%% of the process)", o.CPUPct)
+		}
+		var parts []string
+		for _, c := range o.Collectors {
+			parts = append(parts, fmt.Sprintf("%s %s", c.Name, c.CPU.Round(time.Microsecond)))
+		}
+		fmt.Fprintf(&b, ": %s", strings.Join(parts, ", "))
+	}
+	b.WriteByte('\n')
+	_, err := io.WriteString(w, b.String())
+	return err
+}
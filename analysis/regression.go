@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Thresholds are the growth CheckRegression tolerates, as fractions of the
+// baseline: 0.1 lets a value grow by 10%. A zero field skips its check.
+type Thresholds struct {
+	// Duration is for the wall time of the session.
+	Duration float64 `json:"duration"`
+	// Alloc is for the bytes allocated during the session.
+	Alloc float64 `json:"alloc"`
+	// CPU is for the total time of the CPU profile.
+	CPU float64 `json:"cpu"`
+	// Func is for the flat CPU time of any one function, measured against
+	// the baseline's total, so a function that goes from nothing to 10% of
+	// the baseline's CPU time fails a Func of 0.1.
+	Func float64 `json:"func"`
+}
+
+// RegressionCheck is one comparison of CheckRegression.
+type RegressionCheck struct {
+	// Name is "duration", "alloc", "cpu" or the function name.
+	Name    string `json:"name"`
+	Unit    string `json:"unit"`
+	Base    int64  `json:"base"`
+	Current int64  `json:"current"`
+	// Growth is the change as a fraction of the baseline, and Limit the
+	// threshold it was held to.
+	Growth float64 `json:"growth"`
+	Limit  float64 `json:"limit"`
+	Failed bool    `json:"failed"`
+}
+
+// RegressionReport is what CheckRegression found.
+type RegressionReport struct {
+	Baseline string            `json:"baseline"`
+	Current  string            `json:"current"`
+	Checks   []RegressionCheck `json:"checks"`
+}
+
+// Failed reports whether any check exceeded its threshold.
+func (r *RegressionReport) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRegression compares the bundle at currentPath with the one at
+// baselinePath, each a manifest or a directory holding exactly one (see
+// OpenBundle): their duration, allocations, total CPU time and the flat CPU
+// time of every function. Functions are only listed when they exceed
+// t.Func. A check is skipped when the baseline value is 0 or a bundle
+// lacks what it needs.
+func CheckRegression(baselinePath, currentPath string, t Thresholds) (*RegressionReport, error) {
+	base, err := OpenBundle(baselinePath)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := OpenBundle(currentPath)
+	if err != nil {
+		return nil, err
+	}
+	r := &RegressionReport{Baseline: baselinePath, Current: currentPath}
+	check := func(name, unit string, b, c, limit, growth float64) {
+		r.Checks = append(r.Checks, RegressionCheck{
+			Name: name, Unit: unit, Base: int64(b), Current: int64(c),
+			Growth: growth, Limit: limit, Failed: growth > limit,
+		})
+	}
+	compare := func(name, unit string, b, c int64, limit float64) {
+		if limit > 0 && b > 0 {
+			check(name, unit, float64(b), float64(c), limit, float64(c-b)/float64(b))
+		}
+	}
+
+	compare("duration", "nanoseconds", int64(base.Duration), int64(cur.Duration), t.Duration)
+	if base.Memory != nil && cur.Memory != nil {
+		compare("alloc", "bytes", int64(base.Memory.TotalAlloc), int64(cur.Memory.TotalAlloc), t.Alloc)
+	}
+	baseCPU, ok1 := base.Artifact("cpu")
+	curCPU, ok2 := cur.Artifact("cpu")
+	if ok1 && ok2 && (t.CPU > 0 || t.Func > 0) {
+		d, err := Diff(baseCPU.Path, curCPU.Path)
+		if err != nil {
+			return nil, err
+		}
+		compare("cpu", d.Unit, d.BaseTotal, d.CurTotal, t.CPU)
+		if t.Func > 0 && d.BaseTotal > 0 {
+			// biggest regression first
+			for _, f := range d.Funcs {
+				if f.Delta() <= 0 {
+					break
+				}
+				growth := float64(f.Delta()) / float64(d.BaseTotal)
+				if growth > t.Func {
+					check(f.Name, d.Unit, float64(f.BaseFlat), float64(f.CurFlat), t.Func, growth)
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// WriteText lists the checks and ends with PASS or FAIL.
+func (r *RegressionReport) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "%s -> %s\n", r.Baseline, r.Current)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "base\tcurrent\tgrowth\tlimit\t\t")
+	for _, c := range r.Checks {
+		status := "ok"
+		if c.Failed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%+.1f%%\t%.1f%%\t\t%-4s  %s\n", regressionValue(c.Base, c.Unit), regressionValue(c.Current, c.Unit), 100*c.Growth, 100*c.Limit, status, c.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	verdict := "PASS"
+	if r.Failed() {
+		verdict = "FAIL"
+	}
+	_, err := fmt.Fprintln(w, verdict)
+	return err
+}
+
+func regressionValue(v int64, unit string) string {
+	if unit == "nanoseconds" {
+		return time.Duration(v).Round(time.Microsecond).String()
+	}
+	return FormatValue(v, unit)
+}
@@ -0,0 +1,153 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// RunReport combines the sessions of every process that shared a run id.
+type RunReport struct {
+	RunID  string
+	Stages []Manifest // ordered by start time
+	Format Format
+}
+
+var ErrRunNotFound = errors.New("no sessions found for run")
+
+// LoadRun collects all manifests in dir that belong to runID.
+func LoadRun(dir, runID string) (*RunReport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	r := &RunReport{RunID: runID}
+	for _, path := range paths {
+		m, err := ReadManifest(path)
+		if err != nil {
+			return nil, err
+		}
+		if m.RunID == runID {
+			r.Stages = append(r.Stages, *m)
+		}
+	}
+	if len(r.Stages) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrRunNotFound, runID)
+	}
+	sort.Slice(r.Stages, func(i, j int) bool {
+		return r.Stages[i].Start.Before(r.Stages[j].Start)
+	})
+	return r, nil
+}
+
+// ListRuns collects the manifests in dir and in its subdirectories one
+// level down into a RunReport per run id, newest run first. Sessions
+// without a run id are a run of their own, under their name.
+//
+// A manifest that cannot be read, such as one a session is writing right
+// now, is left out, and a warning about it is returned with the runs.
+func ListRuns(dir string) ([]RunReport, []string, error) {
+	var paths []string
+	for _, pattern := range []string{"*.manifest.json", "*/*.manifest.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	byID := map[string]int{}
+	var runs []RunReport
+	var warnings []string
+	for _, path := range paths {
+		m, err := ReadManifest(path)
+		if err != nil {
+			// the error names the file
+			warnings = append(warnings, fmt.Sprintf("skipped %v", err))
+			continue
+		}
+		id := m.RunID
+		if id == "" {
+			id = m.Name
+		}
+		i, ok := byID[id]
+		if !ok {
+			i = len(runs)
+			byID[id] = i
+			runs = append(runs, RunReport{RunID: id})
+		}
+		runs[i].Stages = append(runs[i].Stages, *m)
+	}
+	for _, r := range runs {
+		sort.Slice(r.Stages, func(i, j int) bool {
+			return r.Stages[i].Start.Before(r.Stages[j].Start)
+		})
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Stages[0].Start.After(runs[j].Stages[0].Start)
+	})
+	return runs, warnings, nil
+}
+
+// Profiled is the sum of all stage durations.
+func (r *RunReport) Profiled() time.Duration {
+	var d time.Duration
+	for _, s := range r.Stages {
+		d += s.Duration
+	}
+	return d
+}
+
+// Elapsed is the time from the start of the first stage to the end of the last.
+func (r *RunReport) Elapsed() time.Duration {
+	var end time.Time
+	for _, s := range r.Stages {
+		if s.End.After(end) {
+			end = s.End
+		}
+	}
+	return end.Sub(r.Stages[0].Start)
+}
+
+func (r *RunReport) WriteText(w io.Writer) error {
+	f := r.Format
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "run %s: %d stages, %s profiled, %s elapsed\n", r.RunID, len(r.Stages), f.Duration(r.Profiled()), f.Duration(r.Elapsed()))
+	fmt.Fprintln(tw, "stage\tpid\tstart\tduration")
+	for _, s := range r.Stages {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", s.Name, s.PID, f.Time(s.Start), f.Duration(s.Duration))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, s := range r.Stages {
+		for _, warning := range s.Warnings {
+			fmt.Fprintf(w, "WARNING %s: %s\n", s.Name, warning)
+		}
+	}
+	return nil
+}
+
+func (r *RunReport) WriteMarkdown(w io.Writer) error {
+	f := r.Format
+	fmt.Fprintf(w, "## Run %s\n\n", r.RunID)
+	fmt.Fprintf(w, "%d stages, %s profiled, %s elapsed.\n\n", len(r.Stages), f.Duration(r.Profiled()), f.Duration(r.Elapsed()))
+	fmt.Fprintln(w, "| stage | pid | start | duration |")
+	fmt.Fprintln(w, "|---|---:|---|---:|")
+	for _, s := range r.Stages {
+		if _, err := fmt.Fprintf(w, "| %s | %d | %s | %s |\n", s.Name, s.PID, f.Time(s.Start), f.Duration(s.Duration)); err != nil {
+			return err
+		}
+	}
+	for _, s := range r.Stages {
+		for _, warning := range s.Warnings {
+			if _, err := fmt.Fprintf(w, "\n> **Warning** (%s): %s\n", s.Name, warning); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// RuntimeMode says what a report does with samples whose stacks are
+// entirely inside the runtime, such as GC workers and the scheduler.
+type RuntimeMode int
+
+const (
+	// RuntimeKeep reports runtime stacks like any other.
+	RuntimeKeep RuntimeMode = iota
+	// RuntimeCollapse replaces each runtime stack with a single pseudo
+	// frame, "[runtime: GC]", "[runtime: scheduler]" or "[runtime]", so
+	// the cost stays visible without its internals.
+	RuntimeCollapse
+	// RuntimeDrop leaves runtime stacks out; percentages are then
+	// relative to the application's own samples.
+	RuntimeDrop
+)
+
+func (m RuntimeMode) String() string {
+	switch m {
+	case RuntimeKeep:
+		return "keep"
+	case RuntimeCollapse:
+		return "collapse"
+	case RuntimeDrop:
+		return "drop"
+	}
+	return "RuntimeMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// runtimeGroups names the pseudo frame of a collapsed stack by the first
+// function that matches one of the prefixes.
+var runtimeGroups = []struct {
+	prefixes []string
+	group    string
+}{
+	{[]string{"runtime.gc", "runtime.bgsweep", "runtime.bgscavenge", "runtime.markroot", "runtime.scanobject", "runtime.sweepone", "runtime.runfinq"}, "GC"},
+	{[]string{"runtime.schedule", "runtime.findRunnable", "runtime.mstart", "runtime.sysmon", "runtime.park_m", "runtime.goexit0", "runtime.mcall"}, "scheduler"},
+}
+
+func isRuntimeFunc(name string) bool {
+	return strings.HasPrefix(name, "runtime.") ||
+		strings.HasPrefix(name, "runtime/internal/") ||
+		strings.HasPrefix(name, "internal/runtime/")
+}
+
+// runtimeGroup reports whether every frame of s is in the runtime and if
+// so, which pseudo frame it collapses into.
+func runtimeGroup(s *profile.Sample) (string, bool) {
+	var names []string
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function == nil || !isRuntimeFunc(line.Function.Name) {
+				return "", false
+			}
+			names = append(names, line.Function.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "", false
+	}
+	for _, g := range runtimeGroups {
+		for _, name := range names {
+			for _, prefix := range g.prefixes {
+				if strings.HasPrefix(name, prefix) {
+					return "[runtime: " + g.group + "]", true
+				}
+			}
+		}
+	}
+	return "[runtime]", true
+}
+
+// FilterRuntime returns prof with its runtime-internal samples handled as
+// mode says. prof itself is left alone, so the raw profile stays complete.
+func FilterRuntime(prof *profile.Profile, mode RuntimeMode) *profile.Profile {
+	if mode == RuntimeKeep {
+		return prof
+	}
+	out := prof.Copy()
+	var nextLoc, nextFunc uint64
+	for _, loc := range out.Location {
+		nextLoc = max(nextLoc, loc.ID)
+	}
+	for _, fn := range out.Function {
+		nextFunc = max(nextFunc, fn.ID)
+	}
+	pseudo := map[string]*profile.Location{}
+	frame := func(name string) *profile.Location {
+		if loc := pseudo[name]; loc != nil {
+			return loc
+		}
+		nextLoc++
+		nextFunc++
+		fn := &profile.Function{ID: nextFunc, Name: name, SystemName: name}
+		loc := &profile.Location{ID: nextLoc, Line: []profile.Line{{Function: fn}}}
+		out.Function = append(out.Function, fn)
+		out.Location = append(out.Location, loc)
+		pseudo[name] = loc
+		return loc
+	}
+
+	samples := out.Sample[:0]
+	for _, s := range out.Sample {
+		group, ok := runtimeGroup(s)
+		switch {
+		case !ok:
+		case mode == RuntimeDrop:
+			continue
+		default:
+			s.Location = []*profile.Location{frame(group)}
+		}
+		samples = append(samples, s)
+	}
+	out.Sample = samples
+	return out
+}
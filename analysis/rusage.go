@@ -0,0 +1,33 @@
+package analysis
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rusage is the OS resource usage of the process during a session, as
+// getrusage reports it; sessions record it on Unix only.
+type Rusage struct {
+	User   time.Duration `json:"user"`
+	System time.Duration `json:"system"`
+	// MaxRSS is the peak resident set size of the process in bytes, which
+	// may have been reached before the session started.
+	MaxRSS int64 `json:"max_rss"`
+	// MajorFaults are page faults that had to read from disk, a sign of
+	// swapping when there are many.
+	MinorFaults int64 `json:"minor_faults"`
+	MajorFaults int64 `json:"major_faults"`
+	// VoluntarySwitches count the times the process gave up the CPU to
+	// wait, e.g. for I/O; InvoluntarySwitches the times it was preempted.
+	VoluntarySwitches   int64 `json:"voluntary_switches"`
+	InvoluntarySwitches int64 `json:"involuntary_switches"`
+}
+
+// CPUTime is the user and system time together.
+func (r Rusage) CPUTime() time.Duration { return r.User + r.System }
+
+func (r Rusage) String() string {
+	return fmt.Sprintf("user %s, system %s, max RSS %s, %d major faults, %d/%d voluntary/involuntary context switches",
+		r.User.Truncate(time.Microsecond), r.System.Truncate(time.Microsecond), FormatBytes(r.MaxRSS),
+		r.MajorFaults, r.VoluntarySwitches, r.InvoluntarySwitches)
+}
@@ -0,0 +1,133 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// RuntimeSummary tells whether a session spent its time in GC, waiting for
+// the scheduler or blocked, without opening the execution trace.
+type RuntimeSummary struct {
+	// GCPercent is the share of the process's CPU time spent on GC. The
+	// runtime only updates it at the end of a GC cycle.
+	GCPercent float64 `json:"gc_percent"`
+	// Scheduler latency is the time goroutines waited to run once ready.
+	// Max is the upper bound of the highest bucket of the runtime's
+	// histogram that had any.
+	SchedLatencyMean time.Duration  `json:"sched_latency_mean"`
+	SchedLatencyP99  time.Duration  `json:"sched_latency_p99"`
+	SchedLatencyMax  time.Duration  `json:"sched_latency_max"`
+	Goroutines       GoroutineCount `json:"goroutines"`
+	// Blocking are the call sites that waited longest in total, from the
+	// block profile, longest first.
+	Blocking []BlockingSite `json:"blocking,omitempty"`
+}
+
+// GoroutineCount is the number of goroutines at the start and end of a
+// session and the most seen in between.
+type GoroutineCount struct {
+	Start int `json:"start"`
+	Max   int `json:"max"`
+	End   int `json:"end"`
+}
+
+// BlockingSite is a function that blocked on the same kind of wait.
+type BlockingSite struct {
+	Function string `json:"function"`
+	// Wait is what it waited on, e.g. "chan receive" or "mutex".
+	Wait  string        `json:"wait"`
+	Count int64         `json:"count"`
+	Delay time.Duration `json:"delay"`
+}
+
+const goprofPkg = "github.com/jcocozza/goprof."
+
+// Blocking ranks the call sites of a block profile by their total delay
+// and returns the first n, all if n <= 0. A call site is the innermost
+// function outside the runtime and sync packages; goprof's own are left out.
+func Blocking(prof *profile.Profile, n int) []BlockingSite {
+	count, delay := valueIndex(prof, "contentions"), valueIndex(prof, "delay")
+	sites := map[[2]string]*BlockingSite{}
+	for _, s := range prof.Sample {
+		wait, fn := blockingSite(s)
+		// goprof's own goroutines wait by design
+		if fn == "" || strings.HasPrefix(fn, goprofPkg) {
+			continue
+		}
+		key := [2]string{fn, wait}
+		site := sites[key]
+		if site == nil {
+			site = &BlockingSite{Function: fn, Wait: wait}
+			sites[key] = site
+		}
+		site.Count += s.Value[count]
+		site.Delay += time.Duration(s.Value[delay])
+	}
+	out := make([]BlockingSite, 0, len(sites))
+	for _, site := range sites {
+		out = append(out, *site)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Delay != out[j].Delay {
+			return out[i].Delay > out[j].Delay
+		}
+		return out[i].Function < out[j].Function
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// blockingSite names what the stack of s waited on and where.
+func blockingSite(s *profile.Sample) (wait, fn string) {
+	for _, loc := range s.Location {
+		// innermost first, as are the locations
+		for _, line := range loc.Line {
+			name := functionName(line)
+			if wait == "" {
+				wait = waitKind(name)
+			}
+			if !strings.HasPrefix(name, "runtime") && !strings.HasPrefix(name, "sync.") && !strings.HasPrefix(name, "internal/") {
+				return wait, name
+			}
+		}
+	}
+	return wait, ""
+}
+
+func waitKind(leaf string) string {
+	switch {
+	case strings.HasPrefix(leaf, "runtime.chanrecv"):
+		return "chan receive"
+	case strings.HasPrefix(leaf, "runtime.chansend"):
+		return "chan send"
+	case leaf == "runtime.selectgo":
+		return "select"
+	case strings.HasPrefix(leaf, "sync.(*Mutex)."), strings.HasPrefix(leaf, "sync.(*RWMutex)."):
+		return "mutex"
+	case strings.HasPrefix(leaf, "sync.(*WaitGroup)."):
+		return "WaitGroup"
+	case strings.HasPrefix(leaf, "sync.(*Cond)."):
+		return "Cond"
+	}
+	return leaf
+}
+
+// WriteText writes the summary in a few lines.
+func (s RuntimeSummary) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "GC %.1f%% of CPU, scheduler latency mean %s, p99 %s, max %s, goroutines %d -> %d (max %d)\n",
+		s.GCPercent, s.SchedLatencyMean, s.SchedLatencyP99, s.SchedLatencyMax,
+		s.Goroutines.Start, s.Goroutines.End, s.Goroutines.Max)
+	for _, b := range s.Blocking {
+		if _, err := fmt.Fprintf(w, "blocked %s in %d %s waits: %s\n", b.Delay.Truncate(time.Microsecond), b.Count, b.Wait, b.Function); err != nil {
+			return err
+		}
+	}
+	return nil
+}
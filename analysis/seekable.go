@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionZstdSeekable marks artifacts in the zstd seekable format:
+// a sequence of independent zstd frames followed by a seek table in a
+// skippable frame. Plain zstd tools decompress the whole file; readers that
+// know the chunks can decompress any one of them on its own.
+const CompressionZstdSeekable = "zstd-seekable"
+
+// Chunk is one zstd frame of a seekable artifact.
+type Chunk struct {
+	Offset    int64 `json:"offset"` // of the frame in the file
+	Size      int64 `json:"size"`
+	RawOffset int64 `json:"raw_offset"` // of the data in the uncompressed stream
+	RawSize   int64 `json:"raw_size"`
+	// Start and End are when the first and last bytes of the chunk were
+	// written. The runtime flushes trace data with a delay of up to about
+	// a second, so pad time ranges accordingly.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ChunksBetween returns the chunks written between from and to.
+// Execution traces are only decodable from their header, which is at the
+// start of the first chunk.
+func (a Artifact) ChunksBetween(from, to time.Time) []Chunk {
+	var out []Chunk
+	for _, c := range a.Chunks {
+		if !c.End.Before(from) && !c.Start.After(to) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+
+// ReadChunk reads and decompresses one chunk, e.g. from an HTTPFile.
+func ReadChunk(r io.ReaderAt, c Chunk) ([]byte, error) {
+	frame := make([]byte, c.Size)
+	if _, err := r.ReadAt(frame, c.Offset); err != nil {
+		return nil, err
+	}
+	return zstdDecoder.DecodeAll(frame, make([]byte, 0, c.RawSize))
+}
+
+// ErrEncrypted is returned for artifacts that need decrypting first.
+var ErrEncrypted = errors.New("artifact is encrypted")
+
+// OpenArtifact opens an artifact for reading its uncompressed contents.
+// Encrypted artifacts fail with ErrEncrypted.
+func OpenArtifact(a Artifact) (io.ReadCloser, error) {
+	if a.Encryption != "" {
+		return nil, fmt.Errorf("%s: %w", a.Path, ErrEncrypted)
+	}
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch a.Compression {
+	case "":
+		return f, nil
+	case CompressionZstdSeekable:
+		d, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &zstdFile{d, f}, nil
+	}
+	f.Close()
+	return nil, fmt.Errorf("%s: unknown compression %q", a.Path, a.Compression)
+}
+
+type zstdFile struct {
+	*zstd.Decoder
+	f *os.File
+}
+
+func (z *zstdFile) Close() error {
+	z.Decoder.Close()
+	return z.f.Close()
+}
+
+const (
+	skippableSeekMagic = 0x184D2A5E
+	seekableMagic      = 0x8F92EAB1
+)
+
+// SeekTable encodes the seek table of the zstd seekable format for chunks,
+// to be appended after the last frame.
+func SeekTable(chunks []Chunk) []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	b.Write(le.AppendUint32(nil, skippableSeekMagic))
+	b.Write(le.AppendUint32(nil, uint32(8*len(chunks)+9)))
+	for _, c := range chunks {
+		b.Write(le.AppendUint32(nil, uint32(c.Size)))
+		b.Write(le.AppendUint32(nil, uint32(c.RawSize)))
+	}
+	b.Write(le.AppendUint32(nil, uint32(len(chunks))))
+	b.WriteByte(0) // no checksums
+	b.Write(le.AppendUint32(nil, seekableMagic))
+	return b.Bytes()
+}
+
+// HTTPFile reads byte ranges of a remote file, such as the files served by
+// goprof.Handler, so that ReadChunk only downloads the chunks it needs.
+type HTTPFile struct {
+	URL string
+	// Client is http.DefaultClient by default.
+	Client *http.Client
+}
+
+func (h HTTPFile) ReadAt(p []byte, off int64) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, h.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("%s: range request: %s", h.URL, resp.Status)
+	}
+	return io.ReadFull(resp.Body, p)
+}
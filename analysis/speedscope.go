@@ -0,0 +1,123 @@
+package analysis
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/google/pprof/profile"
+)
+
+// NamedProfile is a profile with the name it is shown under.
+type NamedProfile struct {
+	Name    string
+	Profile *profile.Profile
+}
+
+// The speedscope file format, https://www.speedscope.app/file-format-schema.json.
+type speedscopeFile struct {
+	Schema             string              `json:"$schema"`
+	Name               string              `json:"name,omitempty"`
+	Exporter           string              `json:"exporter"`
+	ActiveProfileIndex int                 `json:"activeProfileIndex"`
+	Shared             speedscopeShared    `json:"shared"`
+	Profiles           []speedscopeProfile `json:"profiles"`
+}
+
+type speedscopeShared struct {
+	Frames []speedscopeFrame `json:"frames"`
+}
+
+type speedscopeFrame struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+	Line int64  `json:"line,omitempty"`
+}
+
+type speedscopeProfile struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	StartValue int64   `json:"startValue"`
+	EndValue   int64   `json:"endValue"`
+	Samples    [][]int `json:"samples"`
+	Weights    []int64 `json:"weights"`
+}
+
+// WriteSpeedscope writes profs as one speedscope file called name,
+// https://www.speedscope.app, with a profile for each of their sample
+// types. The default sample type of the first one is shown first.
+func WriteSpeedscope(w io.Writer, name string, profs ...NamedProfile) error {
+	f := speedscopeFile{
+		Schema:   "https://www.speedscope.app/file-format-schema.json",
+		Name:     name,
+		Exporter: "goprof",
+		Shared:   speedscopeShared{Frames: []speedscopeFrame{}},
+		Profiles: []speedscopeProfile{},
+	}
+	frames := map[speedscopeFrame]int{}
+	frame := func(l profile.Line) int {
+		// one frame per function, like FlameGraph, not per line
+		fr := speedscopeFrame{Name: functionName(l)}
+		if l.Function != nil {
+			fr.File, fr.Line = l.Function.Filename, l.Function.StartLine
+		}
+		i, ok := frames[fr]
+		if !ok {
+			i = len(f.Shared.Frames)
+			frames[fr] = i
+			f.Shared.Frames = append(f.Shared.Frames, fr)
+		}
+		return i
+	}
+	for n, np := range profs {
+		prof := np.Profile
+		if len(prof.SampleType) == 0 {
+			continue
+		}
+		// the stacks are the same for every sample type
+		stacks := make([][]int, len(prof.Sample))
+		for i, s := range prof.Sample {
+			stacks[i] = []int{}
+			// locations are leaf first, and so are the inlined lines of each
+			for j := len(s.Location) - 1; j >= 0; j-- {
+				lines := s.Location[j].Line
+				for k := len(lines) - 1; k >= 0; k-- {
+					stacks[i] = append(stacks[i], frame(lines[k]))
+				}
+			}
+		}
+		if n == 0 {
+			f.ActiveProfileIndex = len(f.Profiles) + valueIndex(prof, "")
+		}
+		for t, st := range prof.SampleType {
+			p := speedscopeProfile{
+				Type:    "sampled",
+				Name:    st.Type,
+				Unit:    speedscopeUnit(st.Unit),
+				Samples: [][]int{},
+				Weights: []int64{},
+			}
+			if np.Name != "" {
+				p.Name = np.Name + " " + st.Type
+			}
+			for i, s := range prof.Sample {
+				if v := s.Value[t]; v > 0 {
+					p.Samples = append(p.Samples, stacks[i])
+					p.Weights = append(p.Weights, v)
+					p.EndValue += v
+				}
+			}
+			f.Profiles = append(f.Profiles, p)
+		}
+	}
+	return json.NewEncoder(w).Encode(f)
+}
+
+// speedscopeUnit is the speedscope unit of a pprof sample unit.
+func speedscopeUnit(unit string) string {
+	switch unit {
+	case "nanoseconds", "microseconds", "milliseconds", "seconds", "bytes":
+		return unit
+	}
+	return "none"
+}
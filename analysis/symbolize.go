@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// Symbolizer fills in function names and source lines for the locations of
+// a profile that have none, e.g. profiles imported from tools that only
+// record addresses.
+type Symbolizer interface {
+	Symbolize(prof *profile.Profile) error
+}
+
+var (
+	symbolizerMu sync.Mutex
+	symbolizer   Symbolizer
+)
+
+// SetSymbolizer makes ReadProfile, and so every report, run profiles with
+// unsymbolized locations through s. nil turns symbolization off.
+func SetSymbolizer(s Symbolizer) {
+	symbolizerMu.Lock()
+	defer symbolizerMu.Unlock()
+	symbolizer = s
+}
+
+func symbolize(prof *profile.Profile) error {
+	symbolizerMu.Lock()
+	s := symbolizer
+	symbolizerMu.Unlock()
+	if s == nil {
+		return nil
+	}
+	for _, loc := range prof.Location {
+		if len(loc.Line) == 0 {
+			return s.Symbolize(prof)
+		}
+	}
+	return nil
+}
+
+// SymbolFile symbolizes the main binary of a profile from Path: an
+// unstripped build of the same binary, or its split debug file.
+type SymbolFile struct {
+	Path string
+}
+
+func (s SymbolFile) Symbolize(prof *profile.Profile) error {
+	if len(prof.Mapping) == 0 {
+		return nil
+	}
+	// by convention the first mapping is the main binary
+	return symbolizeMapping(prof, prof.Mapping[0], s.Path)
+}
+
+// Debuginfod fetches debug files by build id from debuginfod servers and
+// symbolizes every mapping that has a build id.
+type Debuginfod struct {
+	// URLs defaults to DEBUGINFOD_URLS.
+	URLs []string
+	// CacheDir defaults to goprof/debuginfod in the user cache directory.
+	CacheDir string
+	// Client is http.DefaultClient by default.
+	Client *http.Client
+}
+
+func (d Debuginfod) Symbolize(prof *profile.Profile) error {
+	var errs []error
+	for _, m := range prof.Mapping {
+		if m.BuildID == "" {
+			continue
+		}
+		path, err := d.fetch(m.BuildID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := symbolizeMapping(prof, m, path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d Debuginfod) fetch(buildID string) (string, error) {
+	if strings.ContainsAny(buildID, `/\.`) {
+		return "", fmt.Errorf("debuginfod: bad build id %q", buildID)
+	}
+	dir := d.CacheDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(cache, "goprof", "debuginfod")
+	}
+	path := filepath.Join(dir, buildID)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	urls := d.URLs
+	if len(urls) == 0 {
+		urls = strings.Fields(os.Getenv("DEBUGINFOD_URLS"))
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for _, base := range urls {
+		for _, kind := range []string{"debuginfo", "executable"} {
+			resp, err := client.Get(strings.TrimSuffix(base, "/") + "/buildid/" + buildID + "/" + kind)
+			if err != nil {
+				return "", fmt.Errorf("debuginfod: %w", err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				resp.Body.Close()
+				continue
+			}
+			err = saveFile(path, resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return "", err
+			}
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("debuginfod: build id %s not found", buildID)
+}
+
+func saveFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// symbolizeMapping fills in the locations of m from the ELF file at path.
+func symbolizeMapping(prof *profile.Profile, m *profile.Mapping, path string) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return fmt.Errorf("symbolize: %w", err)
+	}
+	defer f.Close()
+	syms := newELFSymbols(f)
+
+	funcs := map[string]*profile.Function{}
+	for _, fn := range prof.Function {
+		funcs[fn.Name+"\x00"+fn.Filename] = fn
+	}
+	function := func(name, file string) *profile.Function {
+		key := name + "\x00" + file
+		if fn := funcs[key]; fn != nil {
+			return fn
+		}
+		fn := &profile.Function{ID: uint64(len(prof.Function) + 1), Name: name, SystemName: name, Filename: file}
+		prof.Function = append(prof.Function, fn)
+		funcs[key] = fn
+		return fn
+	}
+
+	found := false
+	for _, loc := range prof.Location {
+		if loc.Mapping != m || len(loc.Line) > 0 {
+			continue
+		}
+		pc, ok := fileAddress(f, m, loc.Address)
+		if !ok {
+			continue
+		}
+		name, file, line := syms.lookup(pc)
+		if name == "" {
+			continue
+		}
+		loc.Line = []profile.Line{{Function: function(name, file), Line: int64(line)}}
+		found = true
+	}
+	if found {
+		m.HasFunctions, m.HasFilenames, m.HasLineNumbers = true, true, true
+	}
+	return nil
+}
+
+// fileAddress turns a runtime address of mapping m into an address of the
+// ELF file, which differ for position independent executables. Split debug
+// files keep the program headers but not their file offsets and sizes, so
+// only the executable segment's addresses are relied on.
+func fileAddress(f *elf.File, m *profile.Mapping, addr uint64) (uint64, bool) {
+	if addr < m.Start || addr >= m.Limit {
+		return 0, false
+	}
+	if f.Type == elf.ET_EXEC {
+		return addr, true
+	}
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && p.Flags&elf.PF_X != 0 {
+			pc := addr - m.Start + m.Offset - p.Off + p.Vaddr
+			return pc, pc >= p.Vaddr && pc < p.Vaddr+p.Memsz
+		}
+	}
+	return 0, false
+}
+
+// elfSymbols looks up addresses in the Go line table if the file has one,
+// and otherwise in the symbol table and DWARF line info.
+type elfSymbols struct {
+	table *gosym.Table
+	syms  []elf.Symbol // functions, by address
+	dwarf *dwarf.Data
+}
+
+func newELFSymbols(f *elf.File) *elfSymbols {
+	s := &elfSymbols{}
+	if sect, text := f.Section(".gopclntab"), f.Section(".text"); sect != nil && sect.Type != elf.SHT_NOBITS && text != nil {
+		if data, err := sect.Data(); err == nil {
+			if t, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr)); err == nil {
+				s.table = t
+			}
+		}
+	}
+	if syms, err := f.Symbols(); err == nil {
+		for _, sym := range syms {
+			if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Value != 0 {
+				s.syms = append(s.syms, sym)
+			}
+		}
+		sort.Slice(s.syms, func(i, j int) bool { return s.syms[i].Value < s.syms[j].Value })
+	}
+	s.dwarf, _ = f.DWARF()
+	return s
+}
+
+func (s *elfSymbols) lookup(pc uint64) (name, file string, line int) {
+	if s.table != nil {
+		if file, line, fn := s.table.PCToLine(pc); fn != nil {
+			return fn.Name, file, line
+		}
+	}
+	i := sort.Search(len(s.syms), func(i int) bool { return s.syms[i].Value > pc }) - 1
+	if i < 0 {
+		return "", "", 0
+	}
+	sym := s.syms[i]
+	if sym.Size > 0 && pc >= sym.Value+sym.Size {
+		return "", "", 0
+	}
+	file, line = s.dwarfLine(pc)
+	// the Go linker marks assembly functions with their ABI
+	return strings.TrimSuffix(sym.Name, ".abi0"), file, line
+}
+
+func (s *elfSymbols) dwarfLine(pc uint64) (string, int) {
+	if s.dwarf == nil {
+		return "", 0
+	}
+	r := s.dwarf.Reader()
+	cu, err := r.SeekPC(pc)
+	if err != nil {
+		return "", 0
+	}
+	lr, err := s.dwarf.LineReader(cu)
+	if err != nil || lr == nil {
+		return "", 0
+	}
+	var entry dwarf.LineEntry
+	if err := lr.SeekPC(pc, &entry); err != nil {
+		return "", 0
+	}
+	return entry.File.Name, entry.Line
+}
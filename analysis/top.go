@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// FuncStat is the weight of one function in a profile.
+type FuncStat struct {
+	Name string `json:"name"`
+	Flat int64  `json:"flat"` // in the function itself
+	Cum  int64  `json:"cum"`  // in the function and everything it called
+	// FlatPct and CumPct are relative to the profile total.
+	FlatPct float64 `json:"flat_pct"`
+	CumPct  float64 `json:"cum_pct"`
+}
+
+// ReadProfile parses a pprof file, symbolizing it if a Symbolizer is set.
+func ReadProfile(path string) (*profile.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseProfile(f, path)
+}
+
+// ReadProfileFS is ReadProfile for a profile in fsys.
+func ReadProfileFS(fsys fs.FS, path string) (*profile.Profile, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseProfile(f, path)
+}
+
+func parseProfile(r io.Reader, path string) (*profile.Profile, error) {
+	prof, err := profile.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := symbolize(prof); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return prof, nil
+}
+
+// valueIndex picks the sample value to rank by: sampleType if the profile
+// has it, otherwise the profile's default, otherwise the last one
+// (cpu/nanoseconds for CPU profiles).
+func valueIndex(prof *profile.Profile, sampleType string) int {
+	if sampleType == "" {
+		sampleType = prof.DefaultSampleType
+	}
+	for i, st := range prof.SampleType {
+		if st.Type == sampleType {
+			return i
+		}
+	}
+	return len(prof.SampleType) - 1
+}
+
+// Unit is the unit of the value sampleType selects, e.g. "nanoseconds".
+func Unit(prof *profile.Profile, sampleType string) string {
+	if len(prof.SampleType) == 0 {
+		return ""
+	}
+	return prof.SampleType[valueIndex(prof, sampleType)].Unit
+}
+
+// Top ranks the functions of prof by flat weight and returns the first n,
+// or all of them when n <= 0. sampleType selects the value to rank by,
+// e.g. "inuse_space" for heap profiles; "" picks a sensible default.
+func Top(prof *profile.Profile, sampleType string, n int) []FuncStat {
+	if len(prof.SampleType) == 0 {
+		return nil
+	}
+	idx := valueIndex(prof, sampleType)
+	stats := map[string]*FuncStat{}
+	stat := func(name string) *FuncStat {
+		if stats[name] == nil {
+			stats[name] = &FuncStat{Name: name}
+		}
+		return stats[name]
+	}
+	var total int64
+	for _, s := range prof.Sample {
+		v := s.Value[idx]
+		total += v
+		seen := map[string]bool{}
+		for i, loc := range s.Location {
+			for j, line := range loc.Line {
+				name := functionName(line)
+				// the first line of the first location is the leaf
+				if i == 0 && j == 0 {
+					stat(name).Flat += v
+				}
+				if !seen[name] {
+					seen[name] = true
+					stat(name).Cum += v
+				}
+			}
+		}
+	}
+
+	out := make([]FuncStat, 0, len(stats))
+	for _, s := range stats {
+		if total != 0 {
+			s.FlatPct = 100 * float64(s.Flat) / float64(total)
+			s.CumPct = 100 * float64(s.Cum) / float64(total)
+		}
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Flat != out[j].Flat {
+			return out[i].Flat > out[j].Flat
+		}
+		if out[i].Cum != out[j].Cum {
+			return out[i].Cum > out[j].Cum
+		}
+		return out[i].Name < out[j].Name
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func functionName(line profile.Line) string {
+	if line.Function == nil {
+		return "(unknown)"
+	}
+	return line.Function.Name
+}
@@ -0,0 +1,38 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+
+	"github.com/google/pprof/profile"
+)
+
+// TraceProfileKinds are the profiles go tool trace -pprof derives from an
+// execution trace: scheduler, synchronization, syscall and network waits.
+var TraceProfileKinds = []string{"sched", "sync", "syscall", "net"}
+
+// TraceProfiles derives the profiles of the given kinds, TraceProfileKinds
+// if none are given, from the uncompressed execution trace at path. It runs
+// go tool trace, so it needs the Go toolchain.
+func TraceProfiles(path string, kinds ...string) ([]NamedProfile, error) {
+	if len(kinds) == 0 {
+		kinds = TraceProfileKinds
+	}
+	var profs []NamedProfile
+	for _, kind := range kinds {
+		var stderr bytes.Buffer
+		cmd := exec.Command("go", "tool", "trace", "-pprof="+kind, path)
+		cmd.Stderr = &stderr
+		b, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("go tool trace -pprof=%s: %w: %s", kind, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		prof, err := profile.ParseData(b)
+		if err != nil {
+			return nil, fmt.Errorf("go tool trace -pprof=%s: %w", kind, err)
+		}
+		profs = append(profs, NamedProfile{Name: kind, Profile: prof})
+	}
+	return profs, nil
+}
@@ -0,0 +1,109 @@
+//go:build linux
+
+package goprof
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readCgroupCPU reads the CPU quota and throttling counters of the cgroup
+// the process runs in, v2 or v1.
+func readCgroupCPU() cgroupCPU {
+	b, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return cgroupCPU{}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			for _, dir := range []string{filepath.Join("/sys/fs/cgroup", parts[2]), "/sys/fs/cgroup"} {
+				if c, ok := readCgroupV2(dir); ok {
+					return c
+				}
+			}
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller != "cpu" {
+				continue
+			}
+			for _, root := range []string{"/sys/fs/cgroup/cpu", "/sys/fs/cgroup/cpu,cpuacct"} {
+				for _, dir := range []string{filepath.Join(root, parts[2]), root} {
+					if c, ok := readCgroupV1(dir); ok {
+						return c
+					}
+				}
+			}
+		}
+	}
+	return cgroupCPU{}
+}
+
+// cpu.max is "<quota|max> <period>" in microseconds.
+func readCgroupV2(dir string) (cgroupCPU, bool) {
+	b, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+	if err != nil {
+		return cgroupCPU{}, false
+	}
+	var c cgroupCPU
+	if f := strings.Fields(string(b)); len(f) == 2 && f[0] != "max" {
+		quota, err1 := strconv.ParseFloat(f[0], 64)
+		period, err2 := strconv.ParseFloat(f[1], 64)
+		if err1 == nil && err2 == nil && period > 0 {
+			c.quota = quota / period
+		}
+	}
+	stat := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	c.periods, c.throttled = stat["nr_periods"], stat["nr_throttled"]
+	c.throttledTime = time.Duration(stat["throttled_usec"]) * time.Microsecond
+	return c, true
+}
+
+func readCgroupV1(dir string) (cgroupCPU, bool) {
+	quota, err := readInt(filepath.Join(dir, "cpu.cfs_quota_us"))
+	if err != nil {
+		return cgroupCPU{}, false
+	}
+	var c cgroupCPU
+	if period, err := readInt(filepath.Join(dir, "cpu.cfs_period_us")); err == nil && quota > 0 && period > 0 {
+		c.quota = float64(quota) / float64(period)
+	}
+	stat := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	c.periods, c.throttled = stat["nr_periods"], stat["nr_throttled"]
+	c.throttledTime = time.Duration(stat["throttled_time"])
+	return c, true
+}
+
+func readInt(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+}
+
+func readKeyValues(path string) map[string]uint64 {
+	m := map[string]uint64{}
+	f, err := os.Open(path)
+	if err != nil {
+		return m
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(sc.Text(), " "); ok {
+			if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+				m[k] = n
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package goprof
+
+// cgroups only exist on Linux.
+func readCgroupCPU() cgroupCPU {
+	return cgroupCPU{}
+}
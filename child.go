@@ -0,0 +1,108 @@
+package goprof
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// EnvSession names the session a child process starts with StartChild.
+// ProfileCmd and goprof run set it; StartChild removes it from the
+// environment once read, so grandchildren do not start one too.
+const EnvSession = "GOPROF_SESSION"
+
+var ErrChildFS = errors.New("child processes cannot write to the FS of a session")
+
+// childSession is the session started from EnvSession.
+var childSession string
+
+// StartChild starts the session the parent process asked for through
+// EnvSession, with WithCrashHandler and opts, and does nothing if there is
+// none, so programs can call it unconditionally at the top of main:
+//
+//	func main() {
+//		goprof.StartChild()
+//		defer goprof.StopChild()
+//		...
+//	}
+//
+// The session is only written by StopChild, or by the crash handler when
+// the process gets SIGTERM; a child that exits any other way, e.g. with
+// os.Exit, loses it.
+func StartChild(opts ...Option) error {
+	name := os.Getenv(EnvSession)
+	if name == "" {
+		return nil
+	}
+	os.Unsetenv(EnvSession)
+	if err := Start(name, append([]Option{WithCrashHandler()}, opts...)...); err != nil {
+		return err
+	}
+	childSession = fullName(name)
+	return nil
+}
+
+// ProfileCmd makes the child process cmd runs, if it also uses goprof,
+// profile itself as a session called name: the child starts it with
+// StartChild, writes it into <session>.children/ next to the newest
+// running session of this process, and shares its run id. The child must
+// stop the session with StopChild before it exits, or it is only written
+// by the crash handler when the child gets SIGTERM.
+//
+// When the session of this process stops, the manifests found in its
+// children directory are listed under Children in its own, so wait for
+// the children first. ProfileCmd sets cmd.Env, starting from os.Environ
+// if it is nil, and fails with ErrNotStarted if no session is running.
+func ProfileCmd(cmd *exec.Cmd, name string) error {
+	if disabled() {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	s := running("")
+	if s == nil {
+		return ErrNotStarted
+	}
+	if s.cfg.fs != nil {
+		return ErrChildFS
+	}
+	dir := s.name + ".children"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// the child may run in another working directory
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(s.children, dir) {
+		s.children = append(s.children, dir)
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, EnvRunID+"="+s.runID, EnvDir+"="+abs, EnvSession+"="+name)
+	return nil
+}
+
+// StopChild stops the session started by StartChild, if there is one,
+// and writes its files. A child that returns from main without calling it
+// leaves nothing behind for its parent.
+func StopChild() error {
+	if childSession == "" {
+		return nil
+	}
+	return Stop(childSession)
+}
+
+// childManifests lists the manifests the children of s wrote.
+func (s *session) childManifests() []string {
+	var paths []string
+	for _, dir := range s.children {
+		found, _ := filepath.Glob(filepath.Join(dir, "*.manifest.json"))
+		paths = append(paths, found...)
+	}
+	return paths
+}
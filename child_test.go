@@ -0,0 +1,33 @@
+//go:build !goprof_disabled
+
+package goprof
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStartChild(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// nothing to start without a parent
+	if err := StartChild(); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopChild(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvSession, "child")
+	if err := StartChild(WithProfiles("heap"), WithQuiet()); err != nil {
+		t.Fatal(err)
+	}
+	if v := os.Getenv(EnvSession); v != "" {
+		t.Errorf("%s still set to %q for grandchildren", EnvSession, v)
+	}
+	if err := StopChild(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("child.manifest.json"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+func checkCmd(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var t analysis.Thresholds
+	fs.Float64Var(&t.Duration, "duration", 0.1, "tolerated growth of the duration, as a fraction; 0 skips the check")
+	fs.Float64Var(&t.Alloc, "alloc", 0.1, "tolerated growth of the bytes allocated")
+	fs.Float64Var(&t.CPU, "cpu", 0.1, "tolerated growth of the total CPU time")
+	fs.Float64Var(&t.Func, "func", 0.05, "tolerated growth of any one function's CPU time, as a fraction of the baseline's total")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: goprof check [flags] baseline current\n\nbaseline and current are manifests or directories holding one.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	r, err := analysis.CheckRegression(fs.Arg(0), fs.Arg(1), t)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteText(os.Stdout); err != nil {
+		return err
+	}
+	if r.Failed() {
+		return exitError(1)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+func decryptCmd(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	keys := fs.String("i", "", "age identity file with the private key, as written by age-keygen")
+	out := fs.String("o", "", `directory to write to (default: next to a file, "decrypted" inside a bundle)`)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: goprof decrypt -i identity [-o dir] path...\n\npath is a file ending in .age, or a bundle: a manifest or a directory holding one,\nwhich is written out decrypted with a manifest of its own.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || *keys == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(*keys)
+	if err != nil {
+		return err
+	}
+	ids, err := age.ParseIdentities(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", *keys, err)
+	}
+	for _, path := range fs.Args() {
+		if strings.HasSuffix(path, analysis.EncryptedExt) {
+			dir := *out
+			if dir == "" {
+				dir = filepath.Dir(path)
+			}
+			dst := filepath.Join(dir, strings.TrimSuffix(filepath.Base(path), analysis.EncryptedExt))
+			if _, err := decryptFile(path, dst, ids); err != nil {
+				return err
+			}
+			fmt.Println(dst)
+			continue
+		}
+		if err := decryptBundle(path, *out, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptBundle writes the bundle at path to dir with its artifacts
+// decrypted and a manifest pointing at them.
+func decryptBundle(path, dir string, ids []age.Identity) error {
+	manifest, err := findManifest(path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(manifest)
+	if err != nil {
+		return err
+	}
+	// as on disk, with the paths relative to the manifest
+	var m analysis.Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("%s: %w", manifest, err)
+	}
+	from := filepath.Dir(manifest)
+	if dir == "" {
+		dir = filepath.Join(from, "decrypted")
+	}
+	for i, a := range m.Artifacts {
+		src, rel := a.Path, a.Path
+		if filepath.IsAbs(a.Path) {
+			rel = filepath.Base(a.Path)
+		} else {
+			src = filepath.Join(from, a.Path)
+		}
+		dst := filepath.Join(dir, strings.TrimSuffix(rel, analysis.EncryptedExt))
+		var n int64
+		if a.Encryption != "" {
+			n, err = decryptFile(src, dst, ids)
+		} else {
+			n, err = copyFile(src, dst)
+		}
+		if err != nil {
+			return err
+		}
+		a.Path, a.Size, a.Encryption = strings.TrimSuffix(rel, analysis.EncryptedExt), n, ""
+		m.Artifacts[i] = a
+	}
+	b, err = json.MarshalIndent(&m, "", "  ")
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, filepath.Base(manifest))
+	if err := os.WriteFile(dst, b, 0o644); err != nil {
+		return err
+	}
+	fmt.Println(dst)
+	return nil
+}
+
+// findManifest is the manifest path names, or the only one in it if it is
+// a directory.
+func findManifest(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return path, err
+	}
+	paths, err := filepath.Glob(filepath.Join(path, "*.manifest.json"))
+	if err != nil {
+		return "", err
+	}
+	if len(paths) != 1 {
+		return "", fmt.Errorf("%s: expected one manifest, found %d", path, len(paths))
+	}
+	return paths[0], nil
+}
+
+// decryptFile decrypts src into dst and returns the size of dst.
+func decryptFile(src, dst string, ids []age.Identity) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	r, err := age.Decrypt(in, ids...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", src, err)
+	}
+	return writeTo(dst, r)
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	return writeTo(dst, in)
+}
+
+// writeTo writes r to the file dst, creating its directory.
+func writeTo(dst string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		os.Remove(dst)
+		return 0, fmt.Errorf("%s: %w", dst, err)
+	}
+	return n, f.Close()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+func exportCmd(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "speedscope", `output format: "speedscope" JSON or "folded" stacks`)
+	out := fs.String("o", "", "file to write (default: stdout)")
+	kinds := fs.String("trace", strings.Join(analysis.TraceProfileKinds, ","), "profiles to derive from an execution trace, with go tool trace -pprof")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: goprof export [flags] file\n\nfile is a pprof profile or an execution trace, .zst compressed or not.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || (*format != "speedscope" && *format != "folded") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	if strings.HasSuffix(path, ".zst") {
+		var err error
+		a := analysis.Artifact{Path: path, Compression: analysis.CompressionZstdSeekable}
+		if path, err = decompress(a); err != nil {
+			return err
+		}
+	}
+
+	var profs []analysis.NamedProfile
+	isTrace, err := isTrace(path)
+	if err != nil {
+		return err
+	}
+	if isTrace {
+		if profs, err = analysis.TraceProfiles(path, strings.Split(*kinds, ",")...); err != nil {
+			return err
+		}
+	} else {
+		prof, err := analysis.ReadProfile(path)
+		if err != nil {
+			return err
+		}
+		profs = append(profs, analysis.NamedProfile{Profile: prof})
+	}
+
+	w, closeOut := io.Writer(os.Stdout), func() error { return nil }
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		w, closeOut = f, f.Close
+	}
+	bw := bufio.NewWriter(w)
+	if *format == "speedscope" {
+		err = analysis.WriteSpeedscope(bw, filepath.Base(path), profs...)
+	} else {
+		err = writeFolded(bw, profs)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := closeOut(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeFolded writes the stacks of profs with their default values, under
+// a root frame named after each profile if there are several.
+func writeFolded(w io.Writer, profs []analysis.NamedProfile) error {
+	if len(profs) == 1 {
+		return analysis.WriteFolded(w, analysis.FlameGraph(profs[0].Profile, ""))
+	}
+	root := &analysis.FlameNode{Name: "all"}
+	for _, p := range profs {
+		n := analysis.FlameGraph(p.Profile, "")
+		n.Name = p.Name
+		root.Value += n.Value
+		root.Children = append(root.Children, n)
+	}
+	return analysis.WriteFolded(w, root)
+}
+
+// isTrace reports whether path holds an execution trace, which starts
+// with a header like "go 1.23 trace".
+func isTrace(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 16)
+	n, _ := io.ReadFull(f, head)
+	return bytes.HasPrefix(head[:n], []byte("go 1.")), nil
+}
@@ -0,0 +1,64 @@
+// Command goprof profiles programs from the outside and works with the
+// bundles they leave behind.
+//
+//	goprof run [flags] -- ./myprogram args...
+//	goprof serve [flags] [dir]
+//	goprof check [flags] baseline current
+//	goprof export [flags] file
+//	goprof decrypt -i identity [-o dir] path...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"run", "run a program and collect its profiles into a run directory", runCmd},
+	{"serve", "browse collected runs and open them in pprof and the trace viewer", serveCmd},
+	{"check", "fail when a bundle regressed against a baseline", checkCmd},
+	{"export", "convert a profile or trace to speedscope JSON or folded stacks", exportCmd},
+	{"decrypt", "decrypt the artifacts of bundles written with WithEncryption", decryptCmd},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: goprof <command> [arguments]\n\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == flag.Arg(0) {
+			if err := c.run(flag.Args()[1:]); err != nil {
+				if e, ok := err.(exitError); ok {
+					os.Exit(int(e))
+				}
+				fmt.Fprintf(os.Stderr, "goprof %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "goprof: unknown command %q\n", flag.Arg(0))
+	usage()
+}
+
+// exitError makes goprof exit with the code of the program it ran.
+type exitError int
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jcocozza/goprof"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+func runCmd(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	dir := fs.String("dir", "profiles", "directory to create the run directory in")
+	name := fs.String("name", "", "name of the program's own session (default: its base name)")
+	gctrace := fs.Bool("gctrace", true, "record the program's GODEBUG=gctrace=1 output")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: goprof run [flags] -- program [args...]\n\nPrograms that use goprof profile themselves as the session -name if main calls\ngoprof.StartChild() and defer goprof.StopChild(); without StopChild the session\nis only written on SIGTERM.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	prog := fs.Args()
+	if *name == "" {
+		*name = filepath.Base(prog[0])
+	}
+
+	runID := goprof.RunID()
+	runDir := filepath.Join(*dir, runID)
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		return err
+	}
+	// the program may write its own sessions into runDir, under any name
+	session := filepath.Join(runDir, *name+".process")
+	// the program may change its working directory
+	absDir, err := filepath.Abs(runDir)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(prog[0], prog[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// as goprof.ProfileCmd does, so a program using goprof profiles itself
+	// as the session *name of this run
+	cmd.Env = append(os.Environ(), goprof.EnvDir+"="+absDir, goprof.EnvRunID+"="+runID, goprof.EnvSession+"="+*name)
+	var trace *gctraceWriter
+	if *gctrace {
+		f, err := os.Create(analysis.FileName(session, "gctrace"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		trace = &gctraceWriter{log: f, stderr: os.Stderr}
+		cmd.Stderr = trace
+		cmd.Env = append(cmd.Env, "GODEBUG="+godebug(os.Getenv("GODEBUG"), "gctrace=1"))
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// the terminal signals the whole process group, but kill(1) does not
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range sigs {
+			cmd.Process.Signal(sig)
+		}
+	}()
+	waitErr := cmd.Wait()
+	end := time.Now()
+	signal.Stop(sigs)
+	close(sigs)
+
+	var exit *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exit) {
+		return waitErr
+	}
+	m := &analysis.Manifest{
+		Name:      session,
+		RunID:     runID,
+		PID:       cmd.Process.Pid,
+		GoVersion: runtime.Version(),
+		Start:     start,
+		End:       end,
+		Duration:  end.Sub(start),
+	}
+	m.Host, _ = os.Hostname()
+	if trace != nil {
+		trace.flush()
+		a := analysis.Artifact{Type: "gctrace", Path: filepath.Base(analysis.FileName(session, "gctrace"))}
+		if info, err := os.Stat(analysis.FileName(session, "gctrace")); err == nil {
+			a.Size = info.Size()
+		}
+		m.Artifacts = append(m.Artifacts, a)
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(analysis.ManifestName(session), b, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr)
+	if err := summarize(os.Stderr, runDir, runID, cmd.ProcessState, trace); err != nil {
+		// the program's exit code matters more than the summary
+		fmt.Fprintf(os.Stderr, "goprof: run: no summary: %v\n", err)
+	}
+	if code := cmd.ProcessState.ExitCode(); code != 0 {
+		return exitError(max(code, 1))
+	}
+	return nil
+}
+
+// godebug adds setting to the GODEBUG value cur.
+func godebug(cur, setting string) string {
+	if cur == "" {
+		return setting
+	}
+	return cur + "," + setting
+}
+
+func summarize(w io.Writer, runDir, runID string, state *os.ProcessState, trace *gctraceWriter) error {
+	r, err := analysis.LoadRun(runDir, runID)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteText(w); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s, user %s, system %s\n", state, state.UserTime(), state.SystemTime())
+	if trace != nil {
+		fmt.Fprintf(w, "%d GCs, %s stop-the-world\n", trace.gcs, trace.pause)
+	}
+	for _, s := range r.Stages {
+		if s.Memory != nil {
+			fmt.Fprintf(w, "%s: %s\n", filepath.Base(s.Name), s.Memory)
+		}
+		a, ok := s.Artifact("cpu")
+		if !ok {
+			continue
+		}
+		if prof, err := analysis.ReadProfile(a.Path); err != nil {
+			// encrypted, or cut short; the commands still apply
+			fmt.Fprintf(w, "  %v\n", err)
+		} else {
+			for _, f := range analysis.Top(prof, "", 5) {
+				fmt.Fprintf(w, "  %6.1f%%  %s\n", f.FlatPct, f.Name)
+			}
+		}
+		for _, c := range goprof.CommandList(s.Name) {
+			fmt.Fprintf(w, "  %s\n", c)
+		}
+	}
+	fmt.Fprintf(w, "profiles in %s\n", runDir)
+	return nil
+}
+
+// gctraceWriter passes the program's stderr through, except for the
+// gctrace lines, which it writes to log and tallies.
+type gctraceWriter struct {
+	log    io.Writer
+	stderr io.Writer
+
+	mu    sync.Mutex
+	line  []byte // partial line
+	gcs   int
+	pause time.Duration
+}
+
+func (g *gctraceWriter) Write(b []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := len(b)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			g.line = append(g.line, b...)
+			break
+		}
+		g.line = append(g.line, b[:i+1]...)
+		b = b[i+1:]
+		g.writeLine()
+	}
+	return n, nil
+}
+
+func (g *gctraceWriter) flush() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.line) > 0 {
+		g.writeLine()
+	}
+}
+
+func (g *gctraceWriter) writeLine() {
+	line := g.line
+	g.line = g.line[:0]
+	pause, ok := parseGCTrace(string(line))
+	if !ok {
+		g.stderr.Write(line)
+		return
+	}
+	g.log.Write(line)
+	g.gcs++
+	g.pause += pause
+}
+
+// parseGCTrace returns the stop-the-world time of a gctrace line like
+// "gc 4 @0.012s 2%: 0.018+0.51+0.003 ms clock, ..."; the first and last
+// clock phases are the sweep and mark termination pauses.
+func parseGCTrace(line string) (time.Duration, bool) {
+	rest, ok := strings.CutPrefix(line, "gc ")
+	if !ok {
+		return 0, false
+	}
+	num, rest, ok := strings.Cut(rest, " @")
+	if _, err := strconv.Atoi(num); !ok || err != nil {
+		return 0, false
+	}
+	_, rest, ok = strings.Cut(rest, ": ")
+	if !ok {
+		return 0, true
+	}
+	clock, _, _ := strings.Cut(rest, " ms clock")
+	phases := strings.Split(clock, "+")
+	if len(phases) != 3 {
+		return 0, true
+	}
+	var ms float64
+	for _, i := range []int{0, 2} {
+		v, err := strconv.ParseFloat(phases[i], 64)
+		if err != nil {
+			return 0, true
+		}
+		ms += v
+	}
+	return time.Duration(ms * float64(time.Millisecond)), true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseGCTrace(t *testing.T) {
+	for _, tt := range []struct {
+		line  string
+		pause time.Duration
+		gc    bool
+	}{
+		{"gc 4 @0.012s 2%: 0.018+0.51+0.003 ms clock, 0.14+0.20/0.40/0.10+0.024 ms cpu, 4->4->0 MB, 4 MB goal, 0 MB stacks, 0 MB globals, 8 P\n", 21 * time.Microsecond, true},
+		{"gc 1 @0.001s 0%: 1+2+3 ms clock, 4 MB goal", 4 * time.Millisecond, true},
+		{"gc 12 @1.5s 1%: 0+0.2+0 ms clock", 0, true},
+		// a gc line goprof does not understand is still not the program's
+		{"gc 4 @0.012s 2% 0.018+0.51+0.003 ms clock", 0, true},
+		{"gc 4 @0.012s 2%: 0.018+0.51 ms clock", 0, true},
+		{"gc 4 @0.012s 2%: x+0.51+0.003 ms clock", 0, true},
+		{"gc 4 @0.012s 2%: 0.018+0.51+y ms clock", 0, true},
+		// the program's own output
+		{"gc", 0, false},
+		{"gc 4", 0, false},
+		{"gc four @0.012s 2%: 0.018+0.51+0.003 ms clock", 0, false},
+		{"gc collecting things @home", 0, false},
+		{" gc 4 @0.012s 2%: 0.018+0.51+0.003 ms clock", 0, false},
+		{"scvg: 0 MB released", 0, false},
+		{"", 0, false},
+	} {
+		pause, gc := parseGCTrace(tt.line)
+		if gc != tt.gc || pause.Round(time.Microsecond) != tt.pause {
+			t.Errorf("parseGCTrace(%q) = %v, %v, want %v, %v", tt.line, pause, gc, tt.pause, tt.gc)
+		}
+	}
+}
+
+func TestGCTraceWriter(t *testing.T) {
+	var log, stderr bytes.Buffer
+	g := &gctraceWriter{log: &log, stderr: &stderr}
+	// lines split across writes, as a pipe delivers them
+	out := "panic: oops\ngc 1 @0.001s 0%: 1+2+3 ms clock\ngc 2 @0.002s 0%: 0.5+2+0.5 ms clock\nexit status 2"
+	for i := 0; i < len(out); i += 7 {
+		if _, err := fmt.Fprint(g, out[i:min(i+7, len(out))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.flush()
+	if got, want := stderr.String(), "panic: oops\nexit status 2"; got != want {
+		t.Errorf("stderr %q, want %q", got, want)
+	}
+	if got, want := log.String(), "gc 1 @0.001s 0%: 1+2+3 ms clock\ngc 2 @0.002s 0%: 0.5+2+0.5 ms clock\n"; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+	if g.gcs != 2 || g.pause != 5*time.Millisecond {
+		t.Errorf("%d gcs, %v paused, want 2, 5ms", g.gcs, g.pause)
+	}
+}
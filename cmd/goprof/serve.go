@@ -0,0 +1,379 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jcocozza/goprof"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+func serveCmd(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: goprof serve [flags] [dir]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	root := "profiles"
+	if fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	host, _, err := net.SplitHostPort(*addr)
+	if err != nil {
+		return err
+	}
+	s := &server{root: root, host: host, uis: map[string]*toolUI{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.index)
+	mux.HandleFunc("GET /run/{id}", s.run)
+	mux.HandleFunc("GET /open", s.open)
+	mux.Handle("GET /files/", goprof.Handler{Dir: root})
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "goprof: serving %s at http://%s\n", root, l.Addr())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		s.close()
+		os.Exit(0)
+	}()
+	return http.Serve(l, mux)
+}
+
+type server struct {
+	root string
+	host string // the UIs listen on the same interface as the server
+
+	mu  sync.Mutex
+	uis map[string]*toolUI // by artifact path
+}
+
+// runs reads the manifests in root and in its run directories, newest
+// run first, with warnings about those it could not read.
+func (s *server) runs() ([]analysis.RunReport, []string, error) {
+	return analysis.ListRuns(s.root)
+}
+
+func (s *server) find(id string) (analysis.RunReport, bool) {
+	runs, _, err := s.runs()
+	if err != nil {
+		return analysis.RunReport{}, false
+	}
+	for _, r := range runs {
+		if r.RunID == id {
+			return r, true
+		}
+	}
+	return analysis.RunReport{}, false
+}
+
+// warnings counts the warnings of the sessions of r.
+func warnings(r analysis.RunReport) int {
+	n := 0
+	for _, s := range r.Stages {
+		n += len(s.Warnings)
+	}
+	return n
+}
+
+var funcs = template.FuncMap{
+	"warnings": warnings,
+	"base":     filepath.Base,
+	"bytes":    analysis.FormatBytes,
+	"ms":       func(d time.Duration) time.Duration { return d.Round(time.Millisecond) },
+	"time":     func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+}
+
+var indexTemplate = template.Must(template.New("index").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>goprof: {{.Root}}</title></head>
+<body style="font-family: sans-serif">
+<h1>{{.Root}}</h1>
+{{- range .Warnings}}
+<p style="color: #b00">WARNING: {{.}}</p>
+{{- end}}
+<table cellpadding="4">
+<tr><th align="left">run</th><th align="left">start</th><th align="right">elapsed</th><th align="left">sessions</th><th align="right">warnings</th></tr>
+{{- range .Runs}}
+<tr><td><a href="/run/{{.RunID}}">{{.RunID}}</a></td><td>{{time (index .Stages 0).Start}}</td><td align="right">{{ms .Elapsed}}</td><td>{{range $i, $s := .Stages}}{{if $i}}, {{end}}{{base $s.Name}}{{end}}</td><td align="right">{{warnings .}}</td></tr>
+{{- else}}
+<tr><td colspan="5">no runs yet</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+var runTemplate = template.Must(template.New("run").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>goprof: run {{.RunID}}</title></head>
+<body style="font-family: sans-serif">
+<p><a href="/">all runs</a></p>
+<h1>Run {{.RunID}}</h1>
+{{- range .Stages}}
+<h2>{{base .Name}}</h2>
+<table cellpadding="2">
+<tr><td>pid</td><td>{{.PID}}{{if .Host}} on {{.Host}}{{end}}</td></tr>
+{{- if .GoVersion}}<tr><td>go</td><td>{{.GoVersion}}</td></tr>{{end}}
+<tr><td>start</td><td>{{time .Start}}</td></tr>
+<tr><td>duration</td><td>{{ms .Duration}}</td></tr>
+{{- if .Memory}}<tr><td>memory</td><td>{{.Memory}}</td></tr>{{end}}
+</table>
+{{- range .Warnings}}
+<p style="color: #b00">WARNING: {{.}}</p>
+{{- end}}
+<table cellpadding="4">
+{{- $stage := .Name}}
+{{- range .Artifacts}}
+<tr><td>{{.Type}}</td><td><a href="/files/{{$.Rel .Path}}">{{base .Path}}</a></td><td align="right">{{bytes .Size}}</td>
+<td>{{if $.Viewable .}}<a href="/open?run={{$.RunID}}&amp;session={{$stage}}&amp;type={{.Type}}">open</a>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	runs, warnings, err := s.runs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	indexTemplate.Execute(w, struct {
+		Root     string
+		Runs     []analysis.RunReport
+		Warnings []string
+	}{s.root, runs, warnings})
+}
+
+// runPage is what runTemplate renders.
+type runPage struct {
+	analysis.RunReport
+	root string
+}
+
+// Rel is the path of an artifact below /files/.
+func (p runPage) Rel(path string) string {
+	rel, err := filepath.Rel(p.root, path)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Viewable reports whether go tool pprof or go tool trace opens a.
+func (p runPage) Viewable(a analysis.Artifact) bool {
+	return toolFor(a) != ""
+}
+
+func toolFor(a analysis.Artifact) string {
+	path := strings.TrimSuffix(a.Path, ".zst")
+	switch {
+	case a.Type == "trace":
+		return "trace"
+	case strings.HasSuffix(path, ".pprof"), strings.HasSuffix(path, ".prof"):
+		return "pprof"
+	}
+	return ""
+}
+
+func (s *server) run(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.find(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	runTemplate.Execute(w, runPage{run, s.root})
+}
+
+// open starts the UI for one artifact of a run, or reuses a running one,
+// and redirects there.
+func (s *server) open(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	run, ok := s.find(q.Get("run"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var a analysis.Artifact
+	found := false
+	for _, m := range run.Stages {
+		if m.Name == q.Get("session") {
+			a, found = m.Artifact(q.Get("type"))
+		}
+	}
+	if !found || toolFor(a) == "" {
+		http.NotFound(w, r)
+		return
+	}
+	ui, err := s.ui(a)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	http.Redirect(w, r, "http://"+net.JoinHostPort(host, ui.port)+"/", http.StatusFound)
+}
+
+// toolUI is a go tool pprof or go tool trace web UI, listening on loopback
+// and proxied to the server's interface on a port of its own, since the
+// trace viewer links to absolute paths.
+type toolUI struct {
+	cmd   *exec.Cmd
+	proxy net.Listener
+	port  string
+	done  chan struct{} // closed when the tool exits
+}
+
+func (s *server) ui(a analysis.Artifact) (*toolUI, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ui := s.uis[a.Path]; ui != nil {
+		select {
+		case <-ui.done:
+			ui.proxy.Close()
+		default:
+			return ui, nil
+		}
+	}
+	ui, err := s.startUI(a)
+	if err != nil {
+		return nil, err
+	}
+	s.uis[a.Path] = ui
+	return ui, nil
+}
+
+func (s *server) startUI(a analysis.Artifact) (*toolUI, error) {
+	path := a.Path
+	if a.Compression != "" {
+		var err error
+		if path, err = decompress(a); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	toolAddr := l.Addr().String()
+	l.Close()
+
+	tool := toolFor(a)
+	// run the tool binary itself, so that killing it on close is enough
+	bin, err := exec.Command("go", "tool", "-n", tool).Output()
+	if err != nil {
+		return nil, fmt.Errorf("go tool -n %s: %w", tool, err)
+	}
+	args := []string{"-http=" + toolAddr}
+	if tool == "pprof" {
+		args = append(args, "-no_browser")
+	}
+	cmd := exec.Command(strings.TrimSpace(string(bin)), append(args, path)...)
+	// go tool trace has no flag to keep it from opening a browser
+	cmd.Env = append(os.Environ(), "BROWSER=true")
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	ui := &toolUI{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(ui.done)
+	}()
+	if err := waitListening(toolAddr, ui.done); err != nil {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("go tool %s %s: %w", tool, filepath.Base(path), err)
+	}
+
+	ui.proxy, err = net.Listen("tcp", net.JoinHostPort(s.host, "0"))
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+	_, ui.port, _ = net.SplitHostPort(ui.proxy.Addr().String())
+	target := &url.URL{Scheme: "http", Host: toolAddr}
+	go http.Serve(ui.proxy, httputil.NewSingleHostReverseProxy(target))
+	return ui, nil
+}
+
+// waitListening waits for the tool to accept connections on addr; traces
+// can take a while to parse.
+func waitListening(addr string, exited <-chan struct{}) error {
+	deadline := time.Now().Add(2 * time.Minute)
+	for time.Now().Before(deadline) {
+		if c, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+			c.Close()
+			return nil
+		}
+		select {
+		case <-exited:
+			return errors.New("exited before serving")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return errors.New("not serving after 2 minutes")
+}
+
+func (s *server) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ui := range s.uis {
+		ui.cmd.Process.Kill()
+	}
+}
+
+// decompress writes a compressed artifact next to it without the .zst
+// suffix, unless that was done before.
+func decompress(a analysis.Artifact) (string, error) {
+	path := strings.TrimSuffix(a.Path, ".zst")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	r, err := analysis.OpenArtifact(a)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,64 @@
+//go:build !goprof_disabled
+
+package goprof
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// The profilers of the runtime are only reached through these, so that the
+// goprof_disabled build links neither runtime/pprof nor runtime/trace.
+
+const buildDisabled = false
+
+// startCPUProfile fails only if the profiler is already running, and so
+// does startTracer for the tracer.
+func startCPUProfile(w io.Writer) error {
+	if err := pprof.StartCPUProfile(w); err != nil {
+		return fmt.Errorf("%w: %w", ErrProfilerInUse, err)
+	}
+	return nil
+}
+
+func stopCPUProfile()                    { pprof.StopCPUProfile() }
+func writeHeapProfile(w io.Writer) error { return pprof.WriteHeapProfile(w) }
+
+// writeProfile writes the runtime profile name, e.g. "block".
+func writeProfile(name string, w io.Writer, debug int) error {
+	return pprof.Lookup(name).WriteTo(w, debug)
+}
+
+func startTracer(w io.Writer) error {
+	if err := trace.Start(w); err != nil {
+		return fmt.Errorf("%w: %w", ErrProfilerInUse, err)
+	}
+	return nil
+}
+
+func stopTracer() { trace.Stop() }
+
+func withLabels(ctx context.Context, args []string, f func(context.Context)) {
+	pprof.Do(ctx, pprof.Labels(args...), f)
+}
+
+func withRegion(ctx context.Context, name string, f func()) {
+	trace.WithRegion(ctx, name, f)
+}
+
+// withTask runs f in a trace task and region both called name.
+func withTask(name string, f func()) {
+	ctx, task := trace.NewTask(context.Background(), name)
+	trace.WithRegion(ctx, name, f)
+	task.End()
+}
+
+// startTask starts a trace task called name and returns its end; tasks,
+// unlike regions, may end on another goroutine.
+func startTask(name string) (end func()) {
+	_, task := trace.NewTask(context.Background(), name)
+	return task.End
+}
@@ -0,0 +1,96 @@
+package goprof
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// CommandList returns the go tool commands that open the profiles of the
+// session name. It uses the artifacts the session actually produced, as
+// recorded in its manifest, and falls back to the default file names when
+// there is no manifest. The commands for artifacts of WithEncryption run
+// goprof decrypt first, with the identity file of the recipient taken to
+// be key.txt, as age-keygen -o key.txt writes it.
+func CommandList(name string) []string {
+	name = fullName(name)
+	var artifacts []Artifact
+	mu.Lock()
+	if last != nil && last.name == name {
+		artifacts = last.manifest.Artifacts
+	}
+	mu.Unlock()
+	if artifacts == nil {
+		if m, err := ReadManifest(manifestName(name)); err == nil {
+			artifacts = m.Artifacts
+		}
+	}
+	if artifacts == nil {
+		artifacts = []Artifact{
+			{Type: "cpu", Path: analysis.FileName(name, "cpu")},
+			{Type: "trace", Path: analysis.FileName(name, "trace")},
+			{Type: "block", Path: analysis.FileName(name, "block")},
+			{Type: "heap", Path: analysis.FileName(name, "heap")},
+		}
+	}
+
+	var cmds []string
+	port := freePort()
+	for _, a := range artifacts {
+		// an encrypted artifact is decrypted next to itself first
+		var decrypt string
+		plain := a.Path
+		if a.Encryption != "" {
+			decrypt = "goprof decrypt -i " + identityFile + " " + shellQuote(a.Path) + " && "
+			plain = strings.TrimSuffix(a.Path, analysis.EncryptedExt)
+		}
+		path := shellQuote(plain)
+		switch {
+		case a.Type == "cpu":
+			cmds = append(cmds, decrypt+"go tool pprof "+path, fmt.Sprintf("%sgo tool pprof -http=localhost:%d %s", decrypt, port, path))
+		case a.Type == "trace" && a.Compression != "":
+			raw := shellQuote(strings.TrimSuffix(plain, ".zst"))
+			cmds = append(cmds, decrypt+"zstd -dk "+path+" && go tool trace "+raw)
+		case a.Type == "trace":
+			cmds = append(cmds, decrypt+"go tool trace "+path)
+		case strings.HasSuffix(plain, ".prof") || strings.HasSuffix(plain, ".pprof"):
+			cmds = append(cmds, decrypt+"go tool pprof "+path)
+		}
+	}
+	return cmds
+}
+
+// identityFile is the age identity the commands decrypt with.
+const identityFile = "key.txt"
+
+// WriteCommands writes CommandList(name) to w, one command per line.
+func WriteCommands(w io.Writer, name string) error {
+	for _, cmd := range CommandList(name) {
+		if _, err := fmt.Fprintln(w, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// freePort returns a port that is free on localhost right now, for the
+// pprof web UI, or 6060 if there is none.
+func freePort() int {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 6060
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// shellQuote quotes s for sh if it needs it.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=+,@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
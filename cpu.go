@@ -0,0 +1,41 @@
+package goprof
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// cgroupCPU is a reading of the cgroup CPU controller.
+type cgroupCPU struct {
+	quota         float64 // CPUs, 0 without a quota
+	periods       uint64
+	throttled     uint64
+	throttledTime time.Duration
+}
+
+func cpuLimits(start, end cgroupCPU) *analysis.CPULimits {
+	return &analysis.CPULimits{
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		NumCPU:        runtime.NumCPU(),
+		Quota:         end.quota,
+		Periods:       end.periods - start.periods,
+		Throttled:     end.throttled - start.throttled,
+		ThrottledTime: end.throttledTime - start.throttledTime,
+	}
+}
+
+// rusageDelta is the resource usage between two readings; MaxRSS is a peak
+// and is taken from the end.
+func rusageDelta(start, end analysis.Rusage) *analysis.Rusage {
+	return &analysis.Rusage{
+		User:                end.User - start.User,
+		System:              end.System - start.System,
+		MaxRSS:              end.MaxRSS,
+		MinorFaults:         end.MinorFaults - start.MinorFaults,
+		MajorFaults:         end.MajorFaults - start.MajorFaults,
+		VoluntarySwitches:   end.VoluntarySwitches - start.VoluntarySwitches,
+		InvoluntarySwitches: end.InvoluntarySwitches - start.InvoluntarySwitches,
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package goprof
+
+import (
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// Getrusage is Unix only.
+func processCPU() (time.Duration, bool) {
+	return 0, false
+}
+
+func readRusage() (analysis.Rusage, bool) {
+	return analysis.Rusage{}, false
+}
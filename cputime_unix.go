@@ -0,0 +1,42 @@
+//go:build unix
+
+package goprof
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// processCPU is the user and system time the process used so far.
+func processCPU() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
+
+// readRusage is the resource usage of the process so far.
+func readRusage() (analysis.Rusage, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return analysis.Rusage{}, false
+	}
+	maxRSS := int64(ru.Maxrss)
+	// everywhere but on Apple systems it is in kilobytes
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		maxRSS *= 1024
+	}
+	return analysis.Rusage{
+		User:                time.Duration(ru.Utime.Nano()),
+		System:              time.Duration(ru.Stime.Nano()),
+		MaxRSS:              maxRSS,
+		MinorFaults:         int64(ru.Minflt),
+		MajorFaults:         int64(ru.Majflt),
+		VoluntarySwitches:   int64(ru.Nvcsw),
+		InvoluntarySwitches: int64(ru.Nivcsw),
+	}, true
+}
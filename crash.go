@@ -0,0 +1,107 @@
+package goprof
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+type crashHandler struct {
+	ch   chan os.Signal
+	done chan struct{}
+	once sync.Once
+}
+
+func installCrashHandler(sigs []os.Signal, log *slog.Logger) *crashHandler {
+	h := &crashHandler{
+		ch:   make(chan os.Signal, 1),
+		done: make(chan struct{}),
+	}
+	signal.Notify(h.ch, sigs...)
+	go func() {
+		select {
+		case sig := <-h.ch:
+			// another session's handler may have got there first
+			if err := stopNow(); err != nil && err != ErrNotStarted {
+				log.Error("goprof: flushing on signal failed", "signal", sig, "err", err)
+			}
+			signal.Reset(sig)
+			if proc, err := os.FindProcess(os.Getpid()); err == nil && proc.Signal(sig) == nil {
+				return
+			}
+			os.Exit(2)
+		case <-h.done:
+		}
+	}()
+	return h
+}
+
+func (h *crashHandler) uninstall() {
+	h.once.Do(func() {
+		signal.Stop(h.ch)
+		close(h.done)
+	})
+}
+
+// FlushOnPanic stops the running sessions when the calling goroutine panics
+// and then continues panicking. It must be deferred directly:
+//
+//	goprof.Start("<name>")
+//	defer goprof.FlushOnPanic()
+func FlushOnPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if err := stopNow(); err != nil && err != ErrNotStarted {
+		sessionLogger().Error("goprof: flushing on panic failed", "err", err)
+	}
+	panic(r)
+}
+
+// StopOnShutdown stops every running session once ctx is done, typically a
+// context from signal.NotifyContext, so a session started in main is
+// flushed when the process is asked to terminate, as in Kubernetes:
+//
+//	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+//	defer cancel()
+//	goprof.Start("server")
+//	flush := goprof.StopOnShutdown(ctx)
+//	serve(ctx)
+//	if err := flush(); err != nil {
+//		log.Print(err)
+//	}
+//
+// flush stops the sessions itself if ctx is not done yet, and otherwise
+// waits for the stop to finish, so main must call it before returning.
+func StopOnShutdown(ctx context.Context) (flush func() error) {
+	if buildDisabled {
+		return func() error { return nil }
+	}
+	var (
+		once sync.Once
+		err  error
+		done = make(chan struct{})
+	)
+	stopAll := func() {
+		once.Do(func() {
+			if err = stopNow(); err == ErrNotStarted {
+				err = nil
+			}
+			close(done)
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopAll()
+		case <-done:
+		}
+	}()
+	return func() error {
+		stopAll()
+		return err
+	}
+}
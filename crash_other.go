@@ -0,0 +1,11 @@
+//go:build !windows
+
+package goprof
+
+import (
+	"os"
+	"syscall"
+)
+
+// crashSignals are the default signals of WithCrashHandler.
+var crashSignals = []os.Signal{syscall.SIGTERM, syscall.SIGQUIT}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package goprof
+
+import (
+	"os"
+	"syscall"
+)
+
+// crashSignals are the default signals of WithCrashHandler. The runtime
+// reports Ctrl+C as os.Interrupt and the console closing, logoff and
+// shutdown as SIGTERM.
+var crashSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
@@ -0,0 +1,114 @@
+package goprof
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	} {
+		if _, err := parseSchedule(expr); !errors.Is(err, ErrBadSchedule) {
+			t.Errorf("parseSchedule(%q): %v, want %v", expr, err, ErrBadSchedule)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, s string) time.Time {
+		t.Helper()
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tt := range []struct {
+		expr     string
+		loc      *time.Location
+		from     string
+		want     string // empty for no match
+		describe string
+	}{
+		{"* * * * *", time.UTC, "2026-01-01 10:00", "2026-01-01 10:01", "every minute"},
+		{"*/15 * * * *", time.UTC, "2026-01-01 10:01", "2026-01-01 10:15", "step"},
+		{"10-20/5 * * * *", time.UTC, "2026-01-01 10:16", "2026-01-01 10:20", "range with step"},
+		{"5/20 * * * *", time.UTC, "2026-01-01 10:26", "2026-01-01 10:45", "start with step"},
+		{"0,30 9-17 * * *", time.UTC, "2026-01-01 17:30", "2026-01-02 09:00", "list and hour range"},
+		{"0 0 * * 1-5", time.UTC, "2026-01-02 12:00", "2026-01-05 00:00", "weekdays skip the weekend"},
+		{"0 0 * * 7", time.UTC, "2026-01-01 00:00", "2026-01-04 00:00", "Sunday as 7"},
+		{"0 0 31 * *", time.UTC, "2026-02-01 00:00", "2026-03-31 00:00", "month without the day"},
+		{"0 0 1 * *", time.UTC, "2026-12-15 00:00", "2027-01-01 00:00", "year rollover"},
+		{"0 0 29 2 *", time.UTC, "2026-03-01 00:00", "2028-02-29 00:00", "leap day"},
+		// 2026-01-13 is a Tuesday, 2026-01-15 the first day of month
+		// matching 15 after the 13th; either matches when both are restricted
+		{"0 0 15 * 2", time.UTC, "2026-01-14 00:00", "2026-01-15 00:00", "day of month or week"},
+		{"0 0 16 * 2", time.UTC, "2026-01-14 00:00", "2026-01-16 00:00", "day of month or week, month first"},
+		{"0 0 20 * 2", time.UTC, "2026-01-14 00:00", "2026-01-20 00:00", "day of month or week, week first"},
+		// a stepped * is unrestricted, so both fields must match
+		{"0 0 */2 * 1", time.UTC, "2026-01-01 00:00", "2026-01-05 00:00", "stepped day of month and weekday"},
+		{"0 0 1 * */2", time.UTC, "2026-01-02 00:00", "2026-02-01 00:00", "day of month and stepped weekday"},
+		{"30 2 * * *", ny, "2026-03-08 00:00", "2026-03-09 02:30", "spring forward skips the missing time"},
+		{"0 3 * * *", ny, "2026-03-08 00:00", "2026-03-08 03:00", "spring forward"},
+		{"0 0 30 2 *", time.UTC, "2026-01-01 00:00", "", "never"},
+		{"0 0 31 4,6 *", time.UTC, "2026-01-01 00:00", "", "never in those months"},
+	} {
+		s, err := parseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		got := s.next(at(tt.loc, tt.from))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%s (%s): next = %v, want none", tt.expr, tt.describe, got)
+			}
+			continue
+		}
+		if want := at(tt.loc, tt.want); !got.Equal(want) {
+			t.Errorf("%s (%s): next after %s = %v, want %v", tt.expr, tt.describe, tt.from, got, want)
+		}
+	}
+}
+
+func TestScheduleNextFallBack(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := parseSchedule("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-11-01 01:00 happens twice; an hourly schedule fires an hour
+	// apart across the change, never stalling on the repeated hour
+	from := time.Date(2026, 11, 1, 0, 30, 0, 0, ny)
+	var got []time.Duration
+	prev := from
+	for range 3 {
+		next := s.next(prev)
+		got = append(got, next.Sub(prev))
+		prev = next
+	}
+	if got[0] != 30*time.Minute || got[1] != time.Hour || got[2] != time.Hour {
+		t.Errorf("intervals across the fall back: %v", got)
+	}
+}
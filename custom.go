@@ -0,0 +1,57 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// CustomProfile is a profile the application keeps itself, such as a
+// *pprof.Profile from pprof.NewProfile that tracks open connections.
+type CustomProfile interface {
+	Name() string
+	WriteTo(w io.Writer, debug int) error
+}
+
+var ErrProfileRegistered = errors.New("profile already registered")
+
+// custom are the registered profiles, guarded by mu.
+var custom []CustomProfile
+
+// Register makes every session write p on Stop, next to the standard
+// profiles, as the artifact named after p with the characters not allowed
+// in file names replaced, e.g. <name>.myapp_connections.prof for
+// "myapp/connections". Register fails with ErrProfileRegistered if a
+// profile of that artifact name, or a standard one, is already there.
+func Register(p CustomProfile) error {
+	if disabled() {
+		return nil
+	}
+	typ := customType(p.Name())
+	mu.Lock()
+	defer mu.Unlock()
+	if slices.Contains(profileTypes, typ) || slices.ContainsFunc(custom, func(c CustomProfile) bool { return customType(c.Name()) == typ }) {
+		return fmt.Errorf("%w %q", ErrProfileRegistered, p.Name())
+	}
+	custom = append(custom, p)
+	return nil
+}
+
+func customType(name string) string {
+	return sanitize(name)
+}
+
+// writeCustom writes the registered profiles for s.
+func (s *session) writeCustom() error {
+	var errs []error
+	for _, p := range custom {
+		a, err := s.writeArtifact(customType(p.Name()), func(w io.Writer) error { return p.WriteTo(w, 0) })
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		s.extra = append(s.extra, a)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package goprof
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// DashboardInterval is how often Dashboard refreshes.
+const DashboardInterval = time.Second
+
+// Dashboard shows the running sessions and the goroutine count, heap in
+// use, GC pauses and CPU usage of the process on w, refreshed every
+// DashboardInterval until stop is called, so a long session is not a black
+// box until Stop. On a terminal the figures are redrawn in place; anywhere
+// else a line is added per refresh.
+//
+// CPU usage needs getrusage and is left out on platforms without it.
+func Dashboard(w io.Writer) (stop func()) {
+	if disabled() {
+		return func() {}
+	}
+	d := &dashboard{
+		w:    w,
+		tty:  isTerminal(w),
+		done: make(chan struct{}),
+		samples: []metrics.Sample{
+			{Name: metricGoroutines},
+			{Name: metricHeap},
+			{Name: metricGCCycles},
+			{Name: metricGCPauses},
+		},
+		at: time.Now(),
+	}
+	d.cpu, d.cpuOK = processCPU()
+	metrics.Read(d.samples)
+	d.pauses = append([]uint64(nil), d.samples[3].Value.Float64Histogram().Counts...)
+
+	quit := make(chan struct{})
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(DashboardInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.draw()
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(quit)
+			<-d.done
+		})
+	}
+}
+
+type dashboard struct {
+	w     io.Writer
+	tty   bool
+	lines int // drawn last time, to redraw over
+	done  chan struct{}
+
+	samples []metrics.Sample
+	// at the previous refresh
+	at     time.Time
+	cpu    time.Duration
+	cpuOK  bool
+	pauses []uint64
+}
+
+func (d *dashboard) draw() {
+	now := time.Now()
+	metrics.Read(d.samples)
+	goroutines := d.samples[0].Value.Uint64()
+	heap := d.samples[1].Value.Uint64()
+	cycles := d.samples[2].Value.Uint64()
+	pauses := d.samples[3].Value.Float64Histogram()
+	_, p99 := latencyPercentiles(pauses, d.pauses)
+	d.pauses = append(d.pauses[:0], pauses.Counts...)
+
+	cpu := "n/a"
+	if d.cpuOK {
+		used, _ := processCPU()
+		cpu = fmt.Sprintf("%.0f%% of %d cores", 100*float64(used-d.cpu)/float64(now.Sub(d.at)), runtime.GOMAXPROCS(0))
+		d.cpu = used
+	}
+	d.at = now
+
+	var names []string
+	for _, s := range Status().Sessions {
+		names = append(names, fmt.Sprintf("%s (%s)", s.Name, now.Sub(s.Start).Truncate(time.Second)))
+	}
+	sessions := "none"
+	if len(names) > 0 {
+		sessions = strings.Join(names, ", ")
+	}
+
+	var b bytes.Buffer
+	if !d.tty {
+		fmt.Fprintf(&b, "goprof: %s goroutines=%d heap=%s gc=%d gc_pause_p99=%s cpu=%s\n",
+			sessions, goroutines, analysis.FormatBytes(int64(heap)), cycles, seconds(p99), cpu)
+		d.w.Write(b.Bytes())
+		return
+	}
+	if d.lines > 0 {
+		// back to the first line and clear to the end of the screen
+		fmt.Fprintf(&b, "\x1b[%dA\x1b[J", d.lines)
+	}
+	fmt.Fprintf(&b, "sessions    %s\n", sessions)
+	fmt.Fprintf(&b, "goroutines  %d\n", goroutines)
+	fmt.Fprintf(&b, "heap        %s\n", analysis.FormatBytes(int64(heap)))
+	fmt.Fprintf(&b, "GC          %d cycles, p99 pause %s in the last %s\n", cycles, seconds(p99), DashboardInterval)
+	fmt.Fprintf(&b, "CPU         %s\n", cpu)
+	d.lines = 5
+	d.w.Write(b.Bytes())
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,185 @@
+package goprof
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+var ErrBadRecipient = errors.New("invalid age recipient")
+
+// WithEncryption encrypts every artifact of the session to recipient, an
+// age X25519 public key ("age1..."), as it is written, so the profiles
+// never reach the disk or a sink in the clear. Artifacts get an .age
+// suffix, e.g. <name>.cpu.pprof.age; decrypt them with goprof decrypt or
+// the age tool. Pass WithEncryption more than once for several recipients.
+//
+// The manifest and the history stay readable, since goprof and its tools
+// find their way around a bundle with them, but leave out the goroutine
+// stacks of WithLeakCheck and WithRuntimeSummary. The summary, flame
+// graphs and reports built from the profiles read them back with a key
+// that only lives in the process.
+func WithEncryption(recipient string) Option {
+	return func(c *config) {
+		r, err := parseRecipient(recipient)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.recipients = append(c.recipients, r)
+	}
+}
+
+func parseRecipient(s string) (age.Recipient, error) {
+	r, err := age.ParseX25519Recipient(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %w", ErrBadRecipient, s, err)
+	}
+	return r, nil
+}
+
+func parseRecipients(keys []string) ([]age.Recipient, error) {
+	var out []age.Recipient
+	for _, k := range keys {
+		r, err := parseRecipient(k)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// readKey is the identity of the process every file is also encrypted to,
+// so that goprof can read back what it wrote.
+var readKey = sync.OnceValue(func() *age.X25519Identity {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		panic(err)
+	}
+	return id
+})
+
+// encrypted reports whether files of typ are encrypted; goprof reads the
+// manifests and histories of other processes.
+func (c config) encrypted(typ string) bool {
+	return len(c.recipients) > 0 && typ != "manifest" && typ != "history"
+}
+
+// outName is the file the artifact typ is written to for the name name.
+func (c config) outName(typ, name string) string {
+	if c.encrypted(typ) {
+		return name + analysis.EncryptedExt
+	}
+	return name
+}
+
+// encWriter encrypts what is written to it into file, for the recipients
+// and this process.
+type encWriter struct {
+	enc  io.WriteCloser
+	file io.WriteCloser
+	n    int64 // bytes written to file
+	// sync syncs file once the encryption is complete, for WithSync
+	sync bool
+}
+
+func encrypt(file io.WriteCloser, recipients []age.Recipient, sync bool) (*encWriter, error) {
+	e := &encWriter{file: file, sync: sync}
+	enc, err := age.Encrypt(writerFunc(func(b []byte) (int, error) {
+		n, err := file.Write(b)
+		e.n += int64(n)
+		return n, err
+	}), append(recipients[:len(recipients):len(recipients)], readKey().Recipient())...)
+	if err != nil {
+		return nil, err
+	}
+	e.enc = enc
+	return e, nil
+}
+
+func (e *encWriter) Write(b []byte) (int, error) { return e.enc.Write(b) }
+
+func (e *encWriter) Close() error {
+	err := e.enc.Close()
+	if syncer, ok := e.file.(interface{ Sync() error }); ok && e.sync && err == nil {
+		err = syncer.Sync()
+	}
+	return errors.Join(err, e.file.Close())
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
+
+// plainFS reads the files of a session, decrypting the encrypted ones.
+type plainFS struct{ c config }
+
+func (p plainFS) Open(name string) (fs.File, error) {
+	var f fs.File
+	var err error
+	if p.c.fs != nil {
+		f, err = p.c.fs.Open(name)
+	} else {
+		f, err = os.Open(name)
+	}
+	if err != nil || !strings.HasSuffix(name, analysis.EncryptedExt) {
+		return f, err
+	}
+	r, err := age.Decrypt(f, readKey())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &plainFile{f, r}, nil
+}
+
+type plainFile struct {
+	fs.File
+	r io.Reader
+}
+
+func (f *plainFile) Read(b []byte) (int, error) { return f.r.Read(b) }
+
+// readFS is where reports read the files of a session from, nil for the
+// OS file system.
+func (c config) readFS() fs.FS {
+	if len(c.recipients) > 0 {
+		return plainFS{c}
+	}
+	if c.fs == nil {
+		return nil
+	}
+	return c.fs
+}
+
+// encryptFiles encrypts captured files for the recipients.
+func encryptFiles(files []memFile, recipients []age.Recipient) ([]memFile, error) {
+	out := make([]memFile, len(files))
+	for i, f := range files {
+		var b bytes.Buffer
+		w, err := age.Encrypt(&b, recipients...)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		f.a.Path += analysis.EncryptedExt
+		f.a.Size = int64(b.Len())
+		f.a.Encryption = analysis.EncryptionAge
+		out[i] = memFile{f.a, b.Bytes()}
+	}
+	return out, nil
+}
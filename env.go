@@ -0,0 +1,65 @@
+package goprof
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// These environment variables configure sessions from the outside, so
+// profiling can be redirected or switched off in a deployed binary. They
+// are read by every Start and override the options given in code. See also
+// EnvDir and EnvRunID.
+const (
+	// EnvDisable set to a true value ("1", "true") turns Start, Stop and
+	// Run into no-ops; Run then just calls its function.
+	EnvDisable = "GOPROF_DISABLE"
+	// EnvProfiles is a comma separated WithProfiles list, e.g. "cpu,heap".
+	EnvProfiles = "GOPROF_PROFILES"
+	// EnvRecipe applies a registered recipe, as WithRecipe does, so the
+	// kind of capture can be picked per deployment, e.g. "incident". The
+	// recipe may come from a file loaded with LoadRecipes. EnvProfiles
+	// still has the last word on the profiles.
+	EnvRecipe = "GOPROF_RECIPE"
+	// EnvNamePrefix is put in front of the last element of session names,
+	// e.g. "api-" turns "profiles/checkout" into "profiles/api-checkout".
+	EnvNamePrefix = "GOPROF_NAME_PREFIX"
+)
+
+func disabled() bool {
+	if buildDisabled {
+		return true
+	}
+	v, _ := strconv.ParseBool(os.Getenv(EnvDisable))
+	return v
+}
+
+// envOptions are the options the environment asks for.
+func envOptions() []Option {
+	var opts []Option
+	if name := strings.TrimSpace(os.Getenv(EnvRecipe)); name != "" {
+		opts = append(opts, WithRecipe(name))
+	}
+	v := os.Getenv(EnvProfiles)
+	if v == "" {
+		return opts
+	}
+	var types []string
+	for _, typ := range strings.Split(v, ",") {
+		if typ = strings.TrimSpace(typ); typ != "" {
+			types = append(types, typ)
+		}
+	}
+	return append(opts, WithProfiles(types...))
+}
+
+// prefixName applies EnvNamePrefix to a session name.
+func prefixName(name string) string {
+	prefix := os.Getenv(EnvNamePrefix)
+	if prefix == "" {
+		return name
+	}
+	dir, base := filepath.Split(name)
+	return dir + prefix + base
+}
@@ -0,0 +1,43 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrOutput matches every OutputError, so callers can tell a session that
+// could not write its files, e.g. to fall back to another directory, from
+// one refused for other reasons, such as ErrAlreadyStarted.
+var ErrOutput = errors.New("cannot write output")
+
+// ErrProfilerInUse is returned when the runtime's CPU profiler or execution
+// tracer is already used outside goprof, e.g. by net/http/pprof.
+var ErrProfilerInUse = errors.New("profiler in use outside goprof")
+
+// OutputError is a failure to write one of the files of a session. Err is
+// the cause, so errors.Is(err, fs.ErrPermission) still reports an output
+// directory that is not writable.
+type OutputError struct {
+	Op   string // "create", "write", "sync", "close" or "rename"
+	Path string
+	Type string // the artifact type, or "manifest" or "history"
+	Err  error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("%s %s %s: %v", e.Op, e.Type, e.Path, e.Err)
+}
+
+func (e *OutputError) Unwrap() error { return e.Err }
+
+// Is reports whether target is ErrOutput.
+func (e *OutputError) Is(target error) bool { return target == ErrOutput }
+
+// outputError wraps err, unless it is nil or already an OutputError.
+func outputError(op, path, typ string, err error) error {
+	var oe *OutputError
+	if err == nil || errors.As(err, &oe) {
+		return err
+	}
+	return &OutputError{Op: op, Path: path, Type: typ, Err: err}
+}
@@ -0,0 +1,87 @@
+package goprof
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+type finalSummary struct {
+	RunID       string            `json:"run_id"`
+	Name        string            `json:"name"`
+	DurationMS  float64           `json:"duration_ms"`
+	Artifacts   map[string]string `json:"artifacts"`
+	TopFunction string            `json:"top_function,omitempty"`
+	TopFlatPct  float64           `json:"top_flat_pct,omitempty"`
+	AllocBytes  uint64            `json:"alloc_bytes"`
+	NumGC       uint32            `json:"num_gc"`
+	Warnings    []string          `json:"warnings,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// Final is meant to be deferred at the end of main in batch jobs and cron
+// tasks. It stops the sessions still running and writes a single line of
+// JSON describing the last one to stop, the oldest, to w (stderr when nil),
+// ready for log aggregation:
+//
+//	goprof.Start("<name>")
+//	defer goprof.Final(os.Stdout)
+func Final(w io.Writer) error {
+	if w == nil {
+		w = os.Stderr
+	}
+	var stopErr error
+	if err := stopNow(); err != nil && err != ErrNotStarted {
+		stopErr = err
+	}
+
+	var m *Manifest
+	var cfg config
+	mu.Lock()
+	if last != nil {
+		m, cfg = last.manifest, last.cfg
+	}
+	mu.Unlock()
+	if m == nil {
+		if stopErr == nil {
+			return ErrNotStarted
+		}
+		return json.NewEncoder(w).Encode(finalSummary{RunID: RunID(), Error: stopErr.Error()})
+	}
+
+	s := finalSummary{
+		RunID:      m.RunID,
+		Name:       m.Name,
+		DurationMS: float64(m.Duration.Microseconds()) / 1000,
+		Artifacts:  map[string]string{},
+		Warnings:   m.Warnings,
+	}
+	for _, a := range m.Artifacts {
+		path, err := filepath.Abs(a.Path)
+		if err != nil {
+			path = a.Path
+		}
+		s.Artifacts[a.Type] = path
+	}
+	if m.Memory != nil {
+		s.AllocBytes = m.Memory.TotalAlloc
+		s.NumGC = m.Memory.NumGC
+	}
+	if a, ok := m.Artifact("cpu"); ok {
+		if prof, err := cfg.readProfile(a.Path); err == nil {
+			if top := analysis.Top(prof, "", 1); len(top) > 0 {
+				s.TopFunction, s.TopFlatPct = top[0].Name, top[0].FlatPct
+			}
+		}
+	}
+	if stopErr != nil {
+		s.Error = stopErr.Error()
+	}
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		return err
+	}
+	return stopErr
+}
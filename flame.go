@@ -0,0 +1,211 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/google/pprof/profile"
+	"github.com/jcocozza/goprof/analysis"
+	"github.com/klauspost/compress/zstd"
+)
+
+// WithFlameGraphs also writes each of the given profiles ("cpu" if none are
+// given, "block" for contention) as folded stacks (<name>.<type>.folded)
+// and as an SVG flame graph (<name>.<type>.flame.svg) on Stop, for
+// speedscope, flamegraph.pl and other tools that do not read pprof.
+func WithFlameGraphs(types ...string) Option {
+	if len(types) == 0 {
+		types = []string{"cpu"}
+	}
+	return func(c *config) { c.flameGraphs = types }
+}
+
+// writeFlameGraphs writes the flame graphs it can; one profile that fails
+// does not cost the others.
+func (s *session) writeFlameGraphs(m *Manifest) ([]Artifact, error) {
+	var out []Artifact
+	var errs []error
+	for _, typ := range s.cfg.flameGraphs {
+		a, ok := m.Artifact(typ)
+		if !ok {
+			continue
+		}
+		as, err := s.writeFlameGraph(typ, a)
+		out = append(out, as...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", typ, err))
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+func (s *session) writeFlameGraph(typ string, a Artifact) ([]Artifact, error) {
+	prof, err := s.cfg.readProfile(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(prof.SampleType) == 0 {
+		return nil, nil
+	}
+	prof = analysis.FilterRuntime(prof, s.cfg.runtimeStacks["flame"])
+	unit := analysis.Unit(prof, "")
+	root := analysis.FlameGraph(prof, "")
+	folded, err := s.writeArtifact("folded-"+typ, func(w io.Writer) error {
+		return analysis.WriteFolded(w, root)
+	})
+	if err != nil {
+		return nil, err
+	}
+	svg, err := s.writeArtifact("flame-"+typ, func(w io.Writer) error {
+		return analysis.WriteFlameSVG(w, root, unit)
+	})
+	if err != nil {
+		return []Artifact{folded}, err
+	}
+	return []Artifact{folded, svg}, nil
+}
+
+// WithSpeedscope also writes each of the given profiles ("cpu" if none are
+// given) as <name>.<type>.speedscope.json on Stop, which the speedscope web
+// UI opens directly, with one view per sample type.
+//
+// For "trace" it runs go tool trace -pprof in the profiled process to derive
+// the scheduler, sync, syscall and network wait profiles, so it needs go on
+// PATH, and Stop waits for the subprocess, which takes seconds for a large
+// trace. Without go, or for an encrypted trace, whose plain text go tool
+// trace would need on disk, the trace is left out with a warning in the
+// manifest; goprof export converts it later on a machine with a toolchain.
+func WithSpeedscope(types ...string) Option {
+	if len(types) == 0 {
+		types = []string{"cpu"}
+	}
+	return func(c *config) { c.speedscope = types }
+}
+
+func (s *session) writeSpeedscope(m *Manifest) ([]Artifact, error) {
+	var out []Artifact
+	var errs []error
+	for _, typ := range s.cfg.speedscope {
+		a, ok := m.Artifact(typ)
+		if !ok {
+			continue
+		}
+		var profs []analysis.NamedProfile
+		var err error
+		if typ == "trace" {
+			if skip := traceSkip(a); skip != "" {
+				m.Warnings = append(m.Warnings, "speedscope: trace left out, "+skip+"; convert it with goprof export")
+				continue
+			}
+			profs, err = s.traceProfiles(a)
+		} else {
+			var prof *profile.Profile
+			if prof, err = s.cfg.readProfile(a.Path); err == nil {
+				profs = []analysis.NamedProfile{{Profile: analysis.FilterRuntime(prof, s.cfg.runtimeStacks["flame"])}}
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", typ, err))
+			continue
+		}
+		ss, err := s.writeArtifact("speedscope-"+typ, func(w io.Writer) error {
+			return analysis.WriteSpeedscope(w, s.name+" "+typ, profs...)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", typ, err))
+			continue
+		}
+		out = append(out, ss)
+	}
+	return out, errors.Join(errs...)
+}
+
+// traceSkip says why the trace a cannot be converted in this process, or is
+// empty if it can.
+func traceSkip(a Artifact) string {
+	if a.Encryption != "" {
+		return "go tool trace cannot read it encrypted"
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		return "go tool trace needs go on PATH"
+	}
+	return ""
+}
+
+// traceProfiles derives the wait profiles from the trace a, which go tool
+// trace reads from an uncompressed file on disk.
+func (s *session) traceProfiles(a Artifact) ([]analysis.NamedProfile, error) {
+	if s.cfg.fs == nil && a.Compression == "" {
+		return analysis.TraceProfiles(a.Path)
+	}
+	f, err := s.cfg.open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if a.Compression != "" {
+		d, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer d.Close()
+		r = d
+	}
+	tmp, err := os.CreateTemp("", "goprof-*.trace.out")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return analysis.TraceProfiles(tmp.Name())
+}
+
+// writeArtifact creates the artifact typ of the session with write.
+func (s *session) writeArtifact(typ string, write func(io.Writer) error) (Artifact, error) {
+	f, err := s.create(typ, s.fileName(typ))
+	if err != nil {
+		return Artifact{}, err
+	}
+	if err := write(f); err != nil {
+		s.discard(f)
+		return Artifact{}, err
+	}
+	if err := s.closeFile(f); err != nil {
+		return Artifact{}, err
+	}
+	return artifact(typ, f), nil
+}
+
+// WithLineReport also writes <name>.lines.md on Stop: the ten hottest
+// functions of the CPU profile, each with its five hottest source lines
+// like pprof -list shows them, as Markdown to paste into a review. Source
+// text is included where the files are on this machine.
+func WithLineReport() Option {
+	return func(c *config) { c.lineReport = true }
+}
+
+const hotLines = 5
+
+func (s *session) writeLineReport(m *Manifest) (Artifact, bool, error) {
+	cpu, ok := m.Artifact("cpu")
+	if !ok {
+		return Artifact{}, false, nil
+	}
+	prof, err := s.cfg.readProfile(cpu.Path)
+	if err != nil {
+		return Artifact{}, false, err
+	}
+	r := analysis.HotLines(analysis.FilterRuntime(prof, s.cfg.runtimeStacks["lines"]), "", topN, hotLines)
+	a, err := s.writeArtifact("lines", r.WriteMarkdown)
+	return a, err == nil, err
+}
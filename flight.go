@@ -0,0 +1,21 @@
+package goprof
+
+import (
+	"errors"
+	"time"
+)
+
+// FlightConfig bounds the window kept by the flight recorder.
+// Zero values leave the choice to the runtime.
+type FlightConfig struct {
+	// MinAge is how far back the recorder tries to keep events.
+	MinAge time.Duration
+	// MaxBytes caps the memory used for the window and wins over MinAge.
+	MaxBytes uint64
+}
+
+var (
+	ErrFlightUnsupported   = errors.New("flight recorder requires go1.25 or newer")
+	ErrFlightNotStarted    = errors.New("flight recorder has not been started")
+	ErrFlightAlreadyActive = errors.New("flight recorder already started")
+)
@@ -0,0 +1,68 @@
+//go:build go1.25 && !goprof_disabled
+
+package goprof
+
+import (
+	"io"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+var flight struct {
+	mu sync.Mutex
+	fr *trace.FlightRecorder
+}
+
+// StartFlightRecorder keeps tracing continuously in a bounded in-memory
+// window, so that DumpFlight can write out the last few seconds after
+// something interesting happened. It can run alongside a session.
+func StartFlightRecorder(cfg FlightConfig) error {
+	flight.mu.Lock()
+	defer flight.mu.Unlock()
+	if flight.fr != nil {
+		return ErrFlightAlreadyActive
+	}
+	fr := trace.NewFlightRecorder(trace.FlightRecorderConfig{
+		MinAge:   cfg.MinAge,
+		MaxBytes: cfg.MaxBytes,
+	})
+	if err := fr.Start(); err != nil {
+		return err
+	}
+	flight.fr = fr
+	return nil
+}
+
+// DumpFlight writes the current window to <name>.flight.trace.out.
+// Recording continues afterwards.
+//
+// name is placed like a session name, see EnvDir and EnvNamePrefix, and
+// the file is written like the files of a session with opts, so WithFS,
+// WithNameTemplate and WithEncryption apply.
+func DumpFlight(name string, opts ...Option) error {
+	s := &session{name: fullName(name), cfg: newConfig(opts), created: time.Now()}
+	if s.cfg.err != nil {
+		return s.cfg.err
+	}
+	flight.mu.Lock()
+	defer flight.mu.Unlock()
+	if flight.fr == nil {
+		return ErrFlightNotStarted
+	}
+	_, err := s.writeArtifact("flight", func(w io.Writer) error {
+		_, err := flight.fr.WriteTo(w)
+		return err
+	})
+	return err
+}
+
+// StopFlightRecorder stops recording and drops the window.
+func StopFlightRecorder() {
+	flight.mu.Lock()
+	defer flight.mu.Unlock()
+	if flight.fr != nil {
+		flight.fr.Stop()
+		flight.fr = nil
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !go1.25 || goprof_disabled
+
+package goprof
+
+// StartFlightRecorder needs the flight recorder added to runtime/trace in go1.25.
+// In the goprof_disabled build it and DumpFlight do nothing.
+func StartFlightRecorder(cfg FlightConfig) error {
+	if buildDisabled {
+		return nil
+	}
+	return ErrFlightUnsupported
+}
+
+func DumpFlight(name string, opts ...Option) error {
+	if buildDisabled {
+		return nil
+	}
+	return ErrFlightUnsupported
+}
+
+func StopFlightRecorder() {}
@@ -0,0 +1,24 @@
+//go:build go1.25 && !goprof_disabled
+
+package goprof
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDumpFlightMemFS(t *testing.T) {
+	if err := StartFlightRecorder(FlightConfig{MinAge: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	defer StopFlightRecorder()
+	time.Sleep(10 * time.Millisecond)
+	var fsys MemFS
+	if err := DumpFlight("slow/request", WithFS(&fsys)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fsys.Names(), []string{"slow/request.flight.trace.out"}; !slices.Equal(got, want) {
+		t.Errorf("files: %v, want %v", got, want)
+	}
+}
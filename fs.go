@@ -0,0 +1,275 @@
+package goprof
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// FS is where a session writes its files, see WithFS. Names are the
+// session's file paths, e.g. "profiles/checkout.cpu.pprof"; Open reads them
+// back for the reports that are built from other artifacts.
+//
+// An FS may also have a Remove(name string) error method, to delete
+// partial files of a failed Start or Stop, and a Rename(oldname, newname
+// string) error method: files are then written to <name>.tmp and renamed
+// into place once complete, so a crash never leaves a truncated file under
+// the final name. RootFS has both from go1.25 on, before that only Remove.
+type FS interface {
+	fs.FS
+	Create(name string) (io.WriteCloser, error)
+}
+
+// WithFS writes the session's files to fsys instead of the working
+// directory, e.g. a RootFS confined to one directory or a MemFS in tests.
+// Files that have a Sync method are synced as WithSync says.
+//
+// WithOpenUI still needs the files on disk.
+func WithFS(fsys FS) Option {
+	return func(c *config) { c.fs = fsys }
+}
+
+// RootFS writes to and reads from the directory root is opened on. Names
+// must stay within it.
+func RootFS(root *os.Root) FS {
+	return rootFS{root}
+}
+
+type rootFS struct{ root *os.Root }
+
+func (r rootFS) Open(name string) (fs.File, error)          { return r.root.Open(name) }
+func (r rootFS) Create(name string) (io.WriteCloser, error) { return r.root.Create(name) }
+func (r rootFS) Remove(name string) error                   { return r.root.Remove(name) }
+
+// MemFS keeps files in memory, e.g. to check what a session wrote in a
+// test without touching the disk. A file appears once it is closed. Names
+// must be valid io/fs paths: slash separated, without a leading slash,
+// "." or "..". The zero value is ready to use.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (m *MemFS) Create(name string) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	return &memWriter{fs: m, name: name}, nil
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	b, err := m.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &memReader{Reader: bytes.NewReader(b), info: memInfo{name, int64(len(b))}}, nil
+}
+
+// Remove removes the file name; files still being written are not affected.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// ReadDir lists the files directly in dir, for fs.Glob and fs.WalkDir.
+// MemFS has no directories of its own, so subdirectories are not listed.
+func (m *MemFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []fs.DirEntry
+	for name, b := range m.files {
+		if path.Dir(name) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{path.Base(name), int64(len(b))}))
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// ReadFile returns the contents of the file name.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return b, nil
+}
+
+// Names returns the names of all files, sorted.
+func (m *MemFS) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+type memWriter struct {
+	fs   *MemFS
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *memWriter) Write(b []byte) (int, error) { return w.buf.Write(b) }
+
+func (w *memWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	if w.fs.files == nil {
+		w.fs.files = map[string][]byte{}
+	}
+	w.fs.files[w.name] = w.buf.Bytes()
+	return nil
+}
+
+type memReader struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *memReader) Close() error               { return nil }
+
+type memInfo struct {
+	name string
+	size int64
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() fs.FileMode  { return 0o444 }
+func (i memInfo) ModTime() time.Time { return time.Time{} }
+func (i memInfo) IsDir() bool        { return false }
+func (i memInfo) Sys() any           { return nil }
+
+// outFile is a file the session is writing. It counts what is written, for
+// the manifest.
+type outFile struct {
+	w    io.WriteCloser
+	name string
+	typ  string
+	// tmp is where the file is written until closeFile renames it to
+	// name; empty if the FS cannot rename
+	tmp  string
+	size int64
+	busy time.Duration // spent in Write
+	enc  *encWriter    // under w, if the file is encrypted
+}
+
+func (f *outFile) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := f.w.Write(b)
+	f.busy += time.Since(start)
+	f.size += int64(n)
+	stats.bytesWritten.Add(int64(n))
+	return n, outputError("write", f.name, f.typ, err)
+}
+
+func (f *outFile) Close() error { return f.w.Close() }
+
+type renamer interface {
+	Rename(oldname, newname string) error
+}
+
+// create creates the file name for the artifact typ in the session's FS,
+// as a temporary file if the FS can rename it into place.
+func (s *session) create(typ, name string) (*outFile, error) {
+	name = s.cfg.outName(typ, name)
+	tmp := name + ".tmp"
+	var w io.WriteCloser
+	var err error
+	switch fsys := s.cfg.fs.(type) {
+	case nil:
+		w, err = os.Create(tmp)
+	case renamer:
+		w, err = s.cfg.fs.Create(tmp)
+	default:
+		tmp = ""
+		w, err = fsys.Create(name)
+	}
+	if err != nil {
+		return nil, outputError("create", name, typ, err)
+	}
+	f := &outFile{w: w, name: name, typ: typ, tmp: tmp}
+	if s.cfg.encrypted(typ) {
+		if f.enc, err = encrypt(w, s.cfg.recipients, s.cfg.sync >= SyncFiles); err != nil {
+			s.discard(f)
+			return nil, outputError("create", name, typ, err)
+		}
+		f.w = f.enc
+	}
+	return f, nil
+}
+
+// rename moves a complete file to its final name.
+func (s *session) rename(f *outFile) error {
+	if f.tmp == "" {
+		return nil
+	}
+	if s.cfg.fs == nil {
+		return os.Rename(f.tmp, f.name)
+	}
+	return s.cfg.fs.(renamer).Rename(f.tmp, f.name)
+}
+
+// discard closes and removes a file that could not be written completely.
+func (s *session) discard(f *outFile) {
+	f.Close()
+	if f.tmp != "" {
+		s.remove(f.tmp)
+	} else {
+		s.remove(f.name)
+	}
+}
+
+// remove removes the file name from the session's FS, if it can.
+func (s *session) remove(name string) error {
+	switch fsys := s.cfg.fs.(type) {
+	case nil:
+		return os.Remove(name)
+	case interface{ Remove(name string) error }:
+		return fsys.Remove(name)
+	}
+	return nil
+}
+
+// open reads back a file the session with config c wrote, as it is on
+// disk; readProfile decrypts.
+func (c config) open(name string) (io.ReadCloser, error) {
+	if c.fs != nil {
+		return c.fs.Open(name)
+	}
+	return os.Open(name)
+}
+
+func (c config) readProfile(name string) (*profile.Profile, error) {
+	if fsys := c.readFS(); fsys != nil {
+		return analysis.ReadProfileFS(fsys, name)
+	}
+	return analysis.ReadProfile(name)
+}
@@ -0,0 +1,96 @@
+package goprof
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"testing"
+)
+
+func TestMemFS(t *testing.T) {
+	var m MemFS
+	for _, name := range []string{"b.pprof", "a.pprof", "dir/c.pprof"} {
+		w, err := m.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, name); err != nil {
+			t.Fatal(err)
+		}
+		if name == "a.pprof" {
+			// a file appears once it is closed
+			if _, err := m.Open(name); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Open before Close: %v, want %v", err, fs.ErrNotExist)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := m.Names(), []string{"a.pprof", "b.pprof", "dir/c.pprof"}; !slices.Equal(got, want) {
+		t.Errorf("Names: %q, want %q", got, want)
+	}
+	f, err := m.Open("dir/c.pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "dir/c.pprof" || info.Name() != "dir/c.pprof" || info.Size() != int64(len(b)) {
+		t.Errorf("Open: %q, stat %s of %d bytes", b, info.Name(), info.Size())
+	}
+
+	for dir, want := range map[string][]string{
+		".":     {"a.pprof", "b.pprof"},
+		"dir":   {"c.pprof"},
+		"empty": nil,
+	} {
+		entries, err := m.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("ReadDir(%q): %q, want %q", dir, got, want)
+		}
+	}
+	if got, err := fs.Glob(&m, "*.pprof"); err != nil || !slices.Equal(got, []string{"a.pprof", "b.pprof"}) {
+		t.Errorf("Glob: %q, %v", got, err)
+	}
+
+	if err := m.Remove("a.pprof"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ReadFile("a.pprof"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile after Remove: %v, want %v", err, fs.ErrNotExist)
+	}
+	if err := m.Remove("a.pprof"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("second Remove: %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestMemFSInvalidPaths(t *testing.T) {
+	var m MemFS
+	for _, name := range []string{"/abs.pprof", "../up.pprof", "a/../b.pprof", "dir/", ""} {
+		if _, err := m.Create(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Create(%q): %v, want %v", name, err, fs.ErrInvalid)
+		}
+		if _, err := m.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Open(%q): %v, want %v", name, err, fs.ErrInvalid)
+		}
+		if _, err := m.ReadDir(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("ReadDir(%q): %v, want %v", name, err, fs.ErrInvalid)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package goprof
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// pauseBuckets are the bounds of GCSummary.Pauses.
+var pauseBuckets = []time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// readGCPauses returns the counts of the runtime's GC pause histogram.
+func readGCPauses() []uint64 {
+	s := []metrics.Sample{{Name: metricGCPauses}}
+	metrics.Read(s)
+	return append([]uint64(nil), s[0].Value.Float64Histogram().Counts...)
+}
+
+// gcSummary sums up the GC between the mem stats of the start and end of
+// a session, with pauses the pause counts at its start.
+func gcSummary(memStart, memEnd *runtime.MemStats, pauses []uint64, start, end time.Time) *analysis.GCSummary {
+	g := &analysis.GCSummary{
+		Cycles: memEnd.NumGC - memStart.NumGC,
+		Forced: memEnd.NumForcedGC - memStart.NumForcedGC,
+		Total:  time.Duration(memEnd.PauseTotalNs - memStart.PauseTotalNs),
+	}
+	if g.Cycles == 0 {
+		return g
+	}
+
+	s := []metrics.Sample{{Name: metricGCPauses}}
+	metrics.Read(s)
+	h := s[0].Value.Float64Histogram()
+	p50, p99 := latencyPercentiles(h, pauses)
+	g.PauseP50, g.PauseP99 = seconds(p50), seconds(p99)
+	g.Pauses = make([]analysis.PauseBucket, len(pauseBuckets)+1)
+	for i, b := range pauseBuckets {
+		g.Pauses[i].Below = b
+	}
+	var highest time.Duration
+	for i, c := range h.Counts {
+		if i < len(pauses) {
+			c -= pauses[i]
+		}
+		if c == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		if !math.IsInf(hi, 1) {
+			highest = seconds(hi)
+		}
+		j := 0
+		for j < len(pauseBuckets) && seconds(max(lo, 0)) >= pauseBuckets[j] {
+			j++
+		}
+		g.Pauses[j].Count += c
+	}
+
+	// the runtime keeps the last 256 pauses exactly
+	var stats debug.GCStats
+	debug.ReadGCStats(&stats)
+	var seen uint32
+	for i, p := range stats.Pause {
+		if i >= len(stats.PauseEnd) || stats.PauseEnd[i].Before(start) {
+			break
+		}
+		if !stats.PauseEnd[i].After(end) {
+			g.Max = max(g.Max, p)
+			seen++
+		}
+	}
+	if seen < g.Cycles {
+		// older ones are only known to the histogram
+		g.Max = max(g.Max, highest)
+	}
+	return g
+}
@@ -1,3 +1,15 @@
 module github.com/jcocozza/goprof
 
 go 1.24.4
+
+require github.com/google/pprof v0.0.0-20250820193118-f64d9cf942d6
+
+require (
+	filippo.io/age v1.2.1
+	github.com/klauspost/compress v1.19.2
+)
+
+require (
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.32.0 // indirect
+)
@@ -0,0 +1,281 @@
+package goprof
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// Handler serves the bundles written to Dir:
+//
+//	GET /                      the runs in Dir, newest first, with links to their files;
+//	                           manifests that cannot be read are skipped with a warning
+//	GET /files/<file>          one file, with range requests for resuming
+//	GET /runs/<run id>.tar.gz  every bundle of a run, streamed as a tarball
+//
+// The index lists a go tool pprof command for every profile, which fetches
+// it straight from the handler.
+//
+// Mount it under a prefix with http.StripPrefix, e.g.
+//
+//	mux.Handle("/debug/goprof/", http.StripPrefix("/debug/goprof", goprof.Handler{Dir: "."}))
+type Handler struct {
+	Dir string
+	// Logger reports tarballs cut short by an error; stderr by default.
+	Logger *slog.Logger
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/" || r.URL.Path == "":
+		h.serveIndex(w, r)
+	case strings.HasPrefix(r.URL.Path, "/files/"):
+		h.serveFile(w, r, strings.TrimPrefix(r.URL.Path, "/files/"))
+	case strings.HasPrefix(r.URL.Path, "/runs/") && strings.HasSuffix(r.URL.Path, ".tar.gz"):
+		runID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/runs/"), ".tar.gz")
+		h.serveRun(w, r, runID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var handlerIndex = template.Must(template.New("index").Funcs(template.FuncMap{
+	"bytes": analysis.FormatBytes,
+	"ms":    func(d time.Duration) time.Duration { return d.Round(time.Millisecond) },
+	"time":  func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>goprof runs</title></head>
+<body style="font-family: sans-serif">
+{{- range .Warnings}}
+<p style="color: #b00">WARNING: {{.}}</p>
+{{- end}}
+{{- range .Runs}}
+<h2>Run {{.RunID}} <small><a href="{{$.Base}}/runs/{{.RunID}}.tar.gz">tar.gz</a></small></h2>
+{{- range .Stages}}
+<h3>{{.Name}}</h3>
+<p>started {{time .Start}}, ran {{ms .Duration}}{{if .Host}}, pid {{.PID}} on {{.Host}}{{end}}</p>
+<table cellpadding="2">
+{{- range .Files}}
+<tr><td>{{.Type}}</td><td><a href="{{$.Base}}/files/{{.Rel}}">{{.Rel}}</a></td><td align="right">{{bytes .Size}}</td><td>{{if .Pprof}}<code>go tool pprof {{$.URL}}/files/{{.Rel}}</code>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- else}}
+<p>no runs yet</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// indexFile is a file the index links to.
+type indexFile struct {
+	Type  string
+	Rel   string // below /files/
+	Size  int64
+	Pprof bool
+}
+
+func (h Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	runs, warnings, err := analysis.ListRuns(h.Dir)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	type stage struct {
+		analysis.Manifest
+		Files []indexFile
+	}
+	type run struct {
+		RunID  string
+		Stages []stage
+	}
+	page := struct {
+		Base     string // the path the handler is mounted at
+		URL      string // and the URL, for go tool pprof
+		Runs     []run
+		Warnings []string
+	}{Warnings: warnings}
+	// mounted with http.StripPrefix, the request URI still holds the prefix
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		page.Base = strings.TrimSuffix(strings.TrimSuffix(u.Path, r.URL.Path), "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	page.URL = scheme + "://" + r.Host + page.Base
+
+	for _, rr := range runs {
+		ru := run{RunID: rr.RunID}
+		for _, m := range rr.Stages {
+			st := stage{Manifest: m}
+			for _, a := range m.Artifacts {
+				rel, err := filepath.Rel(h.Dir, a.Path)
+				if err != nil || !filepath.IsLocal(rel) {
+					continue
+				}
+				st.Files = append(st.Files, indexFile{
+					Type:  a.Type,
+					Rel:   filepath.ToSlash(rel),
+					Size:  a.Size,
+					Pprof: strings.HasSuffix(a.Path, ".pprof") || strings.HasSuffix(a.Path, ".prof"),
+				})
+			}
+			ru.Stages = append(ru.Stages, st)
+		}
+		page.Runs = append(page.Runs, ru)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	handlerIndex.Execute(w, page)
+}
+
+func (h Handler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		http.NotFound(w, r)
+		return
+	}
+	root, err := os.OpenRoot(h.Dir)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer root.Close()
+	f, err := root.Open(name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	// a strong validator lets clients resume with If-Range
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (h Handler) serveRun(w http.ResponseWriter, r *http.Request, runID string) {
+	runs, _, err := analysis.ListRuns(h.Dir)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	var run *analysis.RunReport
+	for i := range runs {
+		if runs[i].RunID == runID {
+			run = &runs[i]
+		}
+	}
+	if run == nil {
+		httpError(w, fmt.Errorf("%w %s", analysis.ErrRunNotFound, runID))
+		return
+	}
+	root, err := os.OpenRoot(h.Dir)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer root.Close()
+
+	var names []string
+	for _, m := range run.Stages {
+		// the manifest is written next to the artifacts
+		dir := h.Dir
+		if len(m.Artifacts) > 0 {
+			dir = filepath.Dir(m.Artifacts[0].Path)
+		}
+		if rel, err := filepath.Rel(h.Dir, filepath.Join(dir, filepath.Base(analysis.ManifestName(m.Name)))); err == nil {
+			names = append(names, rel)
+		}
+		for _, a := range m.Artifacts {
+			rel, err := filepath.Rel(h.Dir, a.Path)
+			if err != nil {
+				continue
+			}
+			names = append(names, rel)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+".tar.gz"))
+	if r.Method == http.MethodHead {
+		return
+	}
+	// the size is unknown up front, so once streaming started errors can
+	// only cut the response short
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		if err := addToTar(tw, root, name); err != nil {
+			log := h.Logger
+			if log == nil {
+				log = defaultLogger
+			}
+			log.Error("goprof: streaming run failed", "run_id", runID, "err", err)
+			return
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return
+	}
+	gz.Close()
+}
+
+func addToTar(tw *tar.Writer, root *os.Root, name string) error {
+	f, err := root.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(name)
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, analysis.ErrRunNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,41 @@
+package goprof
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerIndexSkipsBadManifest(t *testing.T) {
+	dir := t.TempDir()
+	m := newManifest(filepath.Join(dir, "good"), time.Now(), time.Now(), nil)
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "good.manifest.json"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// cut short, as if a Stop were still writing it
+	if err := os.WriteFile(filepath.Join(dir, "bad.manifest.json"), b[:len(b)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler{Dir: dir}.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "Run "+m.RunID) {
+		t.Error("index does not list the readable run")
+	}
+	if !strings.Contains(body, "WARNING: skipped") || !strings.Contains(body, "bad.manifest.json") {
+		t.Error("index does not warn about the unreadable manifest")
+	}
+}
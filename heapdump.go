@@ -0,0 +1,91 @@
+package goprof
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// DumpHeap writes a full heap dump with debug.WriteHeapDump to
+// <name>.heapdump.bin, next to a sampled heap profile and a manifest, for
+// when the exact object graph matters, e.g. to explore it with viewcore
+// style tools. The dump stops the world while it is written and is about
+// as large as the heap, so it is never taken by sessions on their own.
+//
+// name is placed like a session name, see EnvDir and EnvNamePrefix, and
+// the files are written like the files of a session with opts, so WithFS,
+// WithNameTemplate and WithEncryption apply.
+func DumpHeap(name string, opts ...Option) error {
+	if disabled() {
+		return nil
+	}
+	// a session only in name, for the file handling
+	s := &session{name: fullName(name), cfg: newConfig(opts), created: time.Now()}
+	if s.cfg.err != nil {
+		return s.cfg.err
+	}
+	start := time.Now()
+	dump, err := s.create("heapdump", s.fileName("heapdump"))
+	if err != nil {
+		return err
+	}
+	if err := writeHeapDump(dump); err != nil {
+		s.discard(dump)
+		return err
+	}
+	if err := s.closeFile(dump); err != nil {
+		return err
+	}
+	heap, err := s.create("heap", s.fileName("heap"))
+	if err != nil {
+		return err
+	}
+	if err := writeHeapProfile(heap); err != nil {
+		s.discard(heap)
+		return err
+	}
+	if err := s.closeFile(heap); err != nil {
+		return err
+	}
+
+	m := newManifest(s.name, start, time.Now(), []Artifact{artifact("heapdump", dump), artifact("heap", heap)})
+	for i, a := range m.Artifacts {
+		m.Artifacts[i].Path = filepath.Base(a.Path)
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.writeFile("manifest", manifestName(s.name), b)
+}
+
+// writeHeapDump writes a heap dump to f. debug.WriteHeapDump needs a file
+// descriptor, so the dump goes through a temporary file unless f is
+// written to the OS file system as is.
+func writeHeapDump(f *outFile) error {
+	if file, ok := f.w.(*os.File); ok {
+		debug.WriteHeapDump(file.Fd())
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		f.size = info.Size()
+		stats.bytesWritten.Add(f.size)
+		return nil
+	}
+	tmp, err := os.CreateTemp("", "goprof-*.heapdump.bin")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	debug.WriteHeapDump(tmp.Fd())
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(f, tmp)
+	return err
+}
@@ -0,0 +1,22 @@
+//go:build !goprof_disabled
+
+package goprof
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDumpHeapMemFS(t *testing.T) {
+	var fsys MemFS
+	if err := DumpHeap("oom", WithFS(&fsys)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"oom.heap.prof", "oom.heapdump.bin", "oom.manifest.json"}
+	if got := fsys.Names(); !slices.Equal(got, want) {
+		t.Errorf("files: %v, want %v", got, want)
+	}
+	if b, _ := fsys.ReadFile("oom.heapdump.bin"); len(b) == 0 {
+		t.Error("empty heap dump")
+	}
+}
@@ -0,0 +1,66 @@
+package goprof
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// WithHeapSnapshots also writes a heap profile every interval while the
+// session runs, as <name>.heap-001.prof and so on, for HeapGrowth to find
+// the functions whose in-use memory keeps growing. Each snapshot shows the
+// heap as of the last GC before it; no GC is forced.
+func WithHeapSnapshots(interval time.Duration) Option {
+	return func(c *config) { c.heapSnapshots = interval }
+}
+
+// heapSnapshotter writes the snapshots of WithHeapSnapshots.
+type heapSnapshotter struct {
+	s         *session
+	artifacts []Artifact
+	err       error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startHeapSnapshots(s *session, interval time.Duration) *heapSnapshotter {
+	h := &heapSnapshotter{
+		s:    s,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for h.err == nil {
+			select {
+			case <-ticker.C:
+				h.snapshot()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+	return h
+}
+
+func (h *heapSnapshotter) snapshot() {
+	typ := fmt.Sprintf("heap-%03d", len(h.artifacts)+1)
+	a, err := h.s.writeArtifact(typ, func(w io.Writer) error {
+		return writeHeapProfile(w)
+	})
+	if err != nil {
+		h.err = err
+		return
+	}
+	h.artifacts = append(h.artifacts, a)
+}
+
+// finish returns the snapshots written, or the error that ended them.
+func (h *heapSnapshotter) finish() ([]Artifact, error) {
+	close(h.stop)
+	<-h.done
+	return h.artifacts, h.err
+}
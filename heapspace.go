@@ -0,0 +1,100 @@
+package goprof
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+
+	"github.com/google/pprof/profile"
+)
+
+// WithHeapSpaces also splits the heap profile taken on Stop in two, so live
+// memory and allocation churn are not read off the same file by mistake:
+// <name>.heap-inuse.prof holds only inuse_space and inuse_objects, and
+// <name>.heap-alloc.prof only alloc_space and alloc_objects, counting just
+// what was allocated since the session started.
+//
+// The runtime updates the heap profile at the end of each GC cycle, so with
+// forceGC the session runs runtime.GC before both snapshots, which makes
+// the in-use numbers the live heap at Stop and the allocations exact, at the
+// cost of two full collections.
+func WithHeapSpaces(forceGC bool) Option {
+	return func(c *config) { c.heapSpaces, c.heapGC = true, forceGC }
+}
+
+// heapSnapshot returns the heap profile as of now.
+func heapSnapshot(gc bool) (*profile.Profile, error) {
+	if gc {
+		runtime.GC()
+	}
+	var b bytes.Buffer
+	if err := writeHeapProfile(&b); err != nil {
+		return nil, err
+	}
+	return profile.Parse(&b)
+}
+
+func (s *session) writeHeapSpaces() error {
+	if s.heapBase == nil {
+		return nil
+	}
+	end, err := heapSnapshot(s.cfg.heapGC)
+	if err != nil {
+		return err
+	}
+	inuse := sampleTypes(end.Copy(), "inuse_objects", "inuse_space")
+
+	s.heapBase.Scale(-1)
+	delta, err := profile.Merge([]*profile.Profile{end, s.heapBase})
+	if err != nil {
+		return fmt.Errorf("subtracting the heap at the start: %w", err)
+	}
+	alloc := sampleTypes(delta, "alloc_objects", "alloc_space")
+
+	for _, p := range []struct {
+		typ  string
+		prof *profile.Profile
+	}{
+		{"heap-inuse", inuse},
+		{"heap-alloc", alloc},
+	} {
+		a, err := s.writeArtifact(p.typ, func(w io.Writer) error { return p.prof.Write(w) })
+		if err != nil {
+			return err
+		}
+		s.extra = append(s.extra, a)
+	}
+	return nil
+}
+
+// sampleTypes keeps only the sample types of p in types, the last of which
+// becomes the default, and drops the samples left without a value.
+func sampleTypes(p *profile.Profile, types ...string) *profile.Profile {
+	var idx []int
+	var st []*profile.ValueType
+	for i, t := range p.SampleType {
+		if slices.Contains(types, t.Type) {
+			idx = append(idx, i)
+			st = append(st, t)
+		}
+	}
+	p.SampleType = st
+	p.DefaultSampleType = types[len(types)-1]
+	samples := p.Sample[:0]
+	for _, s := range p.Sample {
+		values := make([]int64, len(idx))
+		zero := true
+		for j, i := range idx {
+			values[j] = s.Value[i]
+			zero = zero && values[j] == 0
+		}
+		if !zero {
+			s.Value = values
+			samples = append(samples, s)
+		}
+	}
+	p.Sample = samples
+	return p.Compact()
+}
@@ -0,0 +1,87 @@
+package goprof
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// DefaultHistory is how many captures WithHistory keeps by default.
+const DefaultHistory = 1000
+
+// WithHistory appends the duration, CPU time and allocations of the session
+// to <name>.history.jsonl when it stops, keeping the newest keep entries,
+// DefaultHistory if keep <= 0. Every session of the same name adds to the
+// same file, so History shows how a code path drifts across runs and days.
+func WithHistory(keep int) Option {
+	if keep <= 0 {
+		keep = DefaultHistory
+	}
+	return func(c *config) { c.history = keep }
+}
+
+// History reads the history kept for the session name by WithHistory or an
+// agent's HistoryDir, with percentiles of the durations and CPU times. The
+// name is resolved as Start resolves it, against the working directory;
+// read histories within an FS with analysis.ParseHistory.
+func History(name string) (*HistoryReport, error) {
+	return analysis.ReadHistory(analysis.HistoryName(fullName(name)))
+}
+
+// appendHistory adds e to the history of name, a file written through s,
+// dropping the oldest entries beyond keep.
+func (s *session) appendHistory(name string, e HistoryEntry, keep int) error {
+	path := analysis.HistoryName(name)
+	var entries []HistoryEntry
+	if f, err := s.cfg.open(path); err == nil {
+		entries, err = analysis.ParseHistory(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	entries = append(entries, e)
+	if len(entries) > keep {
+		entries = entries[len(entries)-keep:]
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	// rewritten through a temporary file, so a crash leaves the old one
+	return s.writeFile("history", path, b.Bytes())
+}
+
+func historyEntry(m *Manifest) HistoryEntry {
+	e := HistoryEntry{RunID: m.RunID, Start: m.Start, Duration: m.Duration}
+	if m.Rusage != nil {
+		e.CPU = m.Rusage.CPUTime()
+	}
+	if m.Memory != nil {
+		e.Alloc = m.Memory.TotalAlloc
+	}
+	return e
+}
+
+// appendHistory adds a capture of the agent that used cpu of CPU time to
+// <HistoryDir>/<Name>.history.jsonl.
+func (a *Agent) appendHistory(m *Manifest, cpu time.Duration) error {
+	if err := os.MkdirAll(a.cfg.HistoryDir, 0o755); err != nil {
+		return err
+	}
+	e := historyEntry(m)
+	e.CPU = cpu
+	s := &session{cfg: newConfig(nil)}
+	return s.appendHistory(filepath.Join(a.cfg.HistoryDir, a.cfg.Name), e, DefaultHistory)
+}
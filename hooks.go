@@ -0,0 +1,26 @@
+package goprof
+
+import "time"
+
+// RunInfo describes a session that has just started.
+type RunInfo struct {
+	Name  string
+	RunID string
+	PID   int
+	Start time.Time
+}
+
+// WithOnStart calls f once the session has started, e.g. to tag the run in
+// an APM system. f runs on the goroutine that called Start, and its time
+// counts towards the session.
+func WithOnStart(f func(RunInfo)) Option {
+	return func(c *config) { c.onStart = f }
+}
+
+// WithOnStop calls f with the summary of the session once Stop has written
+// its artifacts, e.g. to emit metrics or post to a chat channel. f runs on
+// the goroutine that called Stop, after the session has ended, and is not
+// called if Stop failed before writing the manifest.
+func WithOnStop(f func(Report)) Option {
+	return func(c *config) { c.onStop = f }
+}
@@ -0,0 +1,33 @@
+package goprof
+
+import (
+	"context"
+	"sort"
+)
+
+// Do runs f with labels added to the goroutine's pprof labels, so that the
+// CPU and goroutine profiles attribute its samples to them, e.g. per
+// tenant or job:
+//
+//	goprof.Do(ctx, map[string]string{"tenant": id}, func(ctx context.Context) {
+//		handle(ctx, req)
+//	})
+//
+// Goroutines started by f inherit the labels; pass ctx on to keep them for
+// nested Do calls. See pprof.Do.
+func Do(ctx context.Context, labels map[string]string, f func(ctx context.Context)) {
+	if buildDisabled {
+		f(ctx)
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		args = append(args, k, labels[k])
+	}
+	withLabels(ctx, args, f)
+}
@@ -0,0 +1,81 @@
+package goprof
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// WithLeakCheck records the goroutines alive at Start and reports the ones
+// started afterwards that are still running at Stop, with their creation
+// stacks, in the summary and the manifest.
+//
+// Goroutines get a short grace period to exit before they count as leaked.
+func WithLeakCheck() Option {
+	return func(c *config) { c.leakCheck = true }
+}
+
+const packagePrefix = "github.com/jcocozza/goprof."
+
+func goroutines() []analysis.Goroutine {
+	var buf bytes.Buffer
+	writeProfile("goroutine", &buf, 2)
+	gs, _ := analysis.ParseGoroutines(&buf)
+	return gs
+}
+
+// ours reports goroutines that goprof runs itself, including the one
+// currently inside Stop and the profilers it keeps running for other
+// sessions.
+func ours(g analysis.Goroutine) bool {
+	for _, prefix := range []string{packagePrefix, "runtime/pprof.", "runtime/trace."} {
+		if strings.HasPrefix(g.CreatedBy.Func, prefix) {
+			return true
+		}
+	}
+	for _, f := range g.Stack {
+		if strings.HasPrefix(f.Func, packagePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func goroutineIDs() map[int]bool {
+	ids := map[int]bool{}
+	for _, g := range goroutines() {
+		ids[g.ID] = true
+	}
+	return ids
+}
+
+func findLeaks(before map[int]bool) []analysis.Goroutine {
+	var leaks []analysis.Goroutine
+	for wait := time.Millisecond; ; wait *= 2 {
+		leaks = leaks[:0]
+		for _, g := range goroutines() {
+			if !before[g.ID] && !ours(g) {
+				leaks = append(leaks, g)
+			}
+		}
+		if len(leaks) == 0 || wait > 128*time.Millisecond {
+			return leaks
+		}
+		time.Sleep(wait)
+	}
+}
+
+func writeLeaks(w io.Writer, leaks []analysis.Goroutine) {
+	if len(leaks) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "leaked %d goroutines:\n", len(leaks))
+	d := analysis.CompareGoroutines(nil, leaks)
+	for _, g := range d.Groups {
+		fmt.Fprintf(w, "  %d x %s created by %s\n", g.After, g.Entry, g.CreatedBy)
+	}
+}
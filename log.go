@@ -0,0 +1,44 @@
+package goprof
+
+import (
+	"log/slog"
+	"os"
+)
+
+// defaultLogger reports what goes wrong in the background, and the URLs
+// of WithOpenUI, on stderr. Session events are logged at debug level.
+var defaultLogger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// WithLogger sends the session's events to l: start and stop and every
+// artifact written at debug level, the URLs of WithOpenUI at info level,
+// and errors that have no caller to be returned to at error level.
+// By default they go to stderr, without the debug events.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *config) { c.logger, c.quiet = l, false }
+}
+
+// WithQuiet keeps the session from writing anything to stdout or stderr,
+// including the output of the tools WithOpenUI starts. The one exception
+// is the runtime's own complaint about WithCPUProfileRate.
+func WithQuiet() Option {
+	return func(c *config) { c.logger, c.quiet = slog.New(slog.DiscardHandler), true }
+}
+
+// sessionLogger is the logger of the newest running or the last session.
+func sessionLogger() *slog.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	if s := running(""); s != nil {
+		return s.cfg.logger
+	}
+	if last != nil {
+		return last.cfg.logger
+	}
+	return defaultLogger
+}
+
+func logArtifacts(l *slog.Logger, m *Manifest) {
+	for _, a := range m.Artifacts {
+		l.Debug("goprof: wrote artifact", "session", m.Name, "type", a.Type, "path", a.Path, "size", a.Size)
+	}
+}
@@ -0,0 +1,215 @@
+package goprof
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// EnvRunID is the environment variable used to tie the sessions of several
+// processes together under one logical run.
+//
+// Set it in the environment of every stage of a pipeline and the manifests
+// those stages write can later be combined with LoadRun.
+const EnvRunID = "GOPROF_RUN_ID"
+
+// EnvDir is the environment variable `goprof run` sets to its run
+// directory. While it is set, sessions with relative names are written
+// below it, so the bundles of a program run that way are collected with
+// the run.
+const EnvDir = "GOPROF_DIR"
+
+// sessionName places a relative session name below EnvDir.
+func sessionName(name string) string {
+	if dir := os.Getenv(EnvDir); dir != "" && !filepath.IsAbs(name) {
+		return filepath.Join(dir, name)
+	}
+	return name
+}
+
+// RunID returns the run id of the current process.
+//
+// It is taken from GOPROF_RUN_ID when set. Otherwise a new id is generated
+// and exported to GOPROF_RUN_ID so that child processes inherit it.
+func RunID() string {
+	if id := os.Getenv(EnvRunID); id != "" {
+		return id
+	}
+	id := newRunID()
+	os.Setenv(EnvRunID, id)
+	return id
+}
+
+func newRunID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func artifact(typ string, f *outFile) Artifact {
+	a := Artifact{Type: typ, Path: f.name, Size: f.size}
+	if f.enc != nil {
+		a.Encryption = analysis.EncryptionAge
+	}
+	return a
+}
+
+func newManifest(name string, start, end time.Time, artifacts []Artifact) *Manifest {
+	host, _ := os.Hostname()
+	return &Manifest{
+		Name:      name,
+		RunID:     RunID(),
+		PID:       os.Getpid(),
+		Host:      host,
+		GoVersion: runtime.Version(),
+		Start:     start,
+		End:       end,
+		Duration:  end.Sub(start),
+		Artifacts: artifacts,
+	}
+}
+
+// writeManifest also returns the manifest if writing it or one of the
+// reports derived from the profiles failed.
+func (s *session) writeManifest() (*Manifest, error) {
+	var artifacts []Artifact
+	for _, f := range []struct {
+		typ string
+		f   *outFile
+	}{
+		{"cpu", s.cpu},
+		{"block", s.block},
+		{"trace", s.trace},
+		{"heap", s.heap},
+		{"goroutines", s.goroutines},
+		{"metrics", s.metrics},
+	} {
+		switch {
+		case f.f == nil:
+		case f.typ == "trace":
+			artifacts = append(artifacts, s.traceArtifact())
+		default:
+			artifacts = append(artifacts, artifact(f.typ, f.f))
+		}
+	}
+	artifacts = append(artifacts, s.extra...)
+	m := newManifest(s.name, s.start, s.end, artifacts)
+	m.RunID = s.runID
+	mem := s.memDelta()
+	m.Memory = &mem
+	m.GC = s.gc
+	m.CPU = cpuLimits(s.cgStart, s.cgEnd)
+	if s.ruOK {
+		m.Rusage = rusageDelta(s.ruStart, s.ruEnd)
+	}
+	m.Leaks = s.leaks
+	m.Nested = s.nested
+	m.Paused = s.paused
+	m.Phases = s.phases
+	m.Children = s.childManifests()
+	if s.runtimeSum != nil {
+		m.Runtime = s.runtimeSum
+		if a, ok := m.Artifact("block"); ok {
+			if prof, err := s.cfg.readProfile(a.Path); err == nil {
+				m.Runtime.Blocking = analysis.Blocking(prof, blockingN)
+			}
+		}
+	}
+	m.Warnings = append(s.cfg.budget.Check(m), analysis.CheckCPU(m)...)
+	m.Warnings = append(m.Warnings, s.warnings...)
+	// the reports derive from the profiles; one that fails costs neither
+	// the others nor the manifest
+	var errs []error
+	report := func(what string, err error) {
+		if err != nil {
+			m.Warnings = append(m.Warnings, what+": "+err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", what, err))
+		}
+	}
+	if len(s.cfg.flameGraphs) > 0 {
+		as, err := s.writeFlameGraphs(m)
+		m.Artifacts = append(m.Artifacts, as...)
+		report("flame graphs", err)
+	}
+	if len(s.cfg.speedscope) > 0 {
+		as, err := s.writeSpeedscope(m)
+		m.Artifacts = append(m.Artifacts, as...)
+		report("speedscope", err)
+	}
+	if s.cfg.lineReport {
+		a, ok, err := s.writeLineReport(m)
+		if ok {
+			m.Artifacts = append(m.Artifacts, a)
+		}
+		report("line report", err)
+	}
+	if s.cfg.htmlReport {
+		a, err := s.writeReport(m)
+		if err == nil {
+			m.Artifacts = append(m.Artifacts, a)
+		}
+		report("HTML report", err)
+	}
+	m.Overhead = s.overhead(m)
+	if m.Overhead.CPUPct >= overheadWarnPct {
+		m.Warnings = append(m.Warnings, fmt.Sprintf("goprof's collectors took about %.0f%% of the CPU time, which inflates the timings", m.Overhead.CPUPct))
+	}
+
+	// on disk, artifact paths are relative to the manifest
+	onDisk := *m
+	if len(s.cfg.recipients) > 0 {
+		// function names are what encryption keeps off the disk
+		onDisk.Leaks = nil
+		if m.Runtime != nil {
+			rt := *m.Runtime
+			rt.Blocking = nil
+			onDisk.Runtime = &rt
+		}
+	}
+	onDisk.Artifacts = make([]Artifact, len(m.Artifacts))
+	dir := filepath.Dir(manifestName(s.name))
+	for i, a := range m.Artifacts {
+		if rel, err := filepath.Rel(dir, a.Path); err == nil {
+			a.Path = rel
+		}
+		onDisk.Artifacts[i] = a
+	}
+	onDisk.Children = make([]string, len(m.Children))
+	for i, c := range m.Children {
+		if rel, err := filepath.Rel(dir, c); err == nil {
+			c = rel
+		}
+		onDisk.Children[i] = c
+	}
+	b, err := json.MarshalIndent(&onDisk, "", "  ")
+	if err == nil {
+		err = s.writeFile("manifest", manifestName(s.name), b)
+	}
+	return m, errors.Join(append(errs, err)...)
+}
+
+func (s *session) traceArtifact() Artifact {
+	a := artifact("trace", s.trace)
+	if s.traceZst != nil {
+		a.Compression = analysis.CompressionZstdSeekable
+		a.Chunks = s.traceZst.chunks
+	}
+	return a
+}
+
+func (s *session) writeReport(m *Manifest) (Artifact, error) {
+	return s.writeArtifact("report", func(w io.Writer) error {
+		return analysis.HTMLReport{Runtime: s.cfg.runtimeStacks["report"], FS: s.cfg.readFS()}.Write(w, m)
+	})
+}
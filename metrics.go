@@ -0,0 +1,158 @@
+package goprof
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+const (
+	metricHeap       = "/memory/classes/heap/objects:bytes"
+	metricGoroutines = "/sched/goroutines:goroutines"
+	metricGCCycles   = "/gc/cycles/total:gc-cycles"
+	metricGCPauses   = "/sched/pauses/total/gc:seconds"
+	metricGCCPU      = "/cpu/classes/gc/total:cpu-seconds"
+	metricTotalCPU   = "/cpu/classes/total:cpu-seconds"
+	metricSchedLat   = "/sched/latencies:seconds"
+)
+
+// metricsSampler writes a runtime/metrics timeline while a session runs.
+type metricsSampler struct {
+	f       io.Writer
+	buf     *bufio.Writer
+	w       *csv.Writer
+	start   time.Time
+	samples []metrics.Sample
+
+	// previous cumulative values, to turn them into per-interval numbers
+	gcCPU, totalCPU float64
+	lat             []uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startMetrics(f io.Writer, interval time.Duration) *metricsSampler {
+	m := &metricsSampler{
+		f:     f,
+		buf:   bufio.NewWriter(f),
+		start: time.Now(),
+		samples: []metrics.Sample{
+			{Name: metricHeap},
+			{Name: metricGoroutines},
+			{Name: metricGCCycles},
+			{Name: metricGCCPU},
+			{Name: metricTotalCPU},
+			{Name: metricSchedLat},
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	m.w = csv.NewWriter(m.buf)
+	m.w.Write(analysis.MetricsHeader)
+	m.sample()
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sample()
+			case <-m.stop:
+				m.sample()
+				return
+			}
+		}
+	}()
+	return m
+}
+
+// finish takes a last sample and flushes the timeline; the file is closed
+// with the other artifacts.
+func (m *metricsSampler) finish() error {
+	close(m.stop)
+	<-m.done
+	m.w.Flush()
+	if err := m.w.Error(); err != nil {
+		return err
+	}
+	return m.buf.Flush()
+}
+
+func (m *metricsSampler) sample() {
+	now := time.Now()
+	metrics.Read(m.samples)
+	heap := m.samples[0].Value.Uint64()
+	goroutines := m.samples[1].Value.Uint64()
+	cycles := m.samples[2].Value.Uint64()
+	gcCPU := m.samples[3].Value.Float64()
+	totalCPU := m.samples[4].Value.Float64()
+	lat := m.samples[5].Value.Float64Histogram()
+
+	// the cpu metrics are only refreshed on GC, so the fraction is often 0
+	var fraction float64
+	if d := totalCPU - m.totalCPU; d > 0 {
+		fraction = (gcCPU - m.gcCPU) / d
+	}
+	p50, p99 := latencyPercentiles(lat, m.lat)
+	m.gcCPU, m.totalCPU = gcCPU, totalCPU
+	m.lat = append(m.lat[:0], lat.Counts...)
+
+	m.w.Write([]string{
+		now.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(float64(now.Sub(m.start).Microseconds())/1000, 'f', 3, 64),
+		strconv.FormatUint(heap, 10),
+		strconv.FormatUint(goroutines, 10),
+		strconv.FormatUint(cycles, 10),
+		strconv.FormatFloat(fraction, 'f', 4, 64),
+		strconv.FormatFloat(p50*1e6, 'f', 1, 64),
+		strconv.FormatFloat(p99*1e6, 'f', 1, 64),
+	})
+}
+
+// latencyPercentiles estimates the median and 99th percentile of the
+// latencies recorded since the previous sample, in seconds.
+func latencyPercentiles(h *metrics.Float64Histogram, prev []uint64) (p50, p99 float64) {
+	counts := make([]uint64, len(h.Counts))
+	var total uint64
+	for i, c := range h.Counts {
+		if i < len(prev) {
+			c -= prev[i]
+		}
+		counts[i] = c
+		total += c
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	at := func(q float64) float64 {
+		rank := uint64(math.Ceil(q * float64(total)))
+		var seen uint64
+		for i, c := range counts {
+			seen += c
+			if seen >= rank {
+				// report the upper bound of the bucket, unless it is unbounded
+				if up := h.Buckets[i+1]; !math.IsInf(up, 1) {
+					return up
+				}
+				return h.Buckets[i]
+			}
+		}
+		return h.Buckets[len(h.Buckets)-1]
+	}
+	return at(0.50), at(0.99)
+}
+
+// WithMetrics samples runtime/metrics every interval while the session runs
+// and writes the timeline to <name>.metrics.csv: heap bytes, goroutine
+// count, GC cycles, GC CPU fraction and scheduler latency.
+func WithMetrics(interval time.Duration) Option {
+	return func(c *config) { c.metricsInterval = interval }
+}
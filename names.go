@@ -0,0 +1,106 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+var ErrNameTemplate = errors.New("name template without {type}")
+
+// WithNameTemplate names the session's files after tmpl instead of
+// <name>.<type>.<ext>, e.g.
+//
+//	goprof.WithNameTemplate("{service}-{name}-{ts}.{type}.{ext}")
+//
+// The placeholders are {service} (the executable name), {name} (the last
+// element of the session name), {run_id}, {host}, {pid}, {ts} (when Start
+// was called, as 20060102T150405Z), {type} (the artifact type, e.g. "cpu"
+// or "heap-001") and {ext} (the extension goprof would give it, e.g.
+// "pprof"). The files go to the directory of the session name; the
+// manifest keeps its name, <name>.manifest.json, so tools can find it.
+//
+// tmpl must contain {type}, or every artifact would get the same file;
+// Start fails with ErrNameTemplate otherwise.
+func WithNameTemplate(tmpl string) Option {
+	return func(c *config) {
+		if !strings.Contains(tmpl, "{type}") {
+			c.err = fmt.Errorf("%w %q", ErrNameTemplate, tmpl)
+			return
+		}
+		c.nameTemplate = tmpl
+	}
+}
+
+// fileName is the file the artifact typ of s is written to.
+func (s *session) fileName(typ string) string {
+	if s.cfg.nameTemplate == "" {
+		return analysis.FileName(s.name, typ)
+	}
+	exe, _ := os.Executable()
+	host, _ := os.Hostname()
+	ts := ""
+	if !s.created.IsZero() {
+		ts = s.created.UTC().Format("20060102T150405Z")
+	}
+	base := strings.NewReplacer(
+		"{service}", sanitize(strings.TrimSuffix(filepath.Base(exe), ".exe")),
+		"{name}", filepath.Base(s.name),
+		"{run_id}", sanitize(s.runID),
+		"{host}", sanitize(host),
+		"{pid}", strconv.Itoa(os.Getpid()),
+		"{ts}", ts,
+		"{type}", typ,
+		"{ext}", analysis.FileExt(typ),
+	).Replace(s.cfg.nameTemplate)
+	return filepath.Join(filepath.Dir(s.name), base)
+}
+
+// fullName is the name a session started as name gets: prefixed as
+// EnvNamePrefix says, below EnvDir and sanitized.
+func fullName(name string) string {
+	return sanitizeName(sessionName(prefixName(name)))
+}
+
+// sanitizeName makes the last element of a session name safe to use in
+// file names on every platform; the directories before it are left alone.
+func sanitizeName(name string) string {
+	dir, base := filepath.Split(name)
+	return dir + sanitize(base)
+}
+
+// sanitize replaces path separators and the characters Windows does not
+// allow in file names, and prefixes the names Windows reserves for devices.
+func sanitize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	// NUL.cpu.pprof is the device too
+	stem, _, _ := strings.Cut(s, ".")
+	if reservedName(strings.TrimRight(stem, " ")) {
+		s = "_" + s
+	}
+	return s
+}
+
+func reservedName(s string) bool {
+	switch strings.ToUpper(s) {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	if len(s) == 4 && s[3] >= '1' && s[3] <= '9' {
+		switch strings.ToUpper(s[:3]) {
+		case "COM", "LPT":
+			return true
+		}
+	}
+	return false
+}
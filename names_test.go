@@ -0,0 +1,80 @@
+package goprof
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSanitize(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"checkout", "checkout"},
+		{"api/v1", "api_v1"},
+		{`api\v1`, "api_v1"},
+		{`a:b*c?d"e<f>g|h`, "a_b_c_d_e_f_g_h"},
+		{"tab\there\nnew\x00", "tab_here_new_"},
+		{"héllo wörld", "héllo wörld"},
+		{"", ""},
+	} {
+		if got := sanitize(tt.in); got != tt.want {
+			t.Errorf("sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	// the directories are the caller's, only the last element is cleaned
+	in := filepath.Join("out", "a:b", "c:d")
+	if got, want := sanitizeName(in), filepath.Join("out", "a:b", "c_d"); got != want {
+		t.Errorf("sanitizeName(%q) = %q, want %q", in, got, want)
+	}
+}
+
+func TestFileNameTemplate(t *testing.T) {
+	host, _ := os.Hostname()
+	s := &session{
+		name:    filepath.Join("out", "checkout"),
+		runID:   "run/1",
+		created: time.Date(2026, 3, 4, 5, 6, 7, 0, time.FixedZone("", 3600)),
+		cfg:     config{nameTemplate: "{name}-{run_id}-{host}-{pid}-{ts}.{type}.{ext}"},
+	}
+	want := filepath.Join("out", "checkout-run_1-"+sanitize(host)+"-"+strconv.Itoa(os.Getpid())+"-20260304T040607Z.cpu.pprof")
+	if got := s.fileName("cpu"); got != want {
+		t.Errorf("fileName = %q, want %q", got, want)
+	}
+	s.cfg.nameTemplate = ""
+	if got, want := s.fileName("cpu"), filepath.Join("out", "checkout.cpu.pprof"); got != want {
+		t.Errorf("fileName without a template = %q, want %q", got, want)
+	}
+}
+
+func TestSanitizeReservedNames(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"CON", "_CON"},
+		{"con", "_con"},
+		{"nul.txt", "_nul.txt"},
+		{"NUL.cpu.pprof", "_NUL.cpu.pprof"},
+		{"Aux ", "_Aux "},
+		{"prn .log", "_prn .log"},
+		{"COM1", "_COM1"},
+		{"lpt9.trace", "_lpt9.trace"},
+		// not a device
+		{"COM0", "COM0"},
+		{"COM10", "COM10"},
+		{"LPT", "LPT"},
+		{"console", "console"},
+		{"xNUL", "xNUL"},
+		{"a.NUL", "a.NUL"},
+	} {
+		if got := sanitize(tt.in); got != tt.want {
+			t.Errorf("sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	t.Setenv(EnvDir, "")
+	t.Setenv(EnvNamePrefix, "")
+	if got, want := fullName(filepath.Join("out", "aux")), filepath.Join("out", "_aux"); got != want {
+		t.Errorf("fullName = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package goprof
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Notification tells a Notifier that a capture has landed.
+type Notification struct {
+	// Source is "session" for a session ended by Stop and "agent" for a
+	// capture of an Agent.
+	Source   string        `json:"source"`
+	Name     string        `json:"name"`
+	RunID    string        `json:"run_id,omitempty"`
+	Host     string        `json:"host,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// Artifacts are where the files are: absolute paths for a session
+	// written to disk, paths within the FS given to WithFS, and the file
+	// names handed to the sink for an agent capture.
+	Artifacts []Artifact `json:"artifacts"`
+	Warnings  []string   `json:"warnings,omitempty"`
+}
+
+// Notifier is told about every finished capture, e.g. to let a team know
+// when and where the profiles of a shared environment land.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// notifyTimeout bounds how long Stop or an agent waits for a notifier.
+const notifyTimeout = 10 * time.Second
+
+// WithNotifier also tells n about the session once Stop has written it. It
+// can be given more than once. A failed notification is returned by Stop;
+// the files are kept.
+func WithNotifier(n Notifier) Option {
+	return func(c *config) { c.notifiers = append(c.notifiers, n) }
+}
+
+func newNotification(source string, m *Manifest, abs bool) Notification {
+	n := Notification{
+		Source:    source,
+		Name:      m.Name,
+		RunID:     m.RunID,
+		Host:      m.Host,
+		Start:     m.Start,
+		Duration:  m.Duration,
+		Artifacts: slices.Clone(m.Artifacts),
+		Warnings:  m.Warnings,
+	}
+	if abs {
+		for i, a := range n.Artifacts {
+			if p, err := filepath.Abs(a.Path); err == nil {
+				n.Artifacts[i].Path = p
+			}
+		}
+	}
+	return n
+}
+
+// notify tells every notifier about n, each within notifyTimeout.
+func notify(ctx context.Context, notifiers []Notifier, n Notification) error {
+	var errs []error
+	for _, nf := range notifiers {
+		ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		if err := nf.Notify(ctx, n); err != nil {
+			errs = append(errs, fmt.Errorf("notifying about %s: %w", n.Name, err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// WebhookNotifier posts every Notification as JSON to URL.
+type WebhookNotifier struct {
+	URL string
+	// Header is added to every request, e.g. for an Authorization token.
+	Header http.Header
+	// Client is http.DefaultClient by default.
+	Client *http.Client
+}
+
+func (w WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.Client, w.URL, w.Header, b)
+}
+
+// SlackNotifier posts a message about every Notification to a Slack
+// incoming webhook.
+type SlackNotifier struct {
+	// WebhookURL is the incoming webhook of the channel,
+	// https://hooks.slack.com/services/...
+	WebhookURL string
+	// Client is http.DefaultClient by default.
+	Client *http.Client
+}
+
+func (s SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	b, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{slackText(n)})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.WebhookURL, nil, b)
+}
+
+func slackText(n Notification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "goprof: `%s` captured %s", n.Name, n.Duration.Round(time.Millisecond))
+	if n.Host != "" {
+		fmt.Fprintf(&b, " on %s", n.Host)
+	}
+	if n.RunID != "" {
+		fmt.Fprintf(&b, " (run %s)", n.RunID)
+	}
+	for _, a := range n.Artifacts {
+		fmt.Fprintf(&b, "\n• %s: `%s`", a.Type, a.Path)
+	}
+	for _, w := range n.Warnings {
+		fmt.Fprintf(&b, "\n:warning: %s", w)
+	}
+	return b.String()
+}
+
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package goprof
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// WithOpenUI starts the web UI for each of the given artifacts ("cpu" if
+// none are given) once Stop has written them: go tool pprof -http for
+// profiles and go tool trace for "trace". The tools open a browser
+// themselves; the URLs are also logged, see WithLogger. The UIs keep running
+// after the program exits.
+func WithOpenUI(types ...string) Option {
+	if len(types) == 0 {
+		types = []string{"cpu"}
+	}
+	return func(c *config) { c.openUI = types }
+}
+
+func openUI(m *Manifest, types []string, log *slog.Logger, quiet bool) {
+	for _, typ := range types {
+		a, ok := m.Artifact(typ)
+		if !ok {
+			continue
+		}
+		if a.Encryption != "" {
+			log.Warn("goprof: not opening an encrypted artifact", "type", typ, "path", a.Path)
+			continue
+		}
+		addr, err := freeAddr()
+		if err != nil {
+			log.Error("goprof: opening UI failed", "type", typ, "err", err)
+			continue
+		}
+		tool := "pprof"
+		if typ == "trace" {
+			tool = "trace"
+		}
+		path := a.Path
+		if a.Compression != "" {
+			// the tools only read uncompressed files
+			if path, err = decompress(a); err != nil {
+				log.Error("goprof: opening UI failed", "type", typ, "err", err)
+				continue
+			}
+		}
+		cmd := exec.Command("go", "tool", tool, "-http="+addr, path)
+		if !quiet {
+			cmd.Stderr = os.Stderr
+		}
+		if err := cmd.Start(); err != nil {
+			log.Error("goprof: opening UI failed", "type", typ, "err", err)
+			continue
+		}
+		go cmd.Wait()
+		log.Info("goprof: UI started", "type", typ, "url", "http://"+addr)
+	}
+}
+
+// freeAddr picks a free local port up front, since pprof reports the
+// address it was given rather than the one it got for -http=:0.
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort("localhost", port), nil
+}
+
+// decompress writes a compressed artifact next to it without the .zst
+// suffix.
+func decompress(a Artifact) (string, error) {
+	r, err := analysis.OpenArtifact(a)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	path := strings.TrimSuffix(a.Path, ".zst")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,184 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"filippo.io/age"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// Option configures a session started with Start or Run.
+type Option func(*config)
+
+type config struct {
+	allocCounts  bool
+	crashSignals []os.Signal
+	sync         SyncPolicy
+	overlap      OverlapPolicy
+	blockRate    int
+	cpuRate      int // Hz, 0 for the default
+	memRate      int // if setMemRate
+	setMemRate   bool
+	sink         Sink
+	budget       Budget
+
+	metricsInterval time.Duration
+	heapSnapshots   time.Duration
+	wallClock       int // Hz, 0 for off
+	leakCheck       bool
+	htmlReport      bool
+	flameGraphs     []string
+	speedscope      []string
+	recipients      []age.Recipient
+	openUI          []string
+	compressTrace   bool
+	runtimeStacks   map[string]RuntimeMode // per report
+	nameTemplate    string
+	profiles        map[string]bool // nil for all
+	fs              FS              // nil for the working directory
+	keepLast        int
+	runtimeSummary  bool
+	textProfiles    bool
+	lineReport      bool
+	maxAge          time.Duration
+	history         int // entries to keep, 0 for none
+	heapSpaces      bool
+	heapGC          bool
+	phaseProfiles   bool
+
+	logger  *slog.Logger
+	quiet   bool
+	onStart func(RunInfo)
+	onStop  func(Report)
+
+	notifiers []Notifier
+
+	// recipes are the recipes being applied, innermost last, to catch
+	// one that includes itself
+	recipes []string
+
+	err error // from an option that could not be applied
+}
+
+// wants reports whether the session writes the profile typ; see
+// WithProfiles. The optional ones have options of their own.
+func (c config) wants(typ string) bool {
+	if typ == "metrics" {
+		return c.metricsInterval > 0
+	}
+	return c.profiles == nil || c.profiles[typ]
+}
+
+func newConfig(opts []Option) config {
+	c := config{budget: analysis.DefaultBudget, blockRate: 1, logger: defaultLogger}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// profileTypes are the profiles WithProfiles chooses from.
+var profileTypes = []string{"cpu", "trace", "block", "heap", "goroutines"}
+
+// WithProfiles limits the session to the given profiles out of "cpu",
+// "trace", "block", "heap" and "goroutines"; by default it writes all of
+// them. Start fails with ErrUnknownProfile for any other name.
+func WithProfiles(types ...string) Option {
+	return func(c *config) {
+		c.profiles = map[string]bool{}
+		for _, typ := range types {
+			if !slices.Contains(profileTypes, typ) {
+				c.err = fmt.Errorf("%w %q", ErrUnknownProfile, typ)
+				return
+			}
+			c.profiles[typ] = true
+		}
+	}
+}
+
+// WithAllocCounts records the exact allocations made during the session
+// under the session name, see Allocs.
+func WithAllocCounts() Option {
+	return func(c *config) { c.allocCounts = true }
+}
+
+// WithCrashHandler flushes the session when the process receives one of sigs
+// (SIGTERM and SIGQUIT if none are given, Ctrl+C and the console closing on
+// Windows) and then re-raises the signal with its default behavior
+// restored, so the process still dies as it would have. Windows cannot
+// re-raise a signal, so there the process exits with status 2.
+//
+// It is meant for programs that do not handle these signals themselves.
+// Pair it with a deferred FlushOnPanic to also cover panics.
+func WithCrashHandler(sigs ...os.Signal) Option {
+	if len(sigs) == 0 {
+		sigs = crashSignals
+	}
+	return func(c *config) { c.crashSignals = sigs }
+}
+
+// WithSink also hands every artifact and the manifest to s once Stop has
+// written them. The local files are kept.
+func WithSink(s Sink) Option {
+	return func(c *config) { c.sink = s }
+}
+
+// WithBudget replaces the default soft limits on session length and
+// artifact sizes that Stop warns about. Use Budget{} to disable them.
+func WithBudget(b Budget) Option {
+	return func(c *config) { c.budget = b }
+}
+
+// WithMaxTraceSize warns when the execution trace grows beyond n bytes,
+// 200 MiB by default; the trace viewer struggles with larger ones. It
+// changes only that limit of the session's budget, see WithBudget, and 0
+// turns the warning off.
+func WithMaxTraceSize(n int64) Option {
+	return func(c *config) {
+		sizes := maps.Clone(c.budget.Sizes)
+		if sizes == nil {
+			sizes = map[string]int64{}
+		}
+		sizes["trace"] = n
+		c.budget.Sizes = sizes
+	}
+}
+
+// WithHTMLReport also writes <name>.report.html on Stop, a single page with
+// the session metadata, summary, hottest functions and a CPU flame graph
+// that can be attached or mailed as is.
+func WithHTMLReport() Option {
+	return func(c *config) { c.htmlReport = true }
+}
+
+// WithBlockProfileRate sets the block profile rate for the session, see
+// runtime.SetBlockProfileRate. The default of 1 records every blocking
+// event, which is precise but slows down programs that block a lot; a
+// rate of 0 turns block profiling off. Stop turns it off again either way.
+func WithBlockProfileRate(rate int) Option {
+	return func(c *config) { c.blockRate = rate }
+}
+
+// WithCPUProfileRate samples the CPU profile hz times a second instead of
+// the default 100, e.g. more often for short Run targets and less often
+// for always-on production profiling. The runtime complains on stderr
+// that the rate is already set; the profile does use the new one.
+func WithCPUProfileRate(hz int) Option {
+	return func(c *config) { c.cpuRate = hz }
+}
+
+// WithMemProfileRate sets runtime.MemProfileRate, the average number of
+// bytes allocated between two heap profile samples, for the session and
+// restores it on Stop. Allocations made before Start stay sampled at the
+// old rate, which skews the in-use figures of the heap profile.
+func WithMemProfileRate(rate int) Option {
+	return func(c *config) { c.memRate, c.setMemRate = rate, true }
+}
@@ -0,0 +1,432 @@
+package goprof
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// OTLPConfig configures an OTLPExporter. Unset fields are read from the
+// standard OTEL_* environment variables.
+type OTLPConfig struct {
+	// Endpoint is the full URL profiles are posted to. It defaults to
+	// OTEL_EXPORTER_OTLP_PROFILES_ENDPOINT, then OTEL_EXPORTER_OTLP_ENDPOINT
+	// followed by /v1development/profiles, then http://localhost:4318.
+	Endpoint string
+	// Headers are added to every request, on top of OTEL_EXPORTER_OTLP_HEADERS.
+	Headers map[string]string
+	// ServiceName defaults to OTEL_SERVICE_NAME, then the executable name.
+	ServiceName string
+	// Attributes are resource attributes, on top of OTEL_RESOURCE_ATTRIBUTES.
+	Attributes map[string]string
+	// Client is http.DefaultClient by default.
+	Client *http.Client
+}
+
+// OTLPExporter is a Sink that sends pprof artifacts over the OpenTelemetry
+// profiles signal using OTLP/HTTP with JSON encoding.
+//
+// The signal is still in development; the payload follows the v1development
+// data model of opentelemetry-proto v1.7.0. The original pprof file travels
+// along as the profile's original payload. Artifacts other than pprof
+// profiles are ignored, and encrypted ones are refused with
+// analysis.ErrEncrypted.
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	resource []otlpKeyValue
+	client   *http.Client
+}
+
+func NewOTLPExporter(cfg OTLPConfig) (*OTLPExporter, error) {
+	e := &OTLPExporter{
+		endpoint: cfg.Endpoint,
+		headers:  parseOTELList(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		client:   cfg.Client,
+	}
+	if e.endpoint == "" {
+		e.endpoint = os.Getenv("OTEL_EXPORTER_OTLP_PROFILES_ENDPOINT")
+	}
+	if e.endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			base = "http://localhost:4318"
+		}
+		e.endpoint = strings.TrimSuffix(base, "/") + "/v1development/profiles"
+	}
+	if e.client == nil {
+		e.client = http.DefaultClient
+	}
+	for k, v := range cfg.Headers {
+		e.headers[k] = v
+	}
+
+	attrs := parseOTELList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	for k, v := range cfg.Attributes {
+		attrs[k] = v
+	}
+	service := cfg.ServiceName
+	if service == "" {
+		service = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	if service == "" {
+		service = attrs["service.name"]
+	}
+	if service == "" {
+		exe, _ := os.Executable()
+		service = "unknown_service:" + strings.TrimSuffix(filepath.Base(exe), ".exe")
+	}
+	attrs["service.name"] = service
+	if _, ok := attrs["process.runtime.name"]; !ok {
+		attrs["process.runtime.name"] = "go"
+		attrs["process.runtime.version"] = runtime.Version()
+	}
+	for _, k := range sortedKeys(attrs) {
+		e.resource = append(e.resource, otlpString(k, attrs[k]))
+	}
+	return e, nil
+}
+
+// parseOTELList parses the "k1=v1,k2=v2" format used by OTEL_* variables.
+func parseOTELList(s string) map[string]string {
+	m := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m
+}
+
+// otlpTypes are the artifacts the exporter sends besides the phase
+// profiles and the heap snapshots, the pprof profiles; the trace, text
+// dumps and reports have no place in OTLP.
+var otlpTypes = []string{"cpu", "heap", "block", "mutex", "allocs", "wall", "cpu-sampled"}
+
+func otlpType(typ string) bool {
+	if strings.HasSuffix(typ, "-text") {
+		return false
+	}
+	return slices.Contains(otlpTypes, typ) || strings.HasPrefix(typ, "cpu-phase-") || strings.HasPrefix(typ, "heap-")
+}
+
+func (e *OTLPExporter) Put(ctx context.Context, m *Manifest, a Artifact, r io.Reader) error {
+	if !otlpType(a.Type) {
+		return nil
+	}
+	if a.Encryption != "" {
+		return fmt.Errorf("otlp: %s: %w", a.Path, analysis.ErrEncrypted)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	prof, err := profile.ParseData(raw)
+	if err != nil {
+		return fmt.Errorf("otlp: %s: %w", a.Path, err)
+	}
+	body, err := json.Marshal(e.request(m, prof, raw))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp: %s profile: %s: %s", a.Type, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// The types below mirror the protobuf messages in their JSON form:
+// lowerCamelCase names, 64 bit integers as strings, ids as hex.
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value otlpStringExpr `json:"value"`
+}
+
+type otlpStringExpr struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpString(k, v string) otlpKeyValue {
+	return otlpKeyValue{Key: k, Value: otlpStringExpr{StringValue: v}}
+}
+
+type otlpRequest struct {
+	ResourceProfiles []otlpResourceProfiles `json:"resourceProfiles"`
+	Dictionary       otlpDictionary         `json:"dictionary"`
+}
+
+type otlpResourceProfiles struct {
+	Resource      otlpResource        `json:"resource"`
+	ScopeProfiles []otlpScopeProfiles `json:"scopeProfiles"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeProfiles struct {
+	Scope    otlpScope     `json:"scope"`
+	Profiles []otlpProfile `json:"profiles"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpDictionary struct {
+	MappingTable   []otlpMapping  `json:"mappingTable"`
+	LocationTable  []otlpLocation `json:"locationTable"`
+	FunctionTable  []otlpFunction `json:"functionTable"`
+	StringTable    []string       `json:"stringTable"`
+	AttributeTable []otlpKeyValue `json:"attributeTable"`
+}
+
+type otlpValueType struct {
+	TypeStrindex int32 `json:"typeStrindex"`
+	UnitStrindex int32 `json:"unitStrindex"`
+	// 2 = AGGREGATION_TEMPORALITY_CUMULATIVE, 1 = DELTA
+	AggregationTemporality int `json:"aggregationTemporality"`
+}
+
+type otlpProfile struct {
+	SampleType            []otlpValueType `json:"sampleType"`
+	Sample                []otlpSample    `json:"sample"`
+	LocationIndices       []int32         `json:"locationIndices"`
+	TimeNanos             string          `json:"timeNanos"`
+	DurationNanos         string          `json:"durationNanos"`
+	PeriodType            otlpValueType   `json:"periodType"`
+	Period                string          `json:"period"`
+	ProfileID             string          `json:"profileId"`
+	AttributeIndices      []int32         `json:"attributeIndices,omitempty"`
+	OriginalPayloadFormat string          `json:"originalPayloadFormat"`
+	OriginalPayload       []byte          `json:"originalPayload"`
+}
+
+type otlpSample struct {
+	LocationsStartIndex int32    `json:"locationsStartIndex"`
+	LocationsLength     int32    `json:"locationsLength"`
+	Value               []string `json:"value"`
+	AttributeIndices    []int32  `json:"attributeIndices,omitempty"`
+}
+
+type otlpMapping struct {
+	MemoryStart      string `json:"memoryStart"`
+	MemoryLimit      string `json:"memoryLimit"`
+	FileOffset       string `json:"fileOffset"`
+	FilenameStrindex int32  `json:"filenameStrindex"`
+	HasFunctions     bool   `json:"hasFunctions"`
+	HasFilenames     bool   `json:"hasFilenames"`
+	HasLineNumbers   bool   `json:"hasLineNumbers"`
+}
+
+type otlpLocation struct {
+	MappingIndex *int32     `json:"mappingIndex,omitempty"`
+	Address      string     `json:"address"`
+	Line         []otlpLine `json:"line"`
+}
+
+type otlpLine struct {
+	FunctionIndex int32  `json:"functionIndex"`
+	Line          string `json:"line"`
+}
+
+type otlpFunction struct {
+	NameStrindex       int32  `json:"nameStrindex"`
+	SystemNameStrindex int32  `json:"systemNameStrindex"`
+	FilenameStrindex   int32  `json:"filenameStrindex"`
+	StartLine          string `json:"startLine"`
+}
+
+// otlpTables interns strings, attributes and pprof entities into the
+// shared dictionary the request carries.
+type otlpTables struct {
+	dict      otlpDictionary
+	strings   map[string]int32
+	attrs     map[otlpKeyValue]int32
+	mappings  map[uint64]int32
+	locations map[uint64]int32
+	functions map[uint64]int32
+}
+
+func (t *otlpTables) str(s string) int32 {
+	if i, ok := t.strings[s]; ok {
+		return i
+	}
+	i := int32(len(t.dict.StringTable))
+	t.dict.StringTable = append(t.dict.StringTable, s)
+	t.strings[s] = i
+	return i
+}
+
+func (t *otlpTables) attr(k, v string) int32 {
+	kv := otlpString(k, v)
+	if i, ok := t.attrs[kv]; ok {
+		return i
+	}
+	i := int32(len(t.dict.AttributeTable))
+	t.dict.AttributeTable = append(t.dict.AttributeTable, kv)
+	t.attrs[kv] = i
+	return i
+}
+
+func (t *otlpTables) function(f *profile.Function) int32 {
+	if i, ok := t.functions[f.ID]; ok {
+		return i
+	}
+	i := int32(len(t.dict.FunctionTable))
+	t.dict.FunctionTable = append(t.dict.FunctionTable, otlpFunction{
+		NameStrindex:       t.str(f.Name),
+		SystemNameStrindex: t.str(f.SystemName),
+		FilenameStrindex:   t.str(f.Filename),
+		StartLine:          strconv.FormatInt(f.StartLine, 10),
+	})
+	t.functions[f.ID] = i
+	return i
+}
+
+func (t *otlpTables) mapping(m *profile.Mapping) int32 {
+	if i, ok := t.mappings[m.ID]; ok {
+		return i
+	}
+	i := int32(len(t.dict.MappingTable))
+	t.dict.MappingTable = append(t.dict.MappingTable, otlpMapping{
+		MemoryStart:      strconv.FormatUint(m.Start, 10),
+		MemoryLimit:      strconv.FormatUint(m.Limit, 10),
+		FileOffset:       strconv.FormatUint(m.Offset, 10),
+		FilenameStrindex: t.str(m.File),
+		HasFunctions:     m.HasFunctions,
+		HasFilenames:     m.HasFilenames,
+		HasLineNumbers:   m.HasLineNumbers,
+	})
+	t.mappings[m.ID] = i
+	return i
+}
+
+func (t *otlpTables) location(l *profile.Location) int32 {
+	if i, ok := t.locations[l.ID]; ok {
+		return i
+	}
+	loc := otlpLocation{Address: strconv.FormatUint(l.Address, 10)}
+	if l.Mapping != nil {
+		mi := t.mapping(l.Mapping)
+		loc.MappingIndex = &mi
+	}
+	for _, ln := range l.Line {
+		loc.Line = append(loc.Line, otlpLine{
+			FunctionIndex: t.function(ln.Function),
+			Line:          strconv.FormatInt(ln.Line, 10),
+		})
+	}
+	i := int32(len(t.dict.LocationTable))
+	t.dict.LocationTable = append(t.dict.LocationTable, loc)
+	t.locations[l.ID] = i
+	return i
+}
+
+func (e *OTLPExporter) request(m *Manifest, prof *profile.Profile, raw []byte) otlpRequest {
+	t := &otlpTables{
+		strings:   map[string]int32{},
+		attrs:     map[otlpKeyValue]int32{},
+		mappings:  map[uint64]int32{},
+		locations: map[uint64]int32{},
+		functions: map[uint64]int32{},
+	}
+	t.str("") // index 0 is always the empty string
+
+	// cpu profiles are deltas over the session, the rest are cumulative
+	temporality := 2
+	if prof.PeriodType != nil && prof.PeriodType.Type == "cpu" {
+		temporality = 1
+	}
+	var id [16]byte
+	rand.Read(id[:])
+	out := otlpProfile{
+		TimeNanos:             strconv.FormatInt(prof.TimeNanos, 10),
+		DurationNanos:         strconv.FormatInt(prof.DurationNanos, 10),
+		Period:                strconv.FormatInt(prof.Period, 10),
+		ProfileID:             hex.EncodeToString(id[:]),
+		OriginalPayloadFormat: "pprofext",
+		OriginalPayload:       raw,
+	}
+	if prof.PeriodType != nil {
+		out.PeriodType = otlpValueType{TypeStrindex: t.str(prof.PeriodType.Type), UnitStrindex: t.str(prof.PeriodType.Unit), AggregationTemporality: temporality}
+	}
+	for _, st := range prof.SampleType {
+		out.SampleType = append(out.SampleType, otlpValueType{TypeStrindex: t.str(st.Type), UnitStrindex: t.str(st.Unit), AggregationTemporality: temporality})
+	}
+	out.AttributeIndices = append(out.AttributeIndices, t.attr("goprof.session", m.Name))
+	if m.RunID != "" {
+		out.AttributeIndices = append(out.AttributeIndices, t.attr("goprof.run_id", m.RunID))
+	}
+
+	for _, s := range prof.Sample {
+		sample := otlpSample{
+			LocationsStartIndex: int32(len(out.LocationIndices)),
+			LocationsLength:     int32(len(s.Location)),
+		}
+		for _, l := range s.Location {
+			out.LocationIndices = append(out.LocationIndices, t.location(l))
+		}
+		for _, v := range s.Value {
+			sample.Value = append(sample.Value, strconv.FormatInt(v, 10))
+		}
+		for _, k := range sortedKeys(s.Label) {
+			for _, v := range s.Label[k] {
+				sample.AttributeIndices = append(sample.AttributeIndices, t.attr(k, v))
+			}
+		}
+		out.Sample = append(out.Sample, sample)
+	}
+
+	return otlpRequest{
+		ResourceProfiles: []otlpResourceProfiles{{
+			Resource: otlpResource{Attributes: e.resource},
+			ScopeProfiles: []otlpScopeProfiles{{
+				Scope:    otlpScope{Name: "github.com/jcocozza/goprof"},
+				Profiles: []otlpProfile{out},
+			}},
+		}},
+		Dictionary: t.dict,
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
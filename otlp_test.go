@@ -0,0 +1,197 @@
+package goprof
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// otlpTestProfile is a CPU profile with a shared caller, a mapping and
+// labels, what the exporter has to flatten into the dictionary.
+func otlpTestProfile() *profile.Profile {
+	m := &profile.Mapping{ID: 1, Start: 0x400000, Limit: 0x500000, File: "/bin/app", HasFunctions: true}
+	fn := func(id uint64, name string) *profile.Function {
+		return &profile.Function{ID: id, Name: name, SystemName: name, Filename: "app.go", StartLine: int64(id) * 10}
+	}
+	main, parse, encode := fn(1, "main.main"), fn(2, "main.parse"), fn(3, "main.encode")
+	loc := func(id uint64, f *profile.Function, line int64) *profile.Location {
+		return &profile.Location{ID: id, Mapping: m, Address: 0x400000 + id, Line: []profile.Line{{Function: f, Line: line}}}
+	}
+	lmain, lparse, lencode := loc(1, main, 12), loc(2, parse, 25), loc(3, encode, 31)
+	return &profile.Profile{
+		SampleType:    []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType:    &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:        10_000_000,
+		TimeNanos:     1_700_000_000_000_000_000,
+		DurationNanos: 1_000_000_000,
+		Mapping:       []*profile.Mapping{m},
+		Function:      []*profile.Function{main, parse, encode},
+		Location:      []*profile.Location{lmain, lparse, lencode},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{lparse, lmain}, Value: []int64{3, 30_000_000}, Label: map[string][]string{"route": {"/checkout"}}},
+			{Location: []*profile.Location{lencode, lmain}, Value: []int64{1, 10_000_000}, Label: map[string][]string{"route": {"/checkout"}, "tenant": {"a"}}},
+		},
+	}
+}
+
+func TestOTLPExporterRoundTrip(t *testing.T) {
+	var raw bytes.Buffer
+	if err := otlpTestProfile().Write(&raw); err != nil {
+		t.Fatal(err)
+	}
+	prof, err := profile.ParseData(raw.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got otlpRequest
+	var header http.Header
+	e, err := NewOTLPExporter(OTLPConfig{
+		Endpoint:    "http://collector/v1development/profiles",
+		Headers:     map[string]string{"X-Token": "secret"},
+		ServiceName: "checkout",
+		Attributes:  map[string]string{"deployment.environment": "test"},
+		Client: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			header = req.Header
+			if err := json.NewDecoder(req.Body).Decode(&got); err != nil {
+				t.Error(err)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+		})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{Name: "S", RunID: "run-1"}
+	if err := e.Put(t.Context(), m, Artifact{Type: "cpu", Path: "S.cpu.pprof"}, bytes.NewReader(raw.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("Content-Type") != "application/json" || header.Get("X-Token") != "secret" {
+		t.Errorf("headers %v", header)
+	}
+
+	rp := got.ResourceProfiles[0]
+	attrs := map[string]string{}
+	for _, kv := range rp.Resource.Attributes {
+		attrs[kv.Key] = kv.Value.StringValue
+	}
+	if attrs["service.name"] != "checkout" || attrs["deployment.environment"] != "test" || attrs["process.runtime.name"] != "go" {
+		t.Errorf("resource attributes %v", attrs)
+	}
+	d := got.Dictionary
+	if d.StringTable[0] != "" {
+		t.Errorf("string 0 is %q, want empty", d.StringTable[0])
+	}
+	out := rp.ScopeProfiles[0].Profiles[0]
+	if !bytes.Equal(out.OriginalPayload, raw.Bytes()) || out.OriginalPayloadFormat != "pprofext" {
+		t.Error("original payload is not the pprof file")
+	}
+	if out.TimeNanos != "1700000000000000000" || out.DurationNanos != "1000000000" || out.Period != "10000000" {
+		t.Errorf("time %s, duration %s, period %s", out.TimeNanos, out.DurationNanos, out.Period)
+	}
+	if len(out.ProfileID) != 32 {
+		t.Errorf("profile id %q is not 16 bytes of hex", out.ProfileID)
+	}
+	for i, st := range out.SampleType {
+		if d.StringTable[st.TypeStrindex] != prof.SampleType[i].Type || d.StringTable[st.UnitStrindex] != prof.SampleType[i].Unit || st.AggregationTemporality != 1 {
+			t.Errorf("sample type %d: %+v", i, st)
+		}
+	}
+	var profAttrs []string
+	for _, i := range out.AttributeIndices {
+		profAttrs = append(profAttrs, d.AttributeTable[i].Key+"="+d.AttributeTable[i].Value.StringValue)
+	}
+	if want := []string{"goprof.session=S", "goprof.run_id=run-1"}; !slices.Equal(profAttrs, want) {
+		t.Errorf("profile attributes %q, want %q", profAttrs, want)
+	}
+
+	// rebuild each sample from the dictionary and compare it with pprof's
+	if len(out.Sample) != len(prof.Sample) {
+		t.Fatalf("%d samples, want %d", len(out.Sample), len(prof.Sample))
+	}
+	for i, s := range out.Sample {
+		want := prof.Sample[i]
+		idx := out.LocationIndices[s.LocationsStartIndex : s.LocationsStartIndex+s.LocationsLength]
+		if len(idx) != len(want.Location) {
+			t.Fatalf("sample %d: %d locations, want %d", i, len(idx), len(want.Location))
+		}
+		for j, li := range idx {
+			loc, wl := d.LocationTable[li], want.Location[j]
+			mp := d.MappingTable[*loc.MappingIndex]
+			f := d.FunctionTable[loc.Line[0].FunctionIndex]
+			if d.StringTable[f.NameStrindex] != wl.Line[0].Function.Name || d.StringTable[f.FilenameStrindex] != "app.go" ||
+				loc.Line[0].Line != strconv.FormatInt(wl.Line[0].Line, 10) || loc.Address != strconv.FormatUint(wl.Address, 10) ||
+				d.StringTable[mp.FilenameStrindex] != "/bin/app" || mp.MemoryStart != strconv.FormatUint(wl.Mapping.Start, 10) || !mp.HasFunctions {
+				t.Errorf("sample %d location %d: %+v of %+v in %+v", i, j, loc, f, mp)
+			}
+		}
+		var values []string
+		for _, v := range want.Value {
+			values = append(values, strconv.FormatInt(v, 10))
+		}
+		if !slices.Equal(s.Value, values) {
+			t.Errorf("sample %d values %q, want %q", i, s.Value, values)
+		}
+		var labels, wantLabels []string
+		for _, a := range s.AttributeIndices {
+			labels = append(labels, d.AttributeTable[a].Key+"="+d.AttributeTable[a].Value.StringValue)
+		}
+		for _, k := range sortedKeys(want.Label) {
+			wantLabels = append(wantLabels, k+"="+want.Label[k][0])
+		}
+		if !slices.Equal(labels, wantLabels) {
+			t.Errorf("sample %d labels %q, want %q", i, labels, wantLabels)
+		}
+	}
+	// main.main is shared, so it is in the tables once
+	if len(d.LocationTable) != 3 || len(d.FunctionTable) != 3 || len(d.MappingTable) != 1 || len(d.AttributeTable) != 4 {
+		t.Errorf("%d locations, %d functions, %d mappings, %d attributes, want 3, 3, 1, 4",
+			len(d.LocationTable), len(d.FunctionTable), len(d.MappingTable), len(d.AttributeTable))
+	}
+}
+
+func TestOTLPExporterSkipsAndFails(t *testing.T) {
+	posts := 0
+	e, err := NewOTLPExporter(OTLPConfig{
+		Endpoint: "http://collector/v1development/profiles",
+		Client: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			posts++
+			return &http.Response{StatusCode: http.StatusBadRequest, Status: "400 Bad Request", Body: io.NopCloser(strings.NewReader("bad profile\n"))}, nil
+		})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{Name: "S"}
+	ctx := t.Context()
+	for _, typ := range []string{"trace", "goroutine-text", "report"} {
+		if err := e.Put(ctx, m, Artifact{Type: typ}, strings.NewReader("not pprof")); err != nil {
+			t.Errorf("%s: %v", typ, err)
+		}
+	}
+	if err := e.Put(ctx, m, Artifact{Type: "heap", Encryption: "age"}, strings.NewReader("")); !errors.Is(err, analysis.ErrEncrypted) {
+		t.Errorf("encrypted: %v, want %v", err, analysis.ErrEncrypted)
+	}
+	if err := e.Put(ctx, m, Artifact{Type: "cpu"}, strings.NewReader("not pprof")); err == nil {
+		t.Error("no error for a file that is not pprof")
+	}
+	if posts != 0 {
+		t.Errorf("%d posts for artifacts that are not sent", posts)
+	}
+	var raw bytes.Buffer
+	if err := otlpTestProfile().Write(&raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Put(ctx, m, Artifact{Type: "cpu-phase-warmup"}, &raw); err == nil || !strings.Contains(err.Error(), "400 Bad Request: bad profile") {
+		t.Errorf("rejected post: %v", err)
+	}
+}
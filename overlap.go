@@ -0,0 +1,30 @@
+package goprof
+
+import "sync"
+
+// OverlapPolicy decides what Start does while a session of the same name
+// is running.
+type OverlapPolicy int
+
+const (
+	// OverlapReject fails with ErrAlreadyStarted.
+	OverlapReject OverlapPolicy = iota
+	// OverlapQueue waits for the running session to stop and then starts
+	// a new one.
+	OverlapQueue
+	// OverlapMerge joins the running session instead of starting one; its
+	// options are ignored. Every merged Start needs a Stop of its own, and
+	// the session ends with the last one.
+	OverlapMerge
+)
+
+// WithOverlap sets what Start does when a session of the same name is
+// already running, e.g. when a scheduled capture is still going when the
+// next one is due. The default is OverlapReject.
+func WithOverlap(policy OverlapPolicy) Option {
+	return func(c *config) { c.overlap = policy }
+}
+
+// idle is signalled whenever a session stops; Start waits on it for
+// OverlapQueue.
+var idle = sync.NewCond(&mu)
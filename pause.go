@@ -0,0 +1,94 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrPaused = errors.New("session already paused")
+var ErrNotPaused = errors.New("session not paused")
+
+// Pause stops recording the CPU profile of the named sessions, or of the
+// newest running one if no name is given, until Resume, so expensive setup
+// or an unrelated phase in the middle of a long session stays out of it.
+// The sessions keep running; their manifests list the pauses under
+// "paused".
+//
+// The execution trace cannot be split, so it keeps running and shows the
+// pause as a task called "goprof: paused". Heap, block and allocation
+// figures count since the start of the session, pauses included.
+func Pause(names ...string) error {
+	return eachRunning(names, func(s *session) error {
+		if !s.pausedAt.IsZero() {
+			return fmt.Errorf("%w %q", ErrPaused, s.name)
+		}
+		endCPUSegment()
+		s.pausedAt = time.Now()
+		if traceOwner == s {
+			s.pauseTask = startTask("goprof: paused")
+		}
+		return s.restartCPU()
+	})
+}
+
+// Resume continues recording sessions paused with Pause, the newest running
+// one if no name is given.
+func Resume(names ...string) error {
+	return eachRunning(names, func(s *session) error {
+		if s.pausedAt.IsZero() {
+			return fmt.Errorf("%w %q", ErrNotPaused, s.name)
+		}
+		endCPUSegment()
+		s.unpause(time.Now())
+		return s.restartCPU()
+	})
+}
+
+// eachRunning calls f with the lock held for the running session of every
+// name, or the newest one if there are none.
+func eachRunning(names []string, f func(*session) error) error {
+	if disabled() {
+		return nil
+	}
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var errs []error
+	for _, name := range names {
+		s := running(name)
+		switch {
+		case s != nil:
+			errs = append(errs, f(s))
+		case name != "":
+			errs = append(errs, fmt.Errorf("%w %q", ErrNotStarted, name))
+		default:
+			errs = append(errs, ErrNotStarted)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unpause ends the pause of s at end.
+func (s *session) unpause(end time.Time) {
+	s.paused = append(s.paused, Gap{Start: s.pausedAt, Duration: end.Sub(s.pausedAt)})
+	s.pausedAt = time.Time{}
+	if s.pauseTask != nil {
+		s.pauseTask()
+		s.pauseTask = nil
+	}
+}
+
+// restartCPU starts the next CPU segment, warning the running sessions if
+// the profiler was taken in between.
+func (s *session) restartCPU() error {
+	err := startCPUSegment()
+	if err != nil {
+		for _, other := range sessions {
+			other.warnings = append(other.warnings, "CPU profile incomplete: "+err.Error())
+		}
+	}
+	return err
+}
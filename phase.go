@@ -0,0 +1,104 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// WithPhaseProfiles also writes the CPU profile of every phase started with
+// Phase, as <name>.cpu-phase-<phase>.prof; a phase entered more than once
+// gets one profile for all its stretches.
+func WithPhaseProfiles() Option {
+	return func(c *config) { c.phaseProfiles = true }
+}
+
+// phase is the running phase of a session.
+type phase struct {
+	name  string
+	start time.Time
+	seg   int    // index of its first CPU segment
+	end   func() // ends its trace task
+}
+
+// Phase ends the current phase of the newest running session and starts
+// one called name, so batch jobs with distinct stages can tell which stage
+// got slower: the summary lists the wall time of every phase, the manifest
+// records them under "phases", and the trace shows each as a task
+// "phase: <name>". The last phase ends with the session, or with Phase("")
+// without starting another one.
+func Phase(name string) error {
+	if disabled() {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	s := running("")
+	if s == nil {
+		return ErrNotStarted
+	}
+	// a segment boundary costs a restart of the profiler, so only if the
+	// phases get profiles of their own
+	if s.cfg.phaseProfiles {
+		endCPUSegment()
+	}
+	now := time.Now()
+	s.endPhase(now)
+	if name != "" {
+		s.phase = &phase{name: name, start: now, seg: len(s.cpuSegments)}
+		if traceOwner == s {
+			s.phase.end = startTask("phase: " + name)
+		}
+	}
+	if s.cfg.phaseProfiles {
+		return s.restartCPU()
+	}
+	return nil
+}
+
+// endPhase ends the running phase of s at end, if it has one.
+func (s *session) endPhase(end time.Time) {
+	p := s.phase
+	if p == nil {
+		return
+	}
+	s.phases = append(s.phases, analysis.Phase{Name: p.name, Start: p.start, Duration: end.Sub(p.start)})
+	s.phaseSegs = append(s.phaseSegs, [2]int{p.seg, len(s.cpuSegments)})
+	if p.end != nil {
+		p.end()
+	}
+	s.phase = nil
+}
+
+// writePhaseCPU writes the CPU profiles of the phases.
+func (s *session) writePhaseCPU() error {
+	var names []string
+	segs := map[string][][]byte{}
+	for i, p := range s.phases {
+		r := s.phaseSegs[i]
+		if _, ok := segs[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+		segs[p.Name] = append(segs[p.Name], s.cpuSegments[r[0]:r[1]]...)
+	}
+	var errs []error
+	for _, name := range names {
+		prof, err := mergeSegments(segs[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("phase %q: %w", name, err))
+			continue
+		}
+		if prof == nil {
+			continue
+		}
+		a, err := s.writeArtifact("cpu-phase-"+sanitize(name), prof.Write)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.extra = append(s.extra, a)
+	}
+	return errors.Join(errs...)
+}
@@ -25,171 +25,643 @@ There are three main ways to use this package.
 
 	goprof.Start("<name>")
 	defer goprof.End()
+
+Sessions with different names can run at the same time; Stop takes the
+name of the one to end.
 */
 package goprof
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
-	"runtime/pprof"
-	"runtime/trace"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/jcocozza/goprof/analysis"
 )
 
-func cpuName(name string) string {
-	return fmt.Sprintf("%s.cpu.pprof", name)
-}
-func blockName(name string) string {
-	return fmt.Sprintf("%s.block.prof", name)
-}
-func traceName(name string) string {
-	return fmt.Sprintf("%s.trace.out", name)
-}
-func heapName(name string) string {
-	return fmt.Sprintf("%s.heap.prof", name)
+func manifestName(name string) string {
+	return analysis.ManifestName(name)
 }
 
-type profiler struct {
+// session is one profiling session, from Start to Stop.
+type session struct {
+	name  string
+	path  string // name without EnvNamePrefix, see Run
+	runID string
+	cfg   config
 	start time.Time
 	end   time.Time
+	// when Start was called, for WithNameTemplate
+	created time.Time
+
+	memStart runtime.MemStats
+	memEnd   runtime.MemStats
+	gcPauses []uint64 // the GC pause histogram at the start
+	gc       *analysis.GCSummary
+	heapBase *profile.Profile // for WithHeapSpaces
+	cgStart  cgroupCPU
+	cgEnd    cgroupCPU
+	ruStart  analysis.Rusage
+	ruEnd    analysis.Rusage
+	ruOK     bool // getrusage worked at both ends
+	crash    *crashHandler
+	manifest *Manifest // once stopped
+
+	// Starts merged into the session, see OverlapMerge
+	joined int
+
+	goroutinesStart map[int]bool
+	leaks           []analysis.Goroutine
+	// found while the session ran, for the manifest
+	warnings []string
+	// Runs nested in the session, see Run
+	nested []NestedRun
+	// where child processes write their sessions, see ProfileCmd
+	children []string
 
 	// these are the different reports that get written out
-	cpu   *os.File
-	block *os.File
-	trace *os.File
-	heap  *os.File
+	cpu   *outFile
+	block *outFile
+	trace *outFile // nil if another session had the tracer
+	heap  *outFile
+	// CPU profiles of the segments the session ran in, see endCPUSegment
+	cpuSegments [][]byte
+	// since Pause, zero while recording
+	pausedAt  time.Time
+	pauseTask func() // ends the trace task marking the pause
+	paused    []Gap
+	phase     *phase
+	phases    []analysis.Phase
+	phaseSegs [][2]int // the CPU segments of each of phases
+	// compresses the trace, if WithCompressedTrace
+	traceZst *seekableWriter
+	// goroutine dump with creation sites (debug=2)
+	goroutines *outFile
+	// optional runtime/metrics timeline
+	metrics *outFile
+	sampler *metricsSampler
+	// heap profiles written during the session, if WithHeapSnapshots
+	heapSnaps *heapSnapshotter
+	// goroutine stacks sampled during the session, if WithWallClock
+	wall *wallSampler
+	// GC and scheduler figures, if WithRuntimeSummary
+	sched      *schedSampler
+	runtimeSum *analysis.RuntimeSummary
+	// written by the optional collectors above when the session stops
+	extra []Artifact
+	// the time Start took
+	setup time.Duration
 }
 
 var ErrAlreadyStarted = errors.New("profiler already started")
 var ErrNotStarted = errors.New("profiler has not been started")
 
-// true if started
-func (p *profiler) started() bool {
-	return !p.start.IsZero() && !p.end.IsZero()
+func (s *session) duration() time.Duration {
+	return s.end.Sub(s.start)
 }
 
-func (p *profiler) duration() time.Duration {
-	return p.end.Sub(p.start)
+func (s *session) memDelta() MemDelta {
+	return MemDelta{
+		HeapAllocStart: s.memStart.HeapAlloc,
+		HeapAllocEnd:   s.memEnd.HeapAlloc,
+		TotalAlloc:     s.memEnd.TotalAlloc - s.memStart.TotalAlloc,
+		Mallocs:        s.memEnd.Mallocs - s.memStart.Mallocs,
+		Frees:          s.memEnd.Frees - s.memStart.Frees,
+		NumGC:          s.memEnd.NumGC - s.memStart.NumGC,
+		GCPause:        time.Duration(s.memEnd.PauseTotalNs - s.memStart.PauseTotalNs),
+	}
 }
 
-var p profiler
+func (s *session) info() RunInfo {
+	return RunInfo{Name: s.name, RunID: s.runID, PID: os.Getpid(), Start: s.start}
+}
 
-func setupFiles(name string) error {
-	cpu, err := os.Create(cpuName(name))
-	if err != nil {
-		return err
-	}
-	p.cpu = cpu
+var (
+	mu sync.Mutex
+	// the running sessions, oldest first
+	sessions []*session
+	// the last session that stopped
+	last *session
+)
 
-	block, err := os.Create(blockName(name))
-	if err != nil {
-		return err
+// running returns the running session called name, or the newest one if
+// name is empty.
+func running(name string) *session {
+	if name == "" {
+		if len(sessions) == 0 {
+			return nil
+		}
+		return sessions[len(sessions)-1]
 	}
-	p.block = block
-
-	trace, err := os.Create(traceName(name))
-	if err != nil {
-		return err
+	full := fullName(name)
+	for _, s := range sessions {
+		if s.name == name || s.name == full {
+			return s
+		}
 	}
-	p.trace = trace
+	return nil
+}
 
-	heap, err := os.Create(heapName(name))
-	if err != nil {
-		return err
+func (s *session) setupFiles() error {
+	for _, f := range []struct {
+		typ string
+		f   **outFile
+	}{
+		{"cpu", &s.cpu},
+		{"block", &s.block},
+		{"heap", &s.heap},
+		{"goroutines", &s.goroutines},
+		{"metrics", &s.metrics},
+	} {
+		if !s.cfg.wants(f.typ) {
+			continue
+		}
+		out, err := s.create(f.typ, s.fileName(f.typ))
+		if err != nil {
+			return err
+		}
+		*f.f = out
 	}
-	p.heap = heap
 	return nil
 }
 
-func cleanupFiles() error {
-	if err := p.cpu.Close(); err != nil {
-		return err
+// cleanupFiles closes every file of s, even if closing one fails. Files
+// that fail are removed and left out of the manifest.
+func (s *session) cleanupFiles() error {
+	var errs []error
+	for _, f := range s.files() {
+		if err := s.closeFile(*f); err != nil {
+			errs = append(errs, err)
+			*f = nil
+		}
 	}
-	if err := p.block.Close(); err != nil {
-		return err
+	return errors.Join(errs...)
+}
+
+// discardFiles closes and removes the files of a session that failed to
+// start, so it leaves no empty artifacts behind.
+func (s *session) discardFiles() {
+	if s.traceZst != nil {
+		s.traceZst.Close()
 	}
-	if err := p.trace.Close(); err != nil {
-		return err
+	for _, f := range s.files() {
+		s.discard(*f)
+		*f = nil
 	}
-	if err := p.heap.Close(); err != nil {
-		return err
+}
+
+// files are the open files of s.
+func (s *session) files() []**outFile {
+	var files []**outFile
+	for _, f := range []**outFile{&s.cpu, &s.block, &s.trace, &s.heap, &s.goroutines, &s.metrics} {
+		if *f != nil {
+			files = append(files, f)
+		}
 	}
-	return nil
+	return files
 }
 
 // name is optional;
 // if name is an empty string, will populate with a time stamp
-func Start(name string) error {
-	if p.started() {
-		return ErrAlreadyStarted
+//
+// Sessions with different names run side by side. Start fails with
+// ErrAlreadyStarted while a session of the same name is running, unless
+// WithOverlap says otherwise.
+func Start(name string, opts ...Option) error {
+	if disabled() {
+		return nil
 	}
+	info, onStart, err := start(name, opts)
+	if onStart != nil {
+		onStart(info)
+	}
+	recordError(err)
+	return err
+}
 
+// start also returns the WithOnStart hook of the new session, to be called
+// once the lock is released.
+func start(name string, opts []Option) (RunInfo, func(RunInfo), error) {
+	mu.Lock()
+	defer mu.Unlock()
+	cfg := newConfig(append(opts[:len(opts):len(opts)], envOptions()...))
+	if cfg.err != nil {
+		return RunInfo{}, nil, cfg.err
+	}
 	if name == "" {
 		name = fmt.Sprintf("goprof-%d", time.Now().UnixNano())
 	}
+	path := sanitizeName(sessionName(name))
+	name = fullName(name)
+	for other := running(name); other != nil; other = running(name) {
+		switch cfg.overlap {
+		case OverlapQueue:
+			idle.Wait()
+		case OverlapMerge:
+			other.joined++
+			return other.info(), nil, nil
+		default:
+			return RunInfo{}, nil, fmt.Errorf("%w %q", ErrAlreadyStarted, name)
+		}
+	}
 
-	if err := setupFiles(name); err != nil {
-		return err
+	begin := time.Now()
+	s := &session{name: name, path: path, runID: RunID(), cfg: cfg, created: begin}
+	if err := s.setupFiles(); err != nil {
+		s.discardFiles()
+		return RunInfo{}, nil, err
 	}
 
-	if err := pprof.StartCPUProfile(p.cpu); err != nil {
-		return err
+	endCPUSegment()
+	sessions = append(sessions, s)
+	if err := startCPUSegment(); err != nil {
+		leave(s)
+		s.discardFiles()
+		return RunInfo{}, nil, err
 	}
 
-	if err := trace.Start(p.trace); err != nil {
-		return err
+	switch {
+	case !s.cfg.wants("trace"):
+	case traceOwner == nil:
+		if err := s.startTrace(); err != nil {
+			leave(s)
+			s.discardFiles()
+			return RunInfo{}, nil, err
+		}
+	default:
+		s.warnings = append(s.warnings, fmt.Sprintf("no execution trace: session %q was tracing when this one started", traceOwner.name))
 	}
 
-	runtime.SetBlockProfileRate(1)
+	if s.cfg.wants("block") {
+		runtime.SetBlockProfileRate(s.cfg.blockRate)
+	}
+	if len(sessions) == 1 {
+		memRate = runtime.MemProfileRate
+	}
+	if s.cfg.setMemRate {
+		runtime.MemProfileRate = s.cfg.memRate
+	}
+
+	if len(s.cfg.crashSignals) > 0 {
+		s.crash = installCrashHandler(s.cfg.crashSignals, s.cfg.logger)
+	}
 
+	if s.cfg.heapSpaces {
+		// before the mem stats, so a forced GC does not count
+		var err error
+		if s.heapBase, err = heapSnapshot(s.cfg.heapGC); err != nil {
+			s.warnings = append(s.warnings, "heap spaces: "+err.Error())
+		}
+	}
+	runtime.ReadMemStats(&s.memStart)
+	s.gcPauses = readGCPauses()
+	s.cgStart = readCgroupCPU()
+	s.ruStart, s.ruOK = readRusage()
+	if s.cfg.leakCheck {
+		s.goroutinesStart = goroutineIDs()
+	}
+	if s.metrics != nil {
+		s.sampler = startMetrics(s.metrics, s.cfg.metricsInterval)
+	}
+	if s.cfg.heapSnapshots > 0 {
+		s.heapSnaps = startHeapSnapshots(s, s.cfg.heapSnapshots)
+	}
+	if s.cfg.wallClock > 0 {
+		s.wall = startWallClock(s.cfg.wallClock)
+	}
+	if s.cfg.runtimeSummary {
+		s.sched = startSched()
+	}
+
+	s.cfg.logger.Debug("goprof: session started", "session", name, "run_id", s.runID)
 	// run this last; we don't want setup to affect total time
-	p.start = time.Now()
-	return nil
+	s.start = time.Now()
+	s.setup = s.start.Sub(begin)
+	return s.info(), s.cfg.onStart, nil
 }
 
-func Stop() error {
-	if !p.started() {
-		return ErrNotStarted
+func (s *session) startTrace() error {
+	path := s.fileName("trace")
+	if s.cfg.compressTrace {
+		path += ".zst"
 	}
-	// run this first; we don't want tear down to affect total time
-	p.end = time.Now()
-	pprof.StopCPUProfile()
-	trace.Stop()
-	if err := pprof.Lookup("block").WriteTo(p.block, 0); err != nil {
+	f, err := s.create("trace", path)
+	if err != nil {
 		return err
 	}
-	if err := pprof.WriteHeapProfile(p.heap); err != nil {
-		return err
+	s.trace = f
+	var w io.Writer = s.trace
+	if s.cfg.compressTrace {
+		s.traceZst = newSeekableWriter(s.trace)
+		w = s.traceZst
 	}
-
-	if err := cleanupFiles(); err != nil {
+	if err := startTracer(w); err != nil {
 		return err
 	}
+	traceOwner = s
 	return nil
 }
 
+// Stop ends the named sessions, or the newest running one if no name is
+// given, and writes their profiles.
+//
+// While EnvDisable is set, Stop without a session to end is not an error.
+func Stop(names ...string) error {
+	if len(names) == 0 {
+		return disabledOK(stop("", false))
+	}
+	var errs []error
+	for _, name := range names {
+		errs = append(errs, disabledOK(stop(name, false)))
+	}
+	return errors.Join(errs...)
+}
+
+func disabledOK(err error) error {
+	if errors.Is(err, ErrNotStarted) && disabled() {
+		return nil
+	}
+	return err
+}
+
+// stopNow ends every running session, even if Starts were merged into
+// them, for when the process is going away.
+func stopNow() error {
+	var errs []error
+	for n := 0; ; n++ {
+		err := stop("", true)
+		if err == ErrNotStarted {
+			if n == 0 {
+				return err
+			}
+			return errors.Join(errs...)
+		}
+		errs = append(errs, err)
+	}
+}
+
+func stop(name string, force bool) error {
+	_, _, err := stopReport(name, force)
+	return err
+}
+
+// stopReport is stop, also returning what stopSession does.
+func stopReport(name string, force bool) (*Manifest, config, error) {
+	m, cfg, err := stopSession(name, force)
+	if m != nil && cfg.onStop != nil {
+		cfg.onStop(newReport(m, cfg))
+	}
+	if m != nil && len(cfg.notifiers) > 0 {
+		err = errors.Join(err, notify(context.Background(), cfg.notifiers, newNotification("session", m, cfg.fs == nil)))
+	}
+	recordError(err)
+	return m, cfg, err
+}
+
+// stopSession also returns the manifest, once written, and the config of
+// the session, for the WithOnStop hook to be called without the lock.
+func stopSession(name string, force bool) (*Manifest, config, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	s := running(name)
+	if s == nil {
+		if name != "" {
+			return nil, config{}, fmt.Errorf("%w %q", ErrNotStarted, name)
+		}
+		return nil, config{}, ErrNotStarted
+	}
+	if s.joined > 0 && !force {
+		s.joined--
+		return nil, config{}, nil
+	}
+	defer idle.Broadcast()
+	// run this first; we don't want tear down to affect total time
+	s.end = time.Now()
+	runtime.ReadMemStats(&s.memEnd)
+	s.gc = gcSummary(&s.memStart, &s.memEnd, s.gcPauses, s.start, s.end)
+	s.cgEnd = readCgroupCPU()
+	if s.ruOK {
+		s.ruEnd, s.ruOK = readRusage()
+	}
+	if s.cfg.allocCounts {
+		recordAllocs(s.name, &s.memStart, &s.memEnd)
+	}
+	if s.crash != nil {
+		s.crash.uninstall()
+		s.crash = nil
+	}
+	leave(s)
+	if !s.pausedAt.IsZero() {
+		s.unpause(s.end)
+	}
+	s.endPhase(s.end)
+	if len(sessions) == 0 {
+		// the runtime cannot report the rate it had before Start, but 0 is
+		// its default; without this the process keeps paying for block
+		// profiling. Events recorded so far stay in the profile.
+		runtime.SetBlockProfileRate(0)
+		// after the heap profile, which scales its samples by the current rate
+		defer func() { runtime.MemProfileRate = memRate }()
+	}
+	// one failed profile must not cost the others, so everything is
+	// attempted and the failures are reported together
+	var errs []error
+	fail := func(what string, err error) {
+		if err != nil {
+			s.warnings = append(s.warnings, what+": "+err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", what, err))
+		}
+	}
+	// a partial file would pass for a complete one, so it goes
+	drop := func(f **outFile, what string, err error) {
+		if err != nil {
+			s.discard(*f)
+			*f = nil
+		}
+		fail(what, err)
+	}
+	if traceOwner == s {
+		stopTracer()
+		traceOwner = nil
+		if s.traceZst != nil {
+			drop(&s.trace, "trace", s.traceZst.Close())
+		}
+	}
+	switch {
+	case s.cpu == nil:
+	case len(s.cpuSegments) == 0:
+		// paused throughout, or the profiler was taken; an empty file
+		// would pass for a profile
+		s.discard(s.cpu)
+		s.cpu = nil
+		s.warnings = append(s.warnings, "no CPU profile: the session recorded no CPU samples")
+	default:
+		drop(&s.cpu, "cpu profile", s.writeCPU())
+		if s.cfg.phaseProfiles {
+			fail("phase profiles", s.writePhaseCPU())
+		}
+	}
+	if s.block != nil {
+		drop(&s.block, "block profile", writeProfile("block", s.block, 0))
+	}
+	if s.heap != nil {
+		drop(&s.heap, "heap profile", writeHeapProfile(s.heap))
+	}
+	if s.goroutines != nil {
+		drop(&s.goroutines, "goroutine dump", writeProfile("goroutine", s.goroutines, 2))
+	}
+	if s.sampler != nil {
+		drop(&s.metrics, "metrics", s.sampler.finish())
+	}
+	if s.heapSnaps != nil {
+		as, err := s.heapSnaps.finish()
+		fail("heap snapshots", err)
+		s.extra = append(s.extra, as...)
+	}
+	if s.wall != nil {
+		a, err := s.wall.finish(s)
+		if fail("wall-clock profile", err); err == nil {
+			s.extra = append(s.extra, a)
+		}
+	}
+	if s.cfg.textProfiles {
+		fail("text profiles", s.writeTextProfiles())
+	}
+	if s.cfg.heapSpaces {
+		fail("heap spaces", s.writeHeapSpaces())
+	}
+	if len(custom) > 0 {
+		fail("custom profiles", s.writeCustom())
+	}
+	if s.sched != nil {
+		s.runtimeSum = s.sched.finish()
+	}
+	if s.cfg.leakCheck {
+		s.leaks = findLeaks(s.goroutinesStart)
+	}
+	fail("closing files", s.cleanupFiles())
+
+	m, err := s.writeManifest()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	s.manifest = m
+	last = s
+	stats.sessions.Add(1)
+	s.cfg.logger.Debug("goprof: session stopped", "session", m.Name, "duration", m.Duration, "warnings", len(m.Warnings))
+	logArtifacts(s.cfg.logger, m)
+	if err := s.syncDir(filepath.Dir(s.name)); err != nil {
+		errs = append(errs, err)
+	}
+	if s.cfg.history > 0 {
+		if err := s.appendHistory(s.name, historyEntry(m), s.cfg.history); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := s.prune(); err != nil {
+		errs = append(errs, err)
+	}
+	if s.cfg.sink != nil {
+		if err := upload(s.cfg.sink, m, s.cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(s.cfg.openUI) > 0 {
+		openUI(m, s.cfg.openUI, s.cfg.logger, s.cfg.quiet)
+	}
+	return m, s.cfg, errors.Join(errs...)
+}
+
 // convenience wrapper to profile an arbitrary function
-func Run(name string, f func()) error {
-	if err := Start(name); err != nil {
+//
+// f runs in a trace task and region named after the session, so the trace
+// viewer shows where it begins and ends.
+//
+// A Run named after a running session, or below it like "outer/inner"
+// inside Run("outer", ...), does not start a session of its own, so
+// libraries that profile themselves do not fight the application over it:
+// f runs as a trace region of the enclosing session, and its time is added
+// to the session's manifest under Nested. opts are ignored then.
+func Run(name string, f func(), opts ...Option) error {
+	if disabled() {
+		f()
+		return nil
+	}
+	if outer := enclosing(name); outer != nil {
+		runNested(outer, name, f)
+		return nil
+	}
+	info, onStart, err := start(name, opts)
+	if onStart != nil {
+		onStart(info)
+	}
+	if err != nil {
+		recordError(err)
 		return err
 	}
-	f()
-	return Stop()
+	name = filepath.Base(info.Name)
+	withTask(name, f)
+	return Stop(info.Name)
+}
+
+// enclosing returns the running session that a Run of name nests in.
+func enclosing(name string) *session {
+	if name == "" {
+		return nil
+	}
+	// EnvNamePrefix only changes the last element, so nesting is decided
+	// without it
+	path := sanitizeName(sessionName(name))
+	mu.Lock()
+	defer mu.Unlock()
+	var outer *session
+	for _, s := range sessions {
+		if path != s.path && !strings.HasPrefix(path, s.path+"/") {
+			continue
+		}
+		if outer == nil || len(s.path) > len(outer.path) {
+			outer = s
+		}
+	}
+	return outer
+}
+
+func runNested(outer *session, name string, f func()) {
+	start := time.Now()
+	withTask(name, f)
+	d := time.Since(start)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !outer.end.IsZero() {
+		// the session stopped while f ran
+		return
+	}
+	for i := range outer.nested {
+		if n := &outer.nested[i]; n.Name == name {
+			n.Count++
+			n.Total += d
+			return
+		}
+	}
+	outer.nested = append(outer.nested, NestedRun{Name: name, Count: 1, Total: d})
 }
 
 // summary functions
 
 func Summarize() {
-	fmt.Println(p.duration())
+	Summary().WriteText(os.Stdout)
 }
 
-// print the commands to call for pprof
+// print the commands to call for pprof, see CommandList
 func Commands(name string) {
-	fmt.Printf("go tool pprof %s\n", cpuName(name))
-	fmt.Printf("go tool pprof -http=:6060 %s\n", cpuName(name))
-	fmt.Printf("go tool trace %s\n", traceName(name))
-	fmt.Printf("go tool pprof %s\n", blockName(name))
-	fmt.Printf("go tool pprof %s\n", heapName(name))
+	WriteCommands(os.Stdout, name)
 }
@@ -0,0 +1,219 @@
+package goprof
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// PyroscopeConfig configures a PyroscopeExporter.
+// Zero values fall back to the defaults noted on each field.
+type PyroscopeConfig struct {
+	// URL of the server, e.g. http://localhost:4040 or a Grafana Cloud profiles URL.
+	URL string
+	// AppName is the application the profiles are filed under.
+	AppName string
+	// Tags are attached to every profile.
+	Tags map[string]string
+
+	// AuthToken is sent as a bearer token.
+	AuthToken string
+	// BasicAuthUser and BasicAuthPassword are used instead when set,
+	// which is what Grafana Cloud expects.
+	BasicAuthUser     string
+	BasicAuthPassword string
+
+	// Interval between uploads of the queued profiles; 15 seconds by default.
+	Interval time.Duration
+	// MaxQueued caps the profiles waiting for upload, dropping the oldest; 64 by default.
+	MaxQueued int
+	// Client is http.DefaultClient by default.
+	Client *http.Client
+	// OnError is called for failed uploads; errors are logged to stderr by default.
+	OnError func(error)
+}
+
+type pyroscopeUpload struct {
+	typ         string
+	from, until time.Time
+	body        []byte
+}
+
+// PyroscopeExporter is a Sink that pushes CPU and heap profiles to a
+// Pyroscope compatible ingest endpoint. Other artifacts are ignored, and
+// encrypted ones, which the server could not read, are refused with
+// analysis.ErrEncrypted.
+//
+// Profiles are queued by Put and uploaded in batches every Interval.
+type PyroscopeExporter struct {
+	cfg PyroscopeConfig
+
+	mu    sync.Mutex
+	queue []pyroscopeUpload
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewPyroscopeExporter(cfg PyroscopeConfig) (*PyroscopeExporter, error) {
+	if cfg.URL == "" || cfg.AppName == "" {
+		return nil, errors.New("pyroscope: URL and AppName are required")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("pyroscope: %w", err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.MaxQueued <= 0 {
+		cfg.MaxQueued = 64
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(err error) {
+			defaultLogger.Error("goprof: pyroscope upload failed", "app", cfg.AppName, "err", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &PyroscopeExporter{cfg: cfg, cancel: cancel, done: make(chan struct{})}
+	go e.loop(ctx)
+	return e, nil
+}
+
+func (e *PyroscopeExporter) Put(ctx context.Context, m *Manifest, a Artifact, r io.Reader) error {
+	if a.Type != "cpu" && a.Type != "heap" {
+		return nil
+	}
+	if a.Encryption != "" {
+		return fmt.Errorf("pyroscope: %s: %w", a.Path, analysis.ErrEncrypted)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= e.cfg.MaxQueued {
+		e.queue = e.queue[1:]
+	}
+	e.queue = append(e.queue, pyroscopeUpload{typ: a.Type, from: m.Start, until: m.End, body: b})
+	return nil
+}
+
+// Flush uploads everything queued so far.
+func (e *PyroscopeExporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	queue := e.queue
+	e.queue = nil
+	e.mu.Unlock()
+
+	var errs []error
+	for i, u := range queue {
+		if err := e.upload(ctx, u); err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				// keep what we could not send for the next flush
+				e.requeue(queue[i:])
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *PyroscopeExporter) requeue(us []pyroscopeUpload) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.queue = append(us, e.queue...)
+	if over := len(e.queue) - e.cfg.MaxQueued; over > 0 {
+		e.queue = e.queue[over:]
+	}
+}
+
+// Close stops the background uploads after a final flush.
+func (e *PyroscopeExporter) Close() error {
+	var err error
+	e.once.Do(func() {
+		e.cancel()
+		<-e.done
+		ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Interval)
+		defer cancel()
+		err = e.Flush(ctx)
+	})
+	return err
+}
+
+func (e *PyroscopeExporter) loop(ctx context.Context) {
+	defer close(e.done)
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.Flush(ctx); err != nil && ctx.Err() == nil {
+				e.cfg.OnError(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// appName renders "app{k=v,...}" as the ingest API expects.
+func (e *PyroscopeExporter) appName() string {
+	var tags []string
+	for _, k := range sortedKeys(e.cfg.Tags) {
+		tags = append(tags, k+"="+e.cfg.Tags[k])
+	}
+	return e.cfg.AppName + "{" + strings.Join(tags, ",") + "}"
+}
+
+func (e *PyroscopeExporter) upload(ctx context.Context, u pyroscopeUpload) error {
+	// the API works in whole seconds and wants a non-empty range
+	from, until := u.from.Unix(), u.until.Unix()
+	if until <= from {
+		until = from + 1
+	}
+	q := url.Values{}
+	q.Set("name", e.appName())
+	q.Set("from", strconv.FormatInt(from, 10))
+	q.Set("until", strconv.FormatInt(until, 10))
+	q.Set("format", "pprof")
+	q.Set("spyName", "gospy")
+	endpoint := strings.TrimSuffix(e.cfg.URL, "/") + "/ingest?" + q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(u.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	switch {
+	case e.cfg.BasicAuthUser != "":
+		req.SetBasicAuth(e.cfg.BasicAuthUser, e.cfg.BasicAuthPassword)
+	case e.cfg.AuthToken != "":
+		req.Header.Set("Authorization", "Bearer "+e.cfg.AuthToken)
+	}
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pyroscope: %s profile: %s: %s", u.typ, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownRecipe = errors.New("unknown recipe")
+	ErrRecipeCycle   = errors.New("recipe includes itself")
+)
+
+var (
+	recipesMu sync.RWMutex
+	recipes   = map[string][]Option{}
+)
+
+// RegisterRecipe names a set of options so that triggers can ask for a kind
+// of capture, e.g. "incident" or "light", without knowing the knobs:
+//
+//	func init() {
+//		goprof.RegisterRecipe("incident", goprof.WithLeakCheck(), goprof.WithMetrics(100*time.Millisecond))
+//	}
+//
+// It panics if name is empty or already registered.
+func RegisterRecipe(name string, opts ...Option) {
+	recipesMu.Lock()
+	defer recipesMu.Unlock()
+	if name == "" {
+		panic("goprof: RegisterRecipe with empty name")
+	}
+	if _, dup := recipes[name]; dup {
+		panic(fmt.Sprintf("goprof: recipe %q registered twice", name))
+	}
+	recipes[name] = opts
+}
+
+// Recipes returns the names of all registered recipes, sorted.
+func Recipes() []string {
+	recipesMu.RLock()
+	defer recipesMu.RUnlock()
+	names := make([]string, 0, len(recipes))
+	for name := range recipes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithRecipe applies the options registered under name; options after it
+// override the recipe. Start fails with ErrUnknownRecipe if there is no
+// such recipe, and with ErrRecipeCycle if it includes itself, directly or
+// through other recipes.
+func WithRecipe(name string) Option {
+	return func(c *config) {
+		if i := slices.Index(c.recipes, name); i >= 0 {
+			c.err = fmt.Errorf("%w: %s", ErrRecipeCycle, strings.Join(slices.Concat(c.recipes[i:], []string{name}), " -> "))
+			return
+		}
+		recipesMu.RLock()
+		opts, ok := recipes[name]
+		recipesMu.RUnlock()
+		if !ok {
+			c.err = fmt.Errorf("%w %q", ErrUnknownRecipe, name)
+			return
+		}
+		c.recipes = append(c.recipes, name)
+		defer func() { c.recipes = c.recipes[:len(c.recipes)-1] }()
+		for _, opt := range opts {
+			opt(c)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build !goprof_disabled
+
+package goprof
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEnvRecipe(t *testing.T) {
+	t.Chdir(t.TempDir())
+	recipes := `{"templates": {"env-test": {"html_report": true}}}`
+	if err := os.WriteFile("recipes.json", []byte(recipes), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadRecipes("recipes.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvRecipe, "env-test")
+	if err := Start("R", WithProfiles("cpu"), WithQuiet()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("R.report.html"); err != nil {
+		t.Errorf("recipe from %s not applied: %v", EnvRecipe, err)
+	}
+
+	t.Setenv(EnvRecipe, "env-test-missing")
+	if err := Start("R", WithQuiet()); !errors.Is(err, ErrUnknownRecipe) {
+		Stop()
+		t.Errorf("Start: %v, want %v", err, ErrUnknownRecipe)
+	}
+}
+
+func TestRecipeCycle(t *testing.T) {
+	RegisterRecipe("cycle-self", WithRecipe("cycle-self"))
+	RegisterRecipe("cycle-a", WithRecipe("cycle-b"))
+	RegisterRecipe("cycle-b", WithLeakCheck(), WithRecipe("cycle-a"))
+	// a recipe used twice side by side is no cycle
+	RegisterRecipe("cycle-twice", WithRecipe("cycle-leaf"), WithRecipe("cycle-leaf"))
+	RegisterRecipe("cycle-leaf", WithLeakCheck())
+
+	for _, name := range []string{"cycle-self", "cycle-a", "cycle-b"} {
+		if c := newConfig([]Option{WithRecipe(name)}); !errors.Is(c.err, ErrRecipeCycle) {
+			t.Errorf("%s: %v, want %v", name, c.err, ErrRecipeCycle)
+		}
+	}
+	if c := newConfig([]Option{WithRecipe("cycle-twice")}); c.err != nil || !c.leakCheck {
+		t.Errorf("cycle-twice: err %v, leak check %v", c.err, c.leakCheck)
+	}
+}
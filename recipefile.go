@@ -0,0 +1,175 @@
+package goprof
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// recipeFile is the format read by LoadRecipes.
+type recipeFile struct {
+	Templates map[string]recipeTemplate `json:"templates"`
+}
+
+// recipeTemplate mirrors the options. Unset fields are inherited from the
+// template it extends; set ones override it.
+type recipeTemplate struct {
+	Extends string `json:"extends"`
+
+	AllocCounts  *bool         `json:"alloc_counts"`
+	CrashHandler *bool         `json:"crash_handler"`
+	LeakCheck    *bool         `json:"leak_check"`
+	HTMLReport   *bool         `json:"html_report"`
+	BlockRate    *int          `json:"block_profile_rate"`
+	CPURate      *int          `json:"cpu_profile_rate"`
+	MemRate      *int          `json:"mem_profile_rate"`
+	Metrics      *jsonDuration `json:"metrics_interval"`
+	Sync         *string       `json:"sync"`
+	Budget       *struct {
+		Duration *jsonDuration    `json:"duration"`
+		Sizes    map[string]int64 `json:"sizes"`
+	} `json:"budget"`
+}
+
+type jsonDuration time.Duration
+
+func (d *jsonDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations are strings like \"10s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	*d = jsonDuration(v)
+	return err
+}
+
+var syncPolicies = map[string]SyncPolicy{"none": SyncNone, "files": SyncFiles, "all": SyncAll}
+
+func (t recipeTemplate) options() ([]Option, error) {
+	var opts []Option
+	if t.Extends != "" {
+		opts = append(opts, WithRecipe(t.Extends))
+	}
+	if v := t.AllocCounts; v != nil {
+		opts = append(opts, func(c *config) { c.allocCounts = *v })
+	}
+	if v := t.CrashHandler; v != nil {
+		opts = append(opts, func(c *config) { c.crashSignals = nil })
+		if *v {
+			opts = append(opts, WithCrashHandler())
+		}
+	}
+	if v := t.LeakCheck; v != nil {
+		opts = append(opts, func(c *config) { c.leakCheck = *v })
+	}
+	if v := t.HTMLReport; v != nil {
+		opts = append(opts, func(c *config) { c.htmlReport = *v })
+	}
+	if v := t.BlockRate; v != nil {
+		opts = append(opts, WithBlockProfileRate(*v))
+	}
+	if v := t.CPURate; v != nil {
+		opts = append(opts, WithCPUProfileRate(*v))
+	}
+	if v := t.MemRate; v != nil {
+		opts = append(opts, WithMemProfileRate(*v))
+	}
+	if v := t.Metrics; v != nil {
+		opts = append(opts, WithMetrics(time.Duration(*v)))
+	}
+	if v := t.Sync; v != nil {
+		policy, ok := syncPolicies[*v]
+		if !ok {
+			return nil, fmt.Errorf("unknown sync policy %q", *v)
+		}
+		opts = append(opts, WithSync(policy))
+	}
+	if b := t.Budget; b != nil {
+		opts = append(opts, func(c *config) {
+			if b.Duration != nil {
+				c.budget.Duration = time.Duration(*b.Duration)
+			}
+			if len(b.Sizes) > 0 {
+				sizes := make(map[string]int64, len(c.budget.Sizes)+len(b.Sizes))
+				for typ, n := range c.budget.Sizes {
+					sizes[typ] = n
+				}
+				for typ, n := range b.Sizes {
+					sizes[typ] = n
+				}
+				c.budget.Sizes = sizes
+			}
+		})
+	}
+	return opts, nil
+}
+
+// LoadRecipes registers the templates of a JSON config file as recipes,
+// see RegisterRecipe. A template can extend another one from the same file
+// or any recipe registered before, overriding only what it sets:
+//
+//	{
+//		"templates": {
+//			"production": {"metrics_interval": "1s", "sync": "files", "budget": {"duration": "5m"}},
+//			"checkout": {"extends": "production", "leak_check": true}
+//		}
+//	}
+//
+// Platform teams can ship a base file that services load first and then
+// extend from their own. Nothing is registered if the file has an error.
+func LoadRecipes(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f recipeFile
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	recipesMu.Lock()
+	defer recipesMu.Unlock()
+	names := make([]string, 0, len(f.Templates))
+	for name := range f.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parsed := map[string][]Option{}
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("%s: template with empty name", path)
+		}
+		if _, dup := recipes[name]; dup {
+			return fmt.Errorf("%s: recipe %q already registered", path, name)
+		}
+		seen := map[string]bool{name: true}
+		for parent := f.Templates[name].Extends; parent != ""; {
+			if seen[parent] {
+				return fmt.Errorf("%s: template %q is part of an extends cycle", path, name)
+			}
+			seen[parent] = true
+			t, ok := f.Templates[parent]
+			if !ok {
+				if _, ok := recipes[parent]; !ok {
+					return fmt.Errorf("%s: template %q extends %w %q", path, name, ErrUnknownRecipe, parent)
+				}
+				break
+			}
+			parent = t.Extends
+		}
+		opts, err := f.Templates[name].options()
+		if err != nil {
+			return fmt.Errorf("%s: template %q: %w", path, name, err)
+		}
+		parsed[name] = opts
+	}
+	for name, opts := range parsed {
+		recipes[name] = opts
+	}
+	return nil
+}
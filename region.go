@@ -0,0 +1,12 @@
+package goprof
+
+import (
+	"context"
+)
+
+// Region marks f as a region called name in the session's trace, e.g. a
+// phase of the code profiled by Run. Regions nest, and ctx ties them to
+// the trace task it carries, if any. See trace.WithRegion.
+func Region(ctx context.Context, name string, f func()) {
+	withRegion(ctx, name, f)
+}
@@ -0,0 +1,87 @@
+package goprof
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// WithRetention keeps only the newest keepLast runs, counting the one
+// being stopped, and deletes the files of older ones when it stops.
+//
+// Runs are found by their manifests in the directory of the session name,
+// so every goprof run in that directory counts, from this process or
+// another; give periodic captures a directory of their own.
+func WithRetention(keepLast int) Option {
+	return func(c *config) { c.keepLast = keepLast }
+}
+
+// WithMaxAge deletes the files of runs that ended more than d ago when the
+// session stops. Runs are found as for WithRetention.
+func WithMaxAge(d time.Duration) Option {
+	return func(c *config) { c.maxAge = d }
+}
+
+// prune deletes the runs next to s that WithRetention and WithMaxAge no
+// longer keep.
+func (s *session) prune() error {
+	if s.cfg.keepLast <= 0 && s.cfg.maxAge <= 0 {
+		return nil
+	}
+	pattern := filepath.Join(filepath.Dir(s.name), "*.manifest.json")
+	var paths []string
+	var err error
+	if s.cfg.fs != nil {
+		paths, err = fs.Glob(s.cfg.fs, pattern)
+	} else {
+		paths, err = filepath.Glob(pattern)
+	}
+	if err != nil {
+		return err
+	}
+
+	type run struct {
+		path string
+		m    *Manifest
+	}
+	var runs []run
+	for _, path := range paths {
+		var m *Manifest
+		if s.cfg.fs != nil {
+			m, err = analysis.ReadManifestFS(s.cfg.fs, path)
+		} else {
+			m, err = analysis.ReadManifest(path)
+		}
+		// not ours to judge; leave it alone
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run{path, m})
+	}
+	// newest first
+	slices.SortFunc(runs, func(a, b run) int { return b.m.End.Compare(a.m.End) })
+
+	var errs []error
+	for i, r := range runs {
+		if r.path == manifestName(s.name) {
+			continue
+		}
+		keep := s.cfg.keepLast <= 0 || i < s.cfg.keepLast
+		if keep && (s.cfg.maxAge <= 0 || time.Since(r.m.End) <= s.cfg.maxAge) {
+			continue
+		}
+		for _, a := range r.m.Artifacts {
+			if err := s.remove(a.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+		if err := s.remove(r.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,5 @@
+//go:build go1.25
+
+package goprof
+
+func (r rootFS) Rename(oldname, newname string) error { return r.root.Rename(oldname, newname) }
@@ -0,0 +1,263 @@
+package goprof
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3Sink. Credentials and region default to the
+// usual AWS_* environment variables.
+type S3Config struct {
+	// Endpoint defaults to https://s3.<region>.amazonaws.com.
+	// Use https://storage.googleapis.com with HMAC keys for GCS.
+	Endpoint string
+	// Region defaults to AWS_REGION, then us-east-1.
+	Region string
+	Bucket string
+	// PathStyle puts the bucket in the path instead of the host name,
+	// which most self hosted S3 implementations want.
+	PathStyle bool
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// KeyTemplate builds object keys from {service}, {name}, {run_id},
+	// {host}, {timestamp}, {type} and {file}.
+	// It defaults to "{service}/{name}/{timestamp}/{type}".
+	KeyTemplate string
+	// Service fills in {service}; the executable name by default.
+	Service string
+
+	// Client is http.DefaultClient by default.
+	Client *http.Client
+}
+
+// S3Sink uploads artifacts to an S3 compatible bucket.
+type S3Sink struct {
+	cfg      S3Config
+	endpoint *url.URL
+}
+
+func NewS3Sink(cfg S3Config) (*S3Sink, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: Bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.AccessKeyID == "" {
+		cfg.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		cfg.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		cfg.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("s3: missing credentials")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	if cfg.KeyTemplate == "" {
+		cfg.KeyTemplate = "{service}/{name}/{timestamp}/{type}"
+	}
+	if cfg.Service == "" {
+		exe, _ := os.Executable()
+		cfg.Service = strings.TrimSuffix(filepath.Base(exe), ".exe")
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	return &S3Sink{cfg: cfg, endpoint: u}, nil
+}
+
+// Key returns the object key an artifact is stored under.
+func (s *S3Sink) Key(m *Manifest, a Artifact) string {
+	return strings.NewReplacer(
+		"{service}", s.cfg.Service,
+		"{name}", m.Name,
+		"{run_id}", m.RunID,
+		"{host}", m.Host,
+		"{timestamp}", m.Start.UTC().Format("20060102T150405Z"),
+		"{type}", a.Type,
+		"{file}", filepath.Base(a.Path),
+	).Replace(s.cfg.KeyTemplate)
+}
+
+func (s *S3Sink) Put(ctx context.Context, m *Manifest, a Artifact, r io.Reader) error {
+	var size int64
+	if f, ok := r.(*os.File); ok {
+		// stream straight from disk, as large as the file is now
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+	} else {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(b), int64(len(b))
+	}
+	return s.do(ctx, http.MethodPut, s.Key(m, a), r, size)
+}
+
+func (s *S3Sink) Delete(ctx context.Context, m *Manifest, a Artifact) error {
+	return s.do(ctx, http.MethodDelete, s.Key(m, a), nil, 0)
+}
+
+// url is where the object key is.
+func (s *S3Sink) url(key string) *url.URL {
+	u := *s.endpoint
+	path := "/" + key
+	if s.cfg.PathStyle {
+		path = "/" + s.cfg.Bucket + path
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = s3Escape(path, false)
+	return &u
+}
+
+func (s *S3Sink) do(ctx context.Context, method, key string, body io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.url(key).String(), body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req, time.Now().UTC())
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3: %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sign adds an AWS signature version 4 to req, covering the host and
+// every header set so far. The payload is not hashed unless req already
+// has an x-amz-content-sha256 header, which S3 allows, so large traces can
+// be streamed.
+func (s *S3Sink) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	payload := req.Header.Get("x-amz-content-sha256")
+	if payload == "" {
+		payload = "UNSIGNED-PAYLOAD"
+		req.Header.Set("x-amz-content-sha256", payload)
+	}
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(k)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payload,
+	}, "\n")
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signed, sig))
+}
+
+// canonicalQuery is the query string as signature version 4 wants it:
+// sorted by name, then value, and every part escaped.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		vs := slices.Clone(q[k])
+		sort.Strings(vs)
+		for _, v := range vs {
+			params = append(params, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but unreserved characters, and '/'
+// unless slash is set.
+func s3Escape(path string, slash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package goprof
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"filippo.io/age"
+	"github.com/google/pprof/profile"
+)
+
+// sampledSite counts the calls of one name passed to Sampled.
+type sampledSite struct {
+	calls atomic.Uint64
+	busy  atomic.Bool // a call is being profiled
+}
+
+var sampledSites sync.Map // name -> *sampledSite
+
+// Sampled calls f, and profiles the first and then every every-th call of
+// name with Run, so a hot call site such as a request handler can be
+// instrumented without profiling every call. A call that comes up while
+// another of name is being profiled just runs, and so does one whose
+// session fails to start, whose error Sampled returns after f.
+//
+// Each capture replaces the session's files, and its CPU profile is added
+// to <name>.cpu-sampled.prof, which merges the CPU profiles of all the
+// captures so far. Its name follows WithNameTemplate, with {run_id} and
+// {ts} left empty so that every capture lands in the same file. Sessions
+// write only the CPU profile unless opts say otherwise.
+//
+// With WithEncryption, a merged profile left by an earlier process cannot
+// be read back, so the first capture of the process starts it over.
+func Sampled(name string, every int, f func(), opts ...Option) error {
+	if disabled() {
+		f()
+		return nil
+	}
+	v, _ := sampledSites.LoadOrStore(name, &sampledSite{})
+	site := v.(*sampledSite)
+	n := site.calls.Add(1) - 1
+	if every > 1 && n%uint64(every) != 0 || !site.busy.CompareAndSwap(false, true) {
+		f()
+		return nil
+	}
+	defer site.busy.Store(false)
+
+	if outer := enclosing(name); outer != nil {
+		runNested(outer, name, f)
+		return nil
+	}
+	opts = append([]Option{WithProfiles("cpu")}, opts...)
+	info, onStart, err := start(name, opts)
+	if onStart != nil {
+		onStart(info)
+	}
+	if err != nil {
+		recordError(err)
+		f()
+		return err
+	}
+	withTask(filepath.Base(info.Name), f)
+	m, cfg, err := stopReport(info.Name, false)
+	if m == nil {
+		// joined a running session, which writes the profile
+		return err
+	}
+	cpu, ok := m.Artifact("cpu")
+	if !ok {
+		return err
+	}
+	return errors.Join(err, mergeSampled(m.Name, cpu, cfg))
+}
+
+// mergeSampled adds the CPU profile cpu of the session name to the merged
+// one.
+func mergeSampled(name string, cpu Artifact, cfg config) error {
+	prof, err := cfg.readProfile(cpu.Path)
+	if err != nil {
+		return err
+	}
+	s := &session{name: name, cfg: cfg}
+	out := s.fileName("cpu-sampled")
+	var noKey *age.NoIdentityMatchError
+	if merged, err := cfg.readProfile(cfg.outName("cpu-sampled", out)); err == nil {
+		if prof, err = profile.Merge([]*profile.Profile{merged, prof}); err != nil {
+			return fmt.Errorf("merging %s: %w", out, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) && !errors.As(err, &noKey) {
+		return err
+	}
+	var b bytes.Buffer
+	if err := prof.Write(&b); err != nil {
+		return err
+	}
+	return s.writeFile("cpu-sampled", out, b.Bytes())
+}
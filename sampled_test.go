@@ -0,0 +1,75 @@
+//go:build !goprof_disabled
+
+package goprof
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+func TestSampledStartFails(t *testing.T) {
+	t.Chdir(t.TempDir())
+	called := false
+	err := Sampled("S", 1, func() { called = true }, WithEncryption("not a key"), WithQuiet())
+	if !errors.Is(err, ErrBadRecipient) {
+		t.Errorf("Sampled: %v, want %v", err, ErrBadRecipient)
+	}
+	if !called {
+		t.Error("f was not called")
+	}
+}
+
+func TestSampledEncryptedRestart(t *testing.T) {
+	t.Chdir(t.TempDir())
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a merged profile left by an earlier process, whose read key is gone
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := "E.cpu-sampled.prof" + analysis.EncryptedExt
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := age.Encrypt(f, other.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("not this process's")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	opts := []Option{WithEncryption(id.Recipient().String()), WithQuiet()}
+	for range 2 {
+		if err := Sampled("E", 1, func() {}, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := (config{recipients: []age.Recipient{id.Recipient()}}).readProfile(out); err != nil {
+		t.Errorf("merged profile not rewritten: %v", err)
+	}
+}
+
+func TestSampledNameTemplate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for range 2 {
+		if err := Sampled("T", 1, func() {}, WithNameTemplate("{name}-{ts}.{type}.{ext}"), WithQuiet()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat("T-.cpu-sampled.prof"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package goprof
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// WithRuntimeSummary adds a RuntimeSummary to the manifest and the
+// summary: the share of CPU time spent on GC, the scheduler latency, the
+// goroutine count and the call sites that blocked longest. It answers
+// "was it GC or the scheduler?" from runtime/metrics and the block
+// profile, so it needs neither the trace nor the trace viewer.
+func WithRuntimeSummary() Option {
+	return func(c *config) { c.runtimeSummary = true }
+}
+
+// blockingN is how many call sites the runtime summary lists.
+const blockingN = 5
+
+// goroutineInterval is how often the goroutine count is sampled for the
+// runtime summary.
+const goroutineInterval = 100 * time.Millisecond
+
+// schedSampler records what the runtime summary needs while a session runs.
+type schedSampler struct {
+	samples []metrics.Sample
+	// at the start
+	gcCPU, totalCPU float64
+	lat             []uint64
+
+	goroutines analysis.GoroutineCount
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func startSched() *schedSampler {
+	s := &schedSampler{
+		samples: []metrics.Sample{
+			{Name: metricGCCPU},
+			{Name: metricTotalCPU},
+			{Name: metricSchedLat},
+			{Name: metricGoroutines},
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	metrics.Read(s.samples)
+	s.gcCPU = s.samples[0].Value.Float64()
+	s.totalCPU = s.samples[1].Value.Float64()
+	s.lat = append([]uint64(nil), s.samples[2].Value.Float64Histogram().Counts...)
+	n := int(s.samples[3].Value.Uint64())
+	s.goroutines = analysis.GoroutineCount{Start: n, Max: n}
+
+	count := []metrics.Sample{{Name: metricGoroutines}}
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(goroutineInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				metrics.Read(count)
+				s.goroutines.Max = max(s.goroutines.Max, int(count[0].Value.Uint64()))
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// finish summarizes everything but the blocking, which needs the block
+// profile.
+func (s *schedSampler) finish() *analysis.RuntimeSummary {
+	close(s.stop)
+	<-s.done
+	metrics.Read(s.samples)
+	sum := &analysis.RuntimeSummary{}
+	if d := s.samples[1].Value.Float64() - s.totalCPU; d > 0 {
+		sum.GCPercent = 100 * (s.samples[0].Value.Float64() - s.gcCPU) / d
+	}
+	h := s.samples[2].Value.Float64Histogram()
+	sum.SchedLatencyMean, sum.SchedLatencyMax = latencyMeanMax(h, s.lat)
+	_, p99 := latencyPercentiles(h, s.lat)
+	sum.SchedLatencyP99 = seconds(p99)
+	n := int(s.samples[3].Value.Uint64())
+	s.goroutines.End = n
+	s.goroutines.Max = max(s.goroutines.Max, n)
+	sum.Goroutines = s.goroutines
+	return sum
+}
+
+// latencyMeanMax estimates the mean of the latencies recorded since prev
+// from the bucket midpoints, and bounds the largest.
+func latencyMeanMax(h *metrics.Float64Histogram, prev []uint64) (mean, highest time.Duration) {
+	var total uint64
+	var sum float64
+	for i, c := range h.Counts {
+		if i < len(prev) {
+			c -= prev[i]
+		}
+		if c == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		if math.IsInf(lo, -1) {
+			lo = hi
+		}
+		if math.IsInf(hi, 1) {
+			hi = lo
+		}
+		total += c
+		sum += float64(c) * (lo + hi) / 2
+		highest = seconds(hi)
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return seconds(sum / float64(total)), highest
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,101 @@
+package goprof
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// segmentShards spreads the counters of a segment so that goroutines on
+// different cores rarely write the same cache line.
+const segmentShards = 32
+
+type segmentShard struct {
+	count atomic.Uint64
+	nanos atomic.Int64
+	_     [48]byte // pad to a cache line
+}
+
+// Segment counts how often a stretch of code runs and how long it takes.
+// Create segments once, e.g. as package variables; Begin and End do not
+// allocate or lock, so instrumenting hot paths does not show up in the
+// profiles being captured.
+type Segment struct {
+	name   string
+	shards [segmentShards]segmentShard
+}
+
+// SegmentStats is the total recorded for a segment.
+type SegmentStats struct {
+	Count uint64
+	Total time.Duration
+}
+
+func (s SegmentStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+var (
+	segmentsMu sync.Mutex
+	segments   = map[string]*Segment{}
+)
+
+// NewSegment returns the segment registered under name, creating it if
+// needed.
+func NewSegment(name string) *Segment {
+	segmentsMu.Lock()
+	defer segmentsMu.Unlock()
+	if s, ok := segments[name]; ok {
+		return s
+	}
+	s := &Segment{name: name}
+	segments[name] = s
+	return s
+}
+
+func (s *Segment) Name() string { return s.name }
+
+// Begin marks the start of one run of the segment, e.g.
+//
+//	defer decode.End(decode.Begin())
+func (s *Segment) Begin() time.Time {
+	return time.Now()
+}
+
+// End records the run started at begin, using the monotonic clock.
+func (s *Segment) End(begin time.Time) {
+	s.Record(time.Since(begin))
+}
+
+// Record adds one run of d that was timed elsewhere.
+func (s *Segment) Record(d time.Duration) {
+	sh := &s.shards[rand.Uint32()%segmentShards]
+	sh.count.Add(1)
+	sh.nanos.Add(int64(d))
+}
+
+// Stats sums the shards. Runs recorded concurrently may or may not be
+// included.
+func (s *Segment) Stats() SegmentStats {
+	var st SegmentStats
+	for i := range s.shards {
+		st.Count += s.shards[i].count.Load()
+		st.Total += time.Duration(s.shards[i].nanos.Load())
+	}
+	return st
+}
+
+// AllSegments returns the stats of every segment.
+func AllSegments() map[string]SegmentStats {
+	segmentsMu.Lock()
+	defer segmentsMu.Unlock()
+	m := make(map[string]SegmentStats, len(segments))
+	for name, s := range segments {
+		m[name] = s.Stats()
+	}
+	return m
+}
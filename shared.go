@@ -0,0 +1,144 @@
+package goprof
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"slices"
+
+	"github.com/google/pprof/profile"
+)
+
+// The CPU profiler, the execution tracer and the profile rates belong to
+// the process, so the running sessions share them. All of this is guarded
+// by mu.
+var (
+	// cpuBuf collects the CPU profile of the current segment
+	cpuBuf bytes.Buffer
+	cpuOn  bool
+	// traceOwner is the session the execution trace is written for; a
+	// trace cannot be split, so sessions started during it get none
+	traceOwner *session
+	// runtime.MemProfileRate before the first of the running sessions
+	memRate int
+	// captureOn is set while the agent or a watchdog has the CPU profiler
+	captureOn bool
+)
+
+// takeProfilers starts the CPU profiler into cpu, and the tracer into tr
+// unless tr is nil, for a capture of the agent or a watchdog. It reports
+// false and starts nothing while a session or another capture has them,
+// including a session that is paused or between two CPU segments.
+func takeProfilers(cpu, tr io.Writer) (bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if captureOn || cpuOn || tr != nil && traceOwner != nil || slices.ContainsFunc(sessions, func(s *session) bool { return s.cpu != nil }) {
+		return false, nil
+	}
+	if err := startCPUProfile(cpu); err != nil {
+		return false, err
+	}
+	if tr != nil {
+		if err := startTracer(tr); err != nil {
+			stopCPUProfile()
+			return false, err
+		}
+	}
+	captureOn = true
+	return true, nil
+}
+
+// releaseProfilers stops what takeProfilers started.
+func releaseProfilers(tracing bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	if tracing {
+		stopTracer()
+	}
+	stopCPUProfile()
+	captureOn = false
+}
+
+// endCPUSegment stops the CPU profiler and hands the profile recorded since
+// it was last started to every running session. Sessions start and stop
+// between segments, so each gets exactly the samples taken while it ran.
+func endCPUSegment() {
+	if !cpuOn {
+		return
+	}
+	stopCPUProfile()
+	cpuOn = false
+	seg := bytes.Clone(cpuBuf.Bytes())
+	cpuBuf.Reset()
+	for _, s := range sessions {
+		if s.cpu != nil && s.pausedAt.IsZero() {
+			s.cpuSegments = append(s.cpuSegments, seg)
+		}
+	}
+}
+
+// startCPUSegment starts the CPU profiler again if any running session
+// that is not paused wants a CPU profile, at the rate of the oldest.
+func startCPUSegment() error {
+	i := slices.IndexFunc(sessions, func(s *session) bool { return s.cpu != nil && s.pausedAt.IsZero() })
+	if i < 0 {
+		return nil
+	}
+	if rate := sessions[i].cfg.cpuRate; rate > 0 {
+		// StartCPUProfile keeps a rate that is already set
+		runtime.SetCPUProfileRate(rate)
+	}
+	if err := startCPUProfile(&cpuBuf); err != nil {
+		return err
+	}
+	cpuOn = true
+	return nil
+}
+
+// leave removes s from the running sessions, closing its last CPU segment.
+func leave(s *session) {
+	endCPUSegment()
+	for i, other := range sessions {
+		if other == s {
+			sessions = append(sessions[:i], sessions[i+1:]...)
+			break
+		}
+	}
+	if err := startCPUSegment(); err != nil {
+		// whoever took the profiler in between keeps it
+		for _, other := range sessions {
+			other.warnings = append(other.warnings, "CPU profile incomplete: "+err.Error())
+		}
+		s.cfg.logger.Error("goprof: restarting the CPU profile failed", "session", s.name, "err", err)
+	}
+}
+
+// writeCPU writes the CPU profile of s, merging its segments if it shared
+// the profiler with other sessions.
+func (s *session) writeCPU() error {
+	if len(s.cpuSegments) == 1 {
+		_, err := s.cpu.Write(s.cpuSegments[0])
+		return err
+	}
+	prof, err := mergeSegments(s.cpuSegments)
+	if prof == nil || err != nil {
+		return err
+	}
+	return prof.Write(s.cpu)
+}
+
+// mergeSegments merges CPU segments into one profile, nil if there are none.
+func mergeSegments(segs [][]byte) (*profile.Profile, error) {
+	var profs []*profile.Profile
+	for _, seg := range segs {
+		prof, err := profile.ParseData(seg)
+		if err != nil {
+			return nil, err
+		}
+		profs = append(profs, prof)
+	}
+	if len(profs) == 0 {
+		return nil, nil
+	}
+	return profile.Merge(profs)
+}
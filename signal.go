@@ -0,0 +1,54 @@
+package goprof
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// EnableSignalControl lets a running process be profiled from the outside.
+// Receiving start begins a new session and receiving stop ends it and
+// flushes its profiles, e.g.
+//
+//	goprof.EnableSignalControl(syscall.SIGUSR1, syscall.SIGUSR2)
+//
+// Sessions are started with opts, typically a WithRecipe.
+//
+// Errors are logged at error level, since there is no caller to return
+// them to: on stderr by default, to the logger of WithLogger in opts, and
+// not at all with WithQuiet.
+// The returned function stops listening for the signals.
+func EnableSignalControl(start, stop os.Signal, opts ...Option) func() {
+	if buildDisabled {
+		return func() {}
+	}
+	log := newConfig(opts).logger
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, start, stop)
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				var err error
+				if sig == start {
+					err = Start("", opts...)
+				} else {
+					err = Stop()
+				}
+				if err != nil {
+					log.Error("goprof: signal control failed", "signal", sig, "err", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
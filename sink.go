@@ -0,0 +1,123 @@
+package goprof
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// Sink stores finished artifacts somewhere other than the working directory.
+type Sink interface {
+	// Put stores an artifact of the session described by m.
+	// a.Path is the file name the artifact would have on disk.
+	Put(ctx context.Context, m *Manifest, a Artifact, r io.Reader) error
+}
+
+// upload hands the files of a session with config c to s.
+func upload(s Sink, m *Manifest, c config) error {
+	artifacts := append(m.Artifacts[:len(m.Artifacts):len(m.Artifacts)], Artifact{Type: "manifest", Path: manifestName(m.Name)})
+	// one artifact the sink refuses does not keep it from the others
+	var errs []error
+	for _, a := range artifacts {
+		f, err := c.open(a.Path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if stat, ok := f.(interface{ Stat() (fs.FileInfo, error) }); ok && a.Type == "manifest" {
+			if info, err := stat.Stat(); err == nil {
+				a.Size = info.Size()
+			}
+		}
+		err = s.Put(context.Background(), m, a, f)
+		f.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.Path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// memFile is an artifact captured into memory rather than a file, as the
+// agent and the watchdogs do.
+type memFile struct {
+	a Artifact
+	b []byte
+}
+
+func newMemFile(name, typ string, b []byte) memFile {
+	return memFile{Artifact{Type: typ, Path: analysis.FileName(name, typ), Size: int64(len(b))}, b}
+}
+
+// putBundle adds files to m and hands them and the manifest to s,
+// encrypting the files for recipients if there are any.
+func putBundle(ctx context.Context, s Sink, m *Manifest, files []memFile, recipients []age.Recipient) error {
+	if len(recipients) > 0 {
+		var err error
+		if files, err = encryptFiles(files, recipients); err != nil {
+			return fmt.Errorf("%s: %w", m.Name, err)
+		}
+	}
+	for _, f := range files {
+		m.Artifacts = append(m.Artifacts, f.a)
+	}
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	files = append(files, memFile{Artifact{Type: "manifest", Path: manifestName(m.Name), Size: int64(len(mb))}, mb})
+	for _, f := range files {
+		if err := s.Put(ctx, m, f.a, bytes.NewReader(f.b)); err != nil {
+			return fmt.Errorf("%s: %w", m.Name, err)
+		}
+		stats.bytesWritten.Add(int64(len(f.b)))
+	}
+	return nil
+}
+
+// Deleter is implemented by sinks that can remove what they stored.
+// Retention policies need it.
+type Deleter interface {
+	Delete(ctx context.Context, m *Manifest, a Artifact) error
+}
+
+// DirSink writes artifacts into a local directory, creating it if needed.
+type DirSink struct {
+	Dir string
+}
+
+func (s DirSink) path(a Artifact) string {
+	return filepath.Join(s.Dir, filepath.Base(a.Path))
+}
+
+func (s DirSink) Put(ctx context.Context, m *Manifest, a Artifact, r io.Reader) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(s.path(a))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s DirSink) Delete(ctx context.Context, m *Manifest, a Artifact) error {
+	err := os.Remove(s.path(a))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+//go:build !goprof_disabled
+
+package goprof
+
+import (
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+func TestSpeedscopeTrace(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, compress := range []bool{false, true} {
+		opts := []Option{WithSpeedscope("cpu", "trace"), WithQuiet()}
+		if compress {
+			opts = append(opts, WithCompressedTrace())
+		}
+		if err := Start("A", opts...); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		err := Stop()
+		if _, statErr := os.Stat("A.manifest.json"); statErr != nil {
+			t.Fatalf("compress=%v: no manifest: %v (Stop: %v)", compress, statErr, err)
+		}
+		if err != nil {
+			t.Fatalf("compress=%v: Stop: %v", compress, err)
+		}
+		if _, lookErr := exec.LookPath("go"); lookErr != nil {
+			// without a toolchain the trace is left out with a warning
+			continue
+		}
+		for _, name := range []string{"A.cpu.speedscope.json", "A.trace.speedscope.json"} {
+			if _, err := os.Stat(name); err != nil {
+				t.Errorf("compress=%v: %v", compress, err)
+			}
+		}
+	}
+
+	// without go on PATH Stop still succeeds, with a warning for the trace
+	t.Setenv("PATH", t.TempDir())
+	if err := Start("B", WithSpeedscope("cpu", "trace"), WithQuiet()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := Stop(); err != nil {
+		t.Fatalf("Stop without go: %v", err)
+	}
+	m, err := analysis.ReadManifest("B.manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(m.Warnings, func(w string) bool { return strings.HasPrefix(w, "speedscope: trace left out") }) {
+		t.Errorf("no warning for the trace left out: %q", m.Warnings)
+	}
+	if _, err := os.Stat("B.cpu.speedscope.json"); err != nil {
+		t.Error(err)
+	}
+}
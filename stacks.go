@@ -0,0 +1,35 @@
+package goprof
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrUnknownReport = errors.New("unknown report")
+
+// The reports WithRuntimeStacks applies to.
+var runtimeReports = []string{"summary", "report", "flame", "lines"}
+
+// WithRuntimeStacks sets what the given reports do with samples whose
+// stacks are entirely inside the runtime, such as GC workers and the
+// scheduler: "summary" for the top functions of Summary, "report" for
+// WithHTMLReport, "flame" for WithFlameGraphs and WithSpeedscope, and
+// "lines" for WithLineReport, or all of them if none are given. The pprof files are written unfiltered either way.
+func WithRuntimeStacks(mode RuntimeMode, reports ...string) Option {
+	if len(reports) == 0 {
+		reports = runtimeReports
+	}
+	return func(c *config) {
+		if c.runtimeStacks == nil {
+			c.runtimeStacks = map[string]RuntimeMode{}
+		}
+		for _, r := range reports {
+			if !slices.Contains(runtimeReports, r) {
+				c.err = fmt.Errorf("%w %q", ErrUnknownReport, r)
+				return
+			}
+			c.runtimeStacks[r] = mode
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package goprof
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is what goprof has done in this process so far, for monitoring an
+// always-on agent or watchdog.
+type Stats struct {
+	// Active is the number of running sessions.
+	Active int `json:"active"`
+	// Sessions is the number of sessions stopped.
+	Sessions int64 `json:"sessions"`
+	// LastDuration is how long the last stopped session ran.
+	LastDuration time.Duration `json:"last_duration"`
+	// AgentCaptures is the number of captures agents have delivered.
+	AgentCaptures int64 `json:"agent_captures"`
+	// BytesWritten counts the bytes of every session file and every
+	// agent or watchdog capture.
+	BytesWritten int64 `json:"bytes_written"`
+	// Errors is the number of failed Starts, Stops and captures; the last
+	// one is LastError, at LastErrorTime.
+	Errors        int64     `json:"errors"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitzero"`
+}
+
+var stats struct {
+	sessions      atomic.Int64
+	agentCaptures atomic.Int64
+	bytesWritten  atomic.Int64
+	errors        atomic.Int64
+
+	mu            sync.Mutex
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// recordError counts err, if any, for Stats. ErrNotStarted is not a
+// failure of goprof's own.
+func recordError(err error) {
+	if err == nil || errors.Is(err, ErrNotStarted) {
+		return
+	}
+	stats.errors.Add(1)
+	stats.mu.Lock()
+	stats.lastError = err.Error()
+	stats.lastErrorTime = time.Now()
+	stats.mu.Unlock()
+}
+
+// ReadStats returns the current Stats.
+func ReadStats() Stats {
+	mu.Lock()
+	st := Stats{Active: len(sessions)}
+	if last != nil {
+		st.LastDuration = last.manifest.Duration
+	}
+	mu.Unlock()
+	st.Sessions = stats.sessions.Load()
+	st.AgentCaptures = stats.agentCaptures.Load()
+	st.BytesWritten = stats.bytesWritten.Load()
+	st.Errors = stats.errors.Load()
+	stats.mu.Lock()
+	st.LastError, st.LastErrorTime = stats.lastError, stats.lastErrorTime
+	stats.mu.Unlock()
+	return st
+}
+
+// ExpvarStats reports ReadStats as an expvar, e.g.
+//
+//	expvar.Publish("goprof", goprof.ExpvarStats())
+func ExpvarStats() expvar.Var {
+	return expvar.Func(func() any { return ReadStats() })
+}
+
+// MetricsHandler serves Stats in the Prometheus text format, so they can
+// be scraped without a client library:
+//
+//	mux.Handle("/debug/goprof/metrics", goprof.MetricsHandler())
+//
+// The text of the last error is only in Stats; Prometheus gets its time.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := ReadStats()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, m := range []struct {
+			name, typ, help string
+			value           float64
+		}{
+			{"goprof_sessions_active", "gauge", "Running profiling sessions.", float64(st.Active)},
+			{"goprof_sessions_total", "counter", "Profiling sessions stopped.", float64(st.Sessions)},
+			{"goprof_last_session_duration_seconds", "gauge", "Duration of the last stopped session.", st.LastDuration.Seconds()},
+			{"goprof_agent_captures_total", "counter", "Captures delivered by agents.", float64(st.AgentCaptures)},
+			{"goprof_written_bytes_total", "counter", "Bytes of profiles written.", float64(st.BytesWritten)},
+			{"goprof_errors_total", "counter", "Failed starts, stops and captures.", float64(st.Errors)},
+			{"goprof_last_error_timestamp_seconds", "gauge", "Unix time of the last error, 0 if none.", unixSeconds(st.LastErrorTime)},
+		} {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.typ, m.name, m.value)
+		}
+	})
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,84 @@
+package goprof
+
+import (
+	"expvar"
+	"path/filepath"
+	"time"
+)
+
+// State describes the sessions running right now, for health dashboards
+// and debug pages.
+type State struct {
+	Running  bool           `json:"running"`
+	Sessions []SessionState `json:"sessions,omitempty"` // oldest first
+}
+
+// SessionState describes one running session.
+type SessionState struct {
+	Name  string    `json:"name"`
+	RunID string    `json:"run_id"`
+	Start time.Time `json:"start"`
+	// Profiles are the profile types the session writes, e.g. "cpu",
+	// "heap" or "metrics".
+	Profiles []string `json:"profiles"`
+	// Dir is the absolute directory the files go to, or the directory
+	// within the FS given to WithFS.
+	Dir string `json:"dir"`
+	// Paused is set between Pause and Resume.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// Status reports the running sessions.
+func Status() State {
+	mu.Lock()
+	defer mu.Unlock()
+	st := State{Running: len(sessions) > 0}
+	for _, s := range sessions {
+		dir := filepath.Dir(s.name)
+		if s.cfg.fs == nil {
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+		}
+		st.Sessions = append(st.Sessions, SessionState{
+			Name:     s.name,
+			RunID:    s.runID,
+			Start:    s.start,
+			Profiles: s.profiles(),
+			Dir:      dir,
+			Paused:   !s.pausedAt.IsZero(),
+		})
+	}
+	return st
+}
+
+// profiles lists what s writes besides the manifest and the reports.
+func (s *session) profiles() []string {
+	var types []string
+	for _, typ := range profileTypes {
+		// a trace can only be written for one session at a time
+		if typ == "trace" && traceOwner != s {
+			continue
+		}
+		if s.cfg.wants(typ) {
+			types = append(types, typ)
+		}
+	}
+	if s.metrics != nil {
+		types = append(types, "metrics")
+	}
+	if s.heapSnaps != nil {
+		types = append(types, "heap-snapshots")
+	}
+	if s.wall != nil {
+		types = append(types, "wall")
+	}
+	return types
+}
+
+// ExpvarStatus reports Status as an expvar, e.g.
+//
+//	expvar.Publish("goprof_status", goprof.ExpvarStatus())
+func ExpvarStatus() expvar.Var {
+	return expvar.Func(func() any { return Status() })
+}
@@ -0,0 +1,175 @@
+package goprof
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// Report describes the last finished session.
+type Report struct {
+	Name      string        `json:"name"`
+	RunID     string        `json:"run_id"`
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"duration"`
+	Artifacts []Artifact    `json:"artifacts"` // absolute paths, unless written to an FS
+	Memory    MemDelta      `json:"memory"`    // including GC counts
+	// Rusage is the OS resource usage, on Unix.
+	Rusage *analysis.Rusage `json:"rusage,omitempty"`
+	// GC is the garbage collection during the session.
+	GC *analysis.GCSummary `json:"gc,omitempty"`
+	// Overhead is what goprof itself cost the session.
+	Overhead *analysis.Overhead `json:"overhead,omitempty"`
+	// Runtime is there if the session had WithRuntimeSummary.
+	Runtime *analysis.RuntimeSummary `json:"runtime,omitempty"`
+	// Labels break the CPU time down by the values of the pprof labels set
+	// with Do, in nanoseconds.
+	Labels []LabelStat `json:"labels,omitempty"`
+	// Top are the hottest functions of the CPU profile by flat time,
+	// in nanoseconds.
+	Top      []FuncStat           `json:"top,omitempty"`
+	Leaks    []analysis.Goroutine `json:"leaks,omitempty"`
+	Nested   []NestedRun          `json:"nested,omitempty"`
+	Paused   []Gap                `json:"paused,omitempty"`
+	Phases   []analysis.Phase     `json:"phases,omitempty"`
+	Warnings []string             `json:"warnings,omitempty"`
+}
+
+// Summary reports on the last finished session, or is empty if no session
+// has finished yet.
+func Summary() Report {
+	mu.Lock()
+	s := last
+	mu.Unlock()
+	if s == nil {
+		return Report{}
+	}
+	return newReport(s.manifest, s.cfg)
+}
+
+func newReport(m *Manifest, cfg config) Report {
+	r := Report{
+		Name:      m.Name,
+		RunID:     m.RunID,
+		Start:     m.Start,
+		Duration:  m.Duration,
+		Artifacts: slices.Clone(m.Artifacts),
+		Leaks:     m.Leaks,
+		Nested:    m.Nested,
+		Paused:    m.Paused,
+		Phases:    m.Phases,
+		Rusage:    m.Rusage,
+		Overhead:  m.Overhead,
+		GC:        m.GC,
+		Runtime:   m.Runtime,
+		Warnings:  m.Warnings,
+	}
+	if m.Memory != nil {
+		r.Memory = *m.Memory
+	}
+	if cfg.fs == nil {
+		for i, a := range r.Artifacts {
+			if abs, err := filepath.Abs(a.Path); err == nil {
+				r.Artifacts[i].Path = abs
+			}
+		}
+	}
+	if a, ok := m.Artifact("cpu"); ok {
+		if prof, err := cfg.readProfile(a.Path); err == nil {
+			prof = analysis.FilterRuntime(prof, cfg.runtimeStacks["summary"])
+			r.Top = analysis.Top(prof, "", topN)
+			r.Labels = analysis.ByLabel(prof, "")
+		}
+	}
+	return r
+}
+
+const topN = 10
+
+func (r Report) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
+
+// WriteText writes what Summarize prints.
+func (r Report) WriteText(w io.Writer) error {
+	fmt.Fprintln(w, r.Duration)
+	fmt.Fprintln(w, r.Memory)
+	if r.Rusage != nil {
+		fmt.Fprint(w, r.Rusage)
+		if r.Duration > 0 {
+			fmt.Fprintf(w, " (%.0f%% CPU)", 100*float64(r.Rusage.CPUTime())/float64(r.Duration))
+		}
+		fmt.Fprintln(w)
+	}
+	if r.GC != nil {
+		r.GC.WriteText(w)
+	}
+	if r.Runtime != nil {
+		r.Runtime.WriteText(w)
+	}
+	if r.Overhead != nil {
+		r.Overhead.WriteText(w)
+	}
+	if len(r.Artifacts) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, a := range r.Artifacts {
+			fmt.Fprintf(tw, "%s\t\t%s\n", analysis.FormatBytes(a.Size), a.Path)
+		}
+		tw.Flush()
+	}
+	if len(r.Top) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "flat\tflat%\tcum\tcum%\t\t")
+		for _, f := range r.Top {
+			fmt.Fprintf(tw, "%s\t%.1f%%\t%s\t%.1f%%\t\t%s\n", time.Duration(f.Flat), f.FlatPct, time.Duration(f.Cum), f.CumPct, f.Name)
+		}
+		tw.Flush()
+	}
+	if len(r.Labels) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "cpu	cpu%		label")
+		for _, l := range r.Labels {
+			value := l.Value
+			if value == "" {
+				value = "(unset)"
+			}
+			fmt.Fprintf(tw, "%s	%.1f%%		%s=%s\n", time.Duration(l.Total), l.Pct, l.Key, value)
+		}
+		tw.Flush()
+	}
+	if len(r.Phases) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "phase\ttime\t%\t")
+		for _, p := range r.Phases {
+			pct := 0.0
+			if r.Duration > 0 {
+				pct = 100 * float64(p.Duration) / float64(r.Duration)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t\n", p.Name, p.Duration.Round(time.Microsecond), pct)
+		}
+		tw.Flush()
+	}
+	if len(r.Paused) > 0 {
+		var total time.Duration
+		for _, g := range r.Paused {
+			total += g.Duration
+		}
+		fmt.Fprintf(w, "paused %d times for %s, left out of the CPU profile\n", len(r.Paused), total)
+	}
+	for _, n := range r.Nested {
+		fmt.Fprintf(w, "%s: %d runs, %s\n", n.Name, n.Count, n.Total)
+	}
+	writeLeaks(w, r.Leaks)
+	for _, warning := range r.Warnings {
+		if _, err := fmt.Fprintf(w, "WARNING: %s\n", warning); err != nil {
+			return err
+		}
+	}
+	return nil
+}
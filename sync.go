@@ -0,0 +1,89 @@
+package goprof
+
+import (
+	"os"
+	"runtime"
+)
+
+// SyncPolicy controls how hard Stop works to make artifacts durable.
+// Syncing makes Stop slower, especially for large traces.
+type SyncPolicy int
+
+const (
+	// SyncNone leaves flushing to the operating system.
+	SyncNone SyncPolicy = iota
+	// SyncFiles fsyncs every artifact before it is closed.
+	SyncFiles
+	// SyncAll also fsyncs the directory the artifacts were written to,
+	// so the new directory entries survive a crash as well.
+	SyncAll
+)
+
+// WithSync sets the sync policy for the session. The default is SyncNone.
+func WithSync(policy SyncPolicy) Option {
+	return func(c *config) { c.sync = policy }
+}
+
+// closeFile closes f and renames it into place, or removes it if that
+// fails.
+func (s *session) closeFile(f *outFile) error {
+	if syncer, ok := f.w.(interface{ Sync() error }); ok && s.cfg.sync >= SyncFiles {
+		if err := syncer.Sync(); err != nil {
+			s.discard(f)
+			return outputError("sync", f.name, f.typ, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		s.discard(f)
+		return outputError("close", f.name, f.typ, err)
+	}
+	if f.enc != nil {
+		f.size = f.enc.n
+	}
+	if err := s.rename(f); err != nil {
+		s.discard(f)
+		return outputError("rename", f.name, f.typ, err)
+	}
+	return nil
+}
+
+// writeFile writes b to path, the file of typ.
+func (s *session) writeFile(typ, path string, b []byte) error {
+	f, err := s.create(typ, path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		s.discard(f)
+		return err
+	}
+	return s.closeFile(f)
+}
+
+func (s *session) syncDir(dir string) error {
+	if s.cfg.sync < SyncAll {
+		return nil
+	}
+	// windows cannot fsync a directory; NTFS journals the entries itself
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	var d *os.File
+	var err error
+	switch fsys := s.cfg.fs.(type) {
+	case nil:
+		d, err = os.Open(dir)
+	case rootFS:
+		d, err = fsys.root.Open(dir)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
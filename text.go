@@ -0,0 +1,36 @@
+package goprof
+
+import (
+	"errors"
+	"io"
+)
+
+// WithTextProfiles also writes the heap, block and goroutine profiles in
+// the runtime's text format, to read with cat on a machine without the Go
+// toolchain: <name>.heap-text.txt and <name>.block-text.txt list the
+// sampled stacks (pprof debug=1, heap with the MemStats at the end), and
+// <name>.goroutines-text.txt counts the goroutines per stack next to the
+// full dump in <name>.goroutines.txt.
+func WithTextProfiles() Option {
+	return func(c *config) { c.textProfiles = true }
+}
+
+func (s *session) writeTextProfiles() error {
+	var errs []error
+	for _, p := range []struct{ typ, profile string }{
+		{"heap", "heap"},
+		{"block", "block"},
+		{"goroutines", "goroutine"},
+	} {
+		if !s.cfg.wants(p.typ) {
+			continue
+		}
+		a, err := s.writeArtifact(p.typ+"-text", func(w io.Writer) error { return writeProfile(p.profile, w, 1) })
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.extra = append(s.extra, a)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package goprof
+
+import (
+	"io"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+	"github.com/klauspost/compress/zstd"
+)
+
+// WithCompressedTrace writes the execution trace as <name>.trace.out.zst
+// in the zstd seekable format. The manifest lists its chunks with the time
+// they were written, so remote tools can fetch the part they need with
+// range requests instead of the whole trace; see analysis.ReadChunk.
+func WithCompressedTrace() Option {
+	return func(c *config) { c.compressTrace = true }
+}
+
+const (
+	traceChunkSize = 1 << 20
+	traceChunkAge  = time.Second
+)
+
+// seekableWriter compresses what is written to it in chunks of about
+// traceChunkSize bytes or traceChunkAge, whichever comes first.
+type seekableWriter struct {
+	w      io.Writer
+	enc    *zstd.Encoder
+	buf    []byte
+	start  time.Time // of the chunk in buf
+	last   time.Time
+	off    int64
+	rawOff int64
+	chunks []analysis.Chunk
+}
+
+func newSeekableWriter(w io.Writer) *seekableWriter {
+	enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	return &seekableWriter{w: w, enc: enc}
+}
+
+func (s *seekableWriter) Write(b []byte) (int, error) {
+	now := time.Now()
+	if len(s.buf) == 0 {
+		s.start = now
+	}
+	s.buf = append(s.buf, b...)
+	s.last = now
+	if len(s.buf) >= traceChunkSize || now.Sub(s.start) >= traceChunkAge {
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (s *seekableWriter) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	frame := s.enc.EncodeAll(s.buf, nil)
+	if _, err := s.w.Write(frame); err != nil {
+		return err
+	}
+	s.chunks = append(s.chunks, analysis.Chunk{
+		Offset:    s.off,
+		Size:      int64(len(frame)),
+		RawOffset: s.rawOff,
+		RawSize:   int64(len(s.buf)),
+		Start:     s.start,
+		End:       s.last,
+	})
+	s.off += int64(len(frame))
+	s.rawOff += int64(len(s.buf))
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// Close writes the last chunk and the seek table; it does not close the
+// underlying writer.
+func (s *seekableWriter) Close() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	_, err := s.w.Write(analysis.SeekTable(s.chunks))
+	return err
+}
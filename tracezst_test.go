@@ -0,0 +1,130 @@
+package goprof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestSeekableWriter(t *testing.T) {
+	// compressible, but not down to nothing
+	r := rand.New(rand.NewPCG(1, 2))
+	raw := make([]byte, 5*traceChunkSize/2)
+	for i := range raw {
+		raw[i] = byte(r.IntN(16))
+	}
+	var file bytes.Buffer
+	s := newSeekableWriter(&file)
+	for b := raw; len(b) > 0; b = b[min(64<<10, len(b)):] {
+		if _, err := s.Write(b[:min(64<<10, len(b))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// full chunks, then the rest on Close, back to back in both streams
+	chunks := s.chunks
+	if len(chunks) != 3 || chunks[0].RawSize != traceChunkSize || chunks[1].RawSize != traceChunkSize || chunks[2].RawSize != traceChunkSize/2 {
+		t.Fatalf("chunks %+v", chunks)
+	}
+	var off, rawOff int64
+	for i, c := range chunks {
+		if c.Offset != off || c.RawOffset != rawOff {
+			t.Errorf("chunk %d at %d, raw %d, want %d, %d", i, c.Offset, c.RawOffset, off, rawOff)
+		}
+		if c.Start.IsZero() || c.End.Before(c.Start) {
+			t.Errorf("chunk %d written from %v to %v", i, c.Start, c.End)
+		}
+		got, err := analysis.ReadChunk(bytes.NewReader(file.Bytes()), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, raw[c.RawOffset:c.RawOffset+c.RawSize]) {
+			t.Errorf("chunk %d does not decompress to its part of the stream", i)
+		}
+		off += c.Size
+		rawOff += c.RawSize
+	}
+
+	// the seek table follows the last frame, in the skippable frame
+	// plain zstd readers pass over
+	table := file.Bytes()[off:]
+	if !bytes.Equal(table, analysis.SeekTable(chunks)) {
+		t.Fatal("file does not end in the seek table")
+	}
+	le := binary.LittleEndian
+	if le.Uint32(table) != 0x184D2A5E || int(le.Uint32(table[4:])) != len(table)-8 ||
+		le.Uint32(table[len(table)-4:]) != 0x8F92EAB1 || int(le.Uint32(table[len(table)-9:])) != len(chunks) {
+		t.Errorf("seek table header or footer %x", table)
+	}
+	for i, c := range chunks {
+		if int64(le.Uint32(table[8+8*i:])) != c.Size || int64(le.Uint32(table[12+8*i:])) != c.RawSize {
+			t.Errorf("seek table entry %d does not match chunk %+v", i, c)
+		}
+	}
+	d, err := zstd.NewReader(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	all, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(all, raw) {
+		t.Error("the whole file does not decompress to the stream")
+	}
+}
+
+func TestSeekableWriterChunkAge(t *testing.T) {
+	var file bytes.Buffer
+	s := newSeekableWriter(&file)
+	s.Write([]byte("header"))
+	// a trace that trickles in is cut by age, not only by size
+	s.start = s.start.Add(-traceChunkAge)
+	s.Write([]byte("events"))
+	s.Write([]byte("more"))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.chunks) != 2 || s.chunks[0].RawSize != 12 || s.chunks[1].RawSize != 4 {
+		t.Errorf("chunks %+v", s.chunks)
+	}
+}
+
+func TestChunksBetween(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sec := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Second) }
+	a := analysis.Artifact{Chunks: []analysis.Chunk{
+		{Offset: 0, Start: sec(0), End: sec(1)},
+		{Offset: 1, Start: sec(1), End: sec(2)},
+		{Offset: 2, Start: sec(3), End: sec(4)},
+	}}
+	for _, tt := range []struct {
+		from, to time.Time
+		want     []int64
+	}{
+		{sec(0), sec(4), []int64{0, 1, 2}},
+		{sec(1), sec(1), []int64{0, 1}},
+		{sec(2), sec(3), []int64{1, 2}},
+		{t0.Add(2500 * time.Millisecond), t0.Add(2700 * time.Millisecond), nil},
+		{sec(5), sec(6), nil},
+	} {
+		var got []int64
+		for _, c := range a.ChunksBetween(tt.from, tt.to) {
+			got = append(got, c.Offset)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ChunksBetween(%v, %v) = %v, want %v", tt.from.Sub(t0), tt.to.Sub(t0), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package goprof
+
+import (
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// DefaultWallClockRate is the sampling rate of WithWallClock when none is
+// given.
+const DefaultWallClockRate = 99
+
+// WithWallClock also samples the stacks of all goroutines hz times a second
+// (DefaultWallClockRate if hz <= 0) and writes them as <name>.wall.prof, a
+// pprof profile of wall-clock time. Unlike the CPU profile it counts
+// goroutines blocked in I/O, syscalls, channel operations and sleeps, so it
+// shows where a goroutine spends its time whether it is running or not.
+//
+// Each sample briefly stops the world to walk every stack, so its cost grows
+// with the number of goroutines; keep hz low for programs that have many.
+func WithWallClock(hz int) Option {
+	if hz <= 0 {
+		hz = DefaultWallClockRate
+	}
+	return func(c *config) { c.wallClock = hz }
+}
+
+// wallSampler counts the goroutine stacks seen on each tick of
+// WithWallClock.
+type wallSampler struct {
+	hz     int
+	start  time.Time
+	counts map[[32]uintptr]int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startWallClock(hz int) *wallSampler {
+	w := &wallSampler{
+		hz:     hz,
+		start:  time.Now(),
+		counts: map[[32]uintptr]int64{},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(time.Second / time.Duration(hz))
+		defer ticker.Stop()
+		var records []runtime.StackRecord
+		for {
+			select {
+			case <-ticker.C:
+				records = w.sample(records)
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// sample adds the current stacks to the counts and returns the buffer to
+// reuse for the next one.
+func (w *wallSampler) sample(records []runtime.StackRecord) []runtime.StackRecord {
+	n, ok := runtime.GoroutineProfile(records)
+	for !ok {
+		// room for goroutines started in the meantime
+		records = make([]runtime.StackRecord, n+n/4+8)
+		n, ok = runtime.GoroutineProfile(records)
+	}
+	for _, r := range records[:n] {
+		w.counts[r.Stack0]++
+	}
+	return records
+}
+
+// finish stops sampling and writes the profile as the "wall" artifact of s.
+func (w *wallSampler) finish(s *session) (Artifact, error) {
+	close(w.stop)
+	<-w.done
+	prof := w.profile()
+	return s.writeArtifact("wall", func(out io.Writer) error {
+		return prof.Write(out)
+	})
+}
+
+func (w *wallSampler) profile() *profile.Profile {
+	period := int64(time.Second) / int64(w.hz)
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "wall", Unit: "nanoseconds"},
+		},
+		DefaultSampleType: "wall",
+		PeriodType:        &profile.ValueType{Type: "wall", Unit: "nanoseconds"},
+		Period:            period,
+		TimeNanos:         w.start.UnixNano(),
+		DurationNanos:     int64(time.Since(w.start)),
+	}
+	type line struct {
+		fn   string
+		file string
+		line int
+	}
+	funcs := map[string]*profile.Function{}
+	locs := map[line]*profile.Location{}
+	for stack, count := range w.counts {
+		frames := stackFrames(stack[:])
+		if frames == nil {
+			continue
+		}
+		var sample []*profile.Location
+		for _, f := range frames {
+			key := line{f.Function, f.File, f.Line}
+			loc, ok := locs[key]
+			if !ok {
+				fn, ok := funcs[f.Function]
+				if !ok {
+					fn = &profile.Function{ID: uint64(len(funcs) + 1), Name: f.Function, SystemName: f.Function, Filename: f.File}
+					funcs[f.Function] = fn
+					prof.Function = append(prof.Function, fn)
+				}
+				loc = &profile.Location{ID: uint64(len(locs) + 1), Line: []profile.Line{{Function: fn, Line: int64(f.Line)}}}
+				locs[key] = loc
+				prof.Location = append(prof.Location, loc)
+			}
+			sample = append(sample, loc)
+		}
+		prof.Sample = append(prof.Sample, &profile.Sample{
+			Location: sample,
+			Value:    []int64{count, count * period},
+		})
+	}
+	return prof
+}
+
+// stackFrames symbolizes a StackRecord's stack, leaf first. It returns nil
+// for the sampler's own goroutine.
+func stackFrames(stack []uintptr) []runtime.Frame {
+	for i, pc := range stack {
+		if pc == 0 {
+			stack = stack[:i]
+			break
+		}
+	}
+	var frames []runtime.Frame
+	it := runtime.CallersFrames(stack)
+	for {
+		f, more := it.Next()
+		if strings.HasPrefix(f.Function, "github.com/jcocozza/goprof.(*wallSampler)") {
+			return nil
+		}
+		frames = append(frames, f)
+		if !more {
+			return frames
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package goprof
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/jcocozza/goprof/analysis"
+)
+
+// WatchConfig configures a watchdog, which captures profiles by itself
+// when the process crosses a threshold.
+// Zero values fall back to the defaults noted on each field.
+type WatchConfig struct {
+	// Name prefixes every capture; "goprof-<what is watched>" by default.
+	Name string
+	// Interval is how often the threshold is checked; 1 second by default.
+	Interval time.Duration
+	// Cooldown is the least time between two captures, so a process that
+	// stays above the threshold is not dumped over and over; 10 minutes
+	// by default.
+	Cooldown time.Duration
+	// Duration is how long the profiles of WatchCPU run; 10 seconds by
+	// default.
+	Duration time.Duration
+	// Goroutines also captures a goroutine dump with every capture.
+	Goroutines bool
+	// Sink receives the captures; DirSink{"."} by default.
+	Sink Sink
+	// Recipients are age X25519 public keys to encrypt the profiles of
+	// every capture to, as WithEncryption does for sessions.
+	Recipients []string
+
+	// OnError is called for every failed capture; errors are logged to
+	// stderr by default.
+	OnError func(error)
+}
+
+// Watchdog checks a threshold in the background until stopped.
+type Watchdog struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Stop ends the watchdog, waiting for a capture in progress.
+func (w *Watchdog) Stop() {
+	w.once.Do(func() {
+		w.cancel()
+		<-w.done
+	})
+}
+
+// errSkipped is returned by a capture that could not run for now, which
+// is not a failure.
+var errSkipped = errors.New("capture skipped")
+
+// watcher is what a watchdog watches: check reports whether the threshold
+// is crossed and why, and capture adds the profiles that explain it.
+type watcher struct {
+	check   func() (reason string, crossed bool)
+	capture func(ctx context.Context, name string, cfg WatchConfig) ([]memFile, error)
+}
+
+// idleWatchdog watches nothing, for the goprof_disabled build.
+func idleWatchdog() *Watchdog {
+	done := make(chan struct{})
+	close(done)
+	return &Watchdog{cancel: func() {}, done: done}
+}
+
+func startWatchdog(what string, cfg WatchConfig, w watcher) *Watchdog {
+	if buildDisabled {
+		return idleWatchdog()
+	}
+	if cfg.Name == "" {
+		cfg.Name = "goprof-" + what
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 10 * time.Minute
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = 10 * time.Second
+	}
+	if cfg.Sink == nil {
+		cfg.Sink = DirSink{Dir: "."}
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(err error) {
+			defaultLogger.Error("goprof: watchdog capture failed", "watchdog", what, "err", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Watchdog{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		var last time.Time
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			reason, crossed := w.check()
+			if !crossed || (!last.IsZero() && time.Since(last) < cfg.Cooldown) {
+				continue
+			}
+			at := time.Now()
+			err := watchCapture(ctx, cfg, w, reason)
+			if errors.Is(err, errSkipped) {
+				// the threshold is checked again next interval
+				continue
+			}
+			last = at
+			if err != nil && ctx.Err() == nil {
+				recordError(err)
+				cfg.OnError(err)
+			}
+		}
+	}()
+	return d
+}
+
+func watchCapture(ctx context.Context, cfg WatchConfig, w watcher, reason string) error {
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s", cfg.Name, start.UTC().Format("20060102T150405Z"))
+	files, err := w.capture(ctx, name, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if cfg.Goroutines {
+		var b bytes.Buffer
+		if err := writeProfile("goroutine", &b, 2); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		files = append(files, newMemFile(name, "goroutines", b.Bytes()))
+	}
+	recips, err := parseRecipients(cfg.Recipients)
+	if err != nil {
+		return err
+	}
+	m := newManifest(name, start, time.Now(), nil)
+	m.Warnings = []string{reason}
+	return putBundle(ctx, cfg.Sink, m, files, recips)
+}
+
+// heapMetric is the memory occupied by live and not yet swept heap
+// objects, the runtime/metrics counterpart of MemStats.HeapAlloc.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// WatchHeap captures a heap profile whenever the heap grows beyond limit
+// bytes, and a goroutine dump with it if cfg.Goroutines is set, so that
+// memory blowups leave evidence even when nobody is watching. The heap is
+// sampled from runtime/metrics, which does not stop the world.
+func WatchHeap(limit uint64, cfg WatchConfig) *Watchdog {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	return startWatchdog("heap", cfg, watcher{
+		check: func() (string, bool) {
+			metrics.Read(sample)
+			heap := sample[0].Value.Uint64()
+			if heap <= limit {
+				return "", false
+			}
+			return fmt.Sprintf("heap of %s exceeded the limit of %s", analysis.FormatBytes(int64(heap)), analysis.FormatBytes(int64(limit))), true
+		},
+		capture: func(ctx context.Context, name string, cfg WatchConfig) ([]memFile, error) {
+			var b bytes.Buffer
+			if err := writeHeapProfile(&b); err != nil {
+				return nil, err
+			}
+			return []memFile{newMemFile(name, "heap", b.Bytes())}, nil
+		},
+	})
+}
+
+// WatchCPU captures a CPU profile and a trace of cfg.Duration whenever the
+// process has used more than utilization of its GOMAXPROCS cores (0.8 for
+// 80%) for at least sustained, to catch hot loops that never show up on
+// demand. A capture is skipped while a session or another capture holds
+// the CPU profiler or the tracer.
+//
+// CPU usage is read with getrusage, so WatchCPU fails with
+// errors.ErrUnsupported on platforms without it.
+func WatchCPU(utilization float64, sustained time.Duration, cfg WatchConfig) (*Watchdog, error) {
+	if buildDisabled {
+		return idleWatchdog(), nil
+	}
+	last, ok := processCPU()
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	lastAt := time.Now()
+	var since time.Time // above utilization since then
+	return startWatchdog("cpu", cfg, watcher{
+		check: func() (string, bool) {
+			now := time.Now()
+			cpu, _ := processCPU()
+			used := float64(cpu-last) / float64(now.Sub(lastAt)) / float64(runtime.GOMAXPROCS(0))
+			last, lastAt = cpu, now
+			if used < utilization {
+				since = time.Time{}
+				return "", false
+			}
+			if since.IsZero() {
+				since = now
+			}
+			if now.Sub(since) < sustained {
+				return "", false
+			}
+			since = time.Time{}
+			return fmt.Sprintf("CPU usage of %.0f%% of %d cores exceeded %.0f%% for %s", 100*used, runtime.GOMAXPROCS(0), 100*utilization, sustained), true
+		},
+		capture: func(ctx context.Context, name string, cfg WatchConfig) ([]memFile, error) {
+			var cpu, tr bytes.Buffer
+			if ok, err := takeProfilers(&cpu, &tr); !ok {
+				if err == nil {
+					err = errSkipped
+				}
+				return nil, err
+			}
+			timer := time.NewTimer(cfg.Duration)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+			releaseProfilers(true)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return []memFile{newMemFile(name, "cpu", cpu.Bytes()), newMemFile(name, "trace", tr.Bytes())}, nil
+		},
+	}), nil
+}
+
+// WatchGoroutines captures a goroutine dump with full stacks whenever more
+// than limit goroutines are running, or once their number has grown for
+// growth without ever falling, the usual shape of a leak that will only
+// hit the limit at night. A limit or growth of 0 leaves that check out.
+// The dump is always taken, whatever cfg.Goroutines says.
+//
+// The number is sampled from runtime/metrics every cfg.Interval, so growth
+// should span many intervals; a count that holds steady does not break it,
+// but one that drops starts it over.
+func WatchGoroutines(limit int, growth time.Duration, cfg WatchConfig) *Watchdog {
+	cfg.Goroutines = false
+	sample := []metrics.Sample{{Name: metricGoroutines}}
+	var prev, from uint64 // the previous count and the one growth started at
+	var since time.Time
+	return startWatchdog("goroutines", cfg, watcher{
+		check: func() (string, bool) {
+			now := time.Now()
+			metrics.Read(sample)
+			n := sample[0].Value.Uint64()
+			if since.IsZero() || n < prev {
+				since, from = now, n
+			}
+			prev = n
+			if limit > 0 && n > uint64(limit) {
+				since, from = now, n
+				return fmt.Sprintf("%d goroutines exceeded the limit of %d", n, limit), true
+			}
+			if growth > 0 && n > from && now.Sub(since) >= growth {
+				reason := fmt.Sprintf("goroutines grew from %d to %d over %s without falling", from, n, now.Sub(since).Round(time.Second))
+				since, from = now, n
+				return reason, true
+			}
+			return "", false
+		},
+		capture: func(ctx context.Context, name string, cfg WatchConfig) ([]memFile, error) {
+			var b bytes.Buffer
+			if err := writeProfile("goroutine", &b, 2); err != nil {
+				return nil, err
+			}
+			return []memFile{newMemFile(name, "goroutines", b.Bytes())}, nil
+		},
+	})
+}